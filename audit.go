@@ -0,0 +1,109 @@
+package autodns
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// AuditEntry records a zone update: who changed which zone, how and when.
+type AuditEntry struct {
+	// Time is when the update was accepted by AutoDNS
+	Time time.Time `json:"time"`
+	// Zone is the zone name
+	Zone string `json:"zone"`
+	// Operation is the provider method that changed the zone
+	Operation Operation `json:"operation"`
+	// Changes is the resource record diff
+	Changes ChangeSet `json:"changes"`
+	// Settings lists changed zone settings, e.g. "soa" or "nameServers"
+	Settings []string `json:"settings,omitempty"`
+	// STID is the AutoDNS transaction ID of the update
+	STID string `json:"stid,omitempty"`
+	// Username is the AutoDNS user the update was made with
+	Username string `json:"username"`
+	// Actor holds the caller-supplied metadata from WithActor
+	Actor map[string]string `json:"actor,omitempty"`
+}
+
+// AuditSink receives an entry for every successful zone update.
+// Implementations must be safe for concurrent use.
+type AuditSink interface {
+	Audit(ctx context.Context, entry AuditEntry) error
+}
+
+// actorContextKey carries the actor metadata of a call
+type actorContextKey struct{}
+
+// WithActor returns a context whose zone updates are audited with the given
+// metadata, e.g. {"user": "alice", "ticket": "OPS-123"}. Nested calls add to
+// the metadata of the parent context.
+func WithActor(ctx context.Context, actor map[string]string) context.Context {
+	merged := maps.Clone(ActorFromContext(ctx))
+	if merged == nil {
+		merged = make(map[string]string, len(actor))
+	}
+	maps.Copy(merged, actor)
+	return context.WithValue(ctx, actorContextKey{}, merged)
+}
+
+// ActorFromContext returns the metadata set with WithActor, or nil.
+func ActorFromContext(ctx context.Context) map[string]string {
+	actor, _ := ctx.Value(actorContextKey{}).(map[string]string)
+	return actor
+}
+
+// audit completes the entry and hands it to the AuditSink. The caller sets
+// Username to the user the update request was sent with. The zone has
+// already been written, so a failing sink is logged rather than returned.
+func (p *Provider) audit(ctx context.Context, entry AuditEntry) {
+	if p.AuditSink == nil {
+		return
+	}
+
+	entry.Time = time.Now().UTC()
+	entry.Actor = maps.Clone(ActorFromContext(ctx))
+
+	if err := p.AuditSink.Audit(ctx, entry); err != nil {
+		p.logger().ErrorContext(ctx, "audit failed", "zone", entry.Zone, "operation", entry.Operation, "stid", entry.STID, "error", err)
+	}
+}
+
+// JSONLinesAuditSink appends audit entries to a file, one JSON object per
+// line.
+type JSONLinesAuditSink struct {
+	// Path is the audit log file; it is created when needed
+	Path string
+
+	mu sync.Mutex
+}
+
+// Audit implements AuditSink.
+func (s *JSONLinesAuditSink) Audit(_ context.Context, entry AuditEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit entry: %v", err)
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0o700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(line); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
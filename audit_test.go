@@ -0,0 +1,151 @@
+package autodns
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+func TestAuditLog(t *testing.T) {
+	api := newFakeAPI(t, testZone())
+	provider := api.provider()
+	path := filepath.Join(t.TempDir(), "audit", "dns.jsonl")
+	provider.AuditSink = &JSONLinesAuditSink{Path: path}
+
+	ctx := WithActor(context.Background(), map[string]string{"user": "alice"})
+	ctx = WithActor(ctx, map[string]string{"ticket": "OPS-123"})
+
+	_, err := provider.SetRecords(ctx, "example.com", []libdns.Record{
+		libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.99"), TTL: 300 * time.Second},
+	})
+	if err != nil {
+		t.Fatalf("SetRecords failed: %v", err)
+	}
+
+	// Neither a dry run nor an unchanged zone is audited
+	if _, err := provider.Plan(ctx, "example.com", OperationDelete, []libdns.Record{
+		libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.99"), TTL: 300 * time.Second},
+	}); err != nil {
+		t.Fatalf("Plan failed: %v", err)
+	}
+
+	snapshot := newZoneSnapshot("example.com", testZone())
+	snapshot.SOA.Refresh = 600
+	if _, err := provider.Restore(ctx, snapshot); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("Invalid audit line %q: %v", scanner.Text(), err)
+		}
+		entries = append(entries, entry)
+	}
+
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 audit entries, got %d", len(entries))
+	}
+	set := entries[0]
+	if set.Zone != "example.com" || set.Operation != OperationSet || set.Username != "user" || set.STID == "" {
+		t.Errorf("Unexpected audit entry %+v", set)
+	}
+	if len(set.Changes.Modifications) != 1 || set.Changes.Modifications[0].After.Value != "192.0.2.99" {
+		t.Errorf("Expected the record diff, got %+v", set.Changes)
+	}
+	if set.Actor["user"] != "alice" || set.Actor["ticket"] != "OPS-123" {
+		t.Errorf("Expected the actor metadata, got %v", set.Actor)
+	}
+	if restore := entries[1]; restore.Operation != OperationRestore || len(restore.Settings) != 1 || restore.Settings[0] != "soa" {
+		t.Errorf("Expected the SOA change to be audited, got %+v", restore)
+	}
+}
+
+// rotatingCredentials hands out the fake API credentials for the first
+// calls and the credentials of another user afterwards
+type rotatingCredentials struct {
+	mu    sync.Mutex
+	calls int
+	valid int
+}
+
+func (r *rotatingCredentials) Credentials(context.Context) (Credentials, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls++
+	if r.calls > r.valid {
+		return Credentials{Username: "rotated", Password: "next-secret"}, nil
+	}
+	return Credentials{Username: "user", Password: "secret"}, nil
+}
+
+// memoryAuditSink collects audit entries
+type memoryAuditSink struct {
+	mu      sync.Mutex
+	entries []AuditEntry
+}
+
+func (m *memoryAuditSink) Audit(_ context.Context, entry AuditEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries = append(m.entries, entry)
+	return nil
+}
+
+func TestAuditUsernameOfRequest(t *testing.T) {
+	api := newFakeAPI(t, testZone())
+	source := &rotatingCredentials{valid: 2}
+	sink := &memoryAuditSink{}
+	provider := &Provider{Endpoint: api.URL, CredentialSource: source, AuditSink: sink}
+
+	// The credentials rotate right after the update was sent
+	_, err := provider.AppendRecords(context.Background(), "example.com", []libdns.Record{
+		libdns.TXT{Name: "new", Text: "value", TTL: time.Minute},
+	})
+	if err != nil {
+		t.Fatalf("AppendRecords failed: %v", err)
+	}
+
+	if source.calls != 2 {
+		t.Errorf("Expected one credentials lookup per request, got %d", source.calls)
+	}
+	if len(sink.entries) != 1 || sink.entries[0].Username != "user" {
+		t.Errorf("Expected the update to be audited with the user that sent it, got %+v", sink.entries)
+	}
+}
+
+type failingAuditSink struct{}
+
+func (failingAuditSink) Audit(context.Context, AuditEntry) error {
+	return errors.New("disk full")
+}
+
+func TestAuditFailureDoesNotFailUpdate(t *testing.T) {
+	api := newFakeAPI(t, testZone())
+	provider := api.provider()
+	provider.AuditSink = failingAuditSink{}
+
+	_, err := provider.AppendRecords(context.Background(), "example.com", []libdns.Record{
+		libdns.TXT{Name: "new", Text: "value", TTL: time.Minute},
+	})
+	if err != nil {
+		t.Errorf("Expected the update to succeed, got %v", err)
+	}
+}
@@ -0,0 +1,157 @@
+// Package autodnslego solves go-acme/lego DNS-01 challenges with AutoDNS.
+//
+// DNSProvider implements lego's challenge.Provider and
+// challenge.ProviderTimeout interfaces. The package does not import lego,
+// so it adds no dependencies:
+//
+//	provider, err := autodnslego.NewDNSProvider()
+//	if err != nil {
+//		return err
+//	}
+//	client.Challenge.SetDNS01Provider(provider)
+package autodnslego
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	autodns "github.com/saveenergy/libdns-autodns"
+	"github.com/saveenergy/libdns-autodns/dns01"
+)
+
+// Environment variables read by NewDNSProvider in addition to the AUTODNS_*
+// variables of autodns.NewFromEnv. Durations are given in seconds, as for
+// lego's own providers, or as Go durations such as "2m".
+const (
+	EnvTTL                = "AUTODNS_TTL"
+	EnvPropagationTimeout = "AUTODNS_PROPAGATION_TIMEOUT"
+	EnvPollingInterval    = "AUTODNS_POLLING_INTERVAL"
+	EnvStateFile          = "AUTODNS_STATE_FILE"
+)
+
+// Defaults for Config. AutoDNS pushes zone updates to its name servers
+// within a minute or two, so lego is told to wait longer than that.
+const (
+	DefaultTTL                = dns01.DefaultTTL
+	DefaultPropagationTimeout = 3 * time.Minute
+	DefaultPollingInterval    = 5 * time.Second
+)
+
+// Config configures a DNSProvider.
+type Config struct {
+	// Provider writes the challenge records
+	Provider *autodns.Provider
+	// TTL of the challenge records
+	TTL time.Duration
+	// PropagationTimeout is how long lego waits for the record to appear
+	PropagationTimeout time.Duration
+	// PollingInterval is how often lego checks for the record
+	PollingInterval time.Duration
+	// StateFile keeps the presented records across restarts (optional)
+	StateFile string
+}
+
+// NewDefaultConfig returns a Config with the default timeouts and no
+// Provider.
+func NewDefaultConfig() *Config {
+	return &Config{
+		TTL:                DefaultTTL,
+		PropagationTimeout: DefaultPropagationTimeout,
+		PollingInterval:    DefaultPollingInterval,
+	}
+}
+
+// DNSProvider presents and cleans up DNS-01 challenge records in AutoDNS.
+type DNSProvider struct {
+	config *Config
+	solver *dns01.Solver
+}
+
+// NewDNSProvider creates a DNSProvider configured from the environment.
+func NewDNSProvider() (*DNSProvider, error) {
+	provider, err := autodns.NewFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("autodns: %w", err)
+	}
+
+	config := NewDefaultConfig()
+	config.Provider = provider
+	config.StateFile = os.Getenv(EnvStateFile)
+	for _, v := range []struct {
+		name string
+		dest *time.Duration
+	}{
+		{EnvTTL, &config.TTL},
+		{EnvPropagationTimeout, &config.PropagationTimeout},
+		{EnvPollingInterval, &config.PollingInterval},
+	} {
+		value := os.Getenv(v.name)
+		if value == "" {
+			continue
+		}
+		if *v.dest, err = parseDuration(value); err != nil {
+			return nil, fmt.Errorf("autodns: invalid %s %q: %v", v.name, value, err)
+		}
+	}
+	return NewDNSProviderConfig(config)
+}
+
+// NewDNSProviderConfig creates a DNSProvider from config.
+func NewDNSProviderConfig(config *Config) (*DNSProvider, error) {
+	if config == nil {
+		return nil, fmt.Errorf("autodns: the configuration is missing")
+	}
+	if config.Provider == nil {
+		return nil, fmt.Errorf("autodns: Provider is required")
+	}
+	if config.PropagationTimeout <= 0 || config.PollingInterval <= 0 {
+		return nil, fmt.Errorf("autodns: PropagationTimeout and PollingInterval must be positive")
+	}
+
+	return &DNSProvider{
+		config: config,
+		solver: &dns01.Solver{
+			Provider:  config.Provider,
+			TTL:       config.TTL,
+			StateFile: config.StateFile,
+		},
+	}, nil
+}
+
+// Present creates the TXT record for the challenge.
+func (d *DNSProvider) Present(domain, token, keyAuth string) error {
+	if err := d.solver.Present(domain, token, keyAuth); err != nil {
+		return fmt.Errorf("autodns: %w", err)
+	}
+	return nil
+}
+
+// CleanUp removes the TXT record of the challenge.
+func (d *DNSProvider) CleanUp(domain, token, keyAuth string) error {
+	if err := d.solver.CleanUp(domain, token, keyAuth); err != nil {
+		return fmt.Errorf("autodns: %w", err)
+	}
+	return nil
+}
+
+// Timeout returns how long and how often lego checks that the record has
+// propagated.
+func (d *DNSProvider) Timeout() (timeout, interval time.Duration) {
+	return d.config.PropagationTimeout, d.config.PollingInterval
+}
+
+// Solver returns the underlying dns01.Solver, e.g. to clean up stale
+// records.
+func (d *DNSProvider) Solver() *dns01.Solver {
+	return d.solver
+}
+
+// parseDuration accepts whole seconds or a Go duration
+func parseDuration(value string) (time.Duration, error) {
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	return time.ParseDuration(value)
+}
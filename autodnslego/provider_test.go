@@ -0,0 +1,111 @@
+package autodnslego
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	autodns "github.com/saveenergy/libdns-autodns"
+	"github.com/saveenergy/libdns-autodns/dns01"
+	"github.com/saveenergy/libdns-autodns/internal/autodnstest"
+)
+
+// The lego interfaces, declared here so the tests do not depend on lego
+type (
+	challengeProvider interface {
+		Present(domain, token, keyAuth string) error
+		CleanUp(domain, token, keyAuth string) error
+	}
+	challengeProviderTimeout interface {
+		challengeProvider
+		Timeout() (timeout, interval time.Duration)
+	}
+)
+
+var _ challengeProviderTimeout = (*DNSProvider)(nil)
+
+// testZone returns the zone served by the fake API
+func testZone() autodns.Zone {
+	return autodns.Zone{
+		Origin: "example.com",
+		SOA:    &autodns.SOA{TTL: 86400, Email: "hostmaster@example.com"},
+		ResourceRecords: []autodns.ResourceRecord{
+			{Name: "www", TTL: 300, Type: "A", Value: "192.0.2.1"},
+		},
+	}
+}
+
+func TestPresentCleanUp(t *testing.T) {
+	api := autodnstest.SetEnv(t, testZone())
+	t.Setenv(EnvTTL, "120")
+
+	provider, err := NewDNSProvider()
+	if err != nil {
+		t.Fatalf("NewDNSProvider failed: %v", err)
+	}
+
+	if err := provider.Present("www.example.com", "token", "key-auth"); err != nil {
+		t.Fatalf("Present failed: %v", err)
+	}
+	_, value := dns01.ChallengeRecord("www.example.com", "key-auth")
+	var found bool
+	for _, rr := range api.Zone("example.com").ResourceRecords {
+		if rr.Type == "TXT" && rr.Name == "_acme-challenge.www" && rr.Value == value {
+			found = rr.TTL == 120
+		}
+	}
+	if !found {
+		t.Fatalf("Expected the challenge record with TTL 120, got %+v", api.Zone("example.com").ResourceRecords)
+	}
+
+	if err := provider.CleanUp("www.example.com", "token", "key-auth"); err != nil {
+		t.Fatalf("CleanUp failed: %v", err)
+	}
+	if records := api.Zone("example.com").ResourceRecords; len(records) != 1 {
+		t.Errorf("Expected the challenge record to be removed, got %+v", records)
+	}
+
+	err = provider.Present("www.example.org", "token", "key-auth")
+	if err == nil || !strings.HasPrefix(err.Error(), "autodns: ") {
+		t.Errorf("Expected an error for a zone outside the account, got %v", err)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	autodnstest.SetEnv(t, testZone())
+
+	provider, err := NewDNSProvider()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if timeout, interval := provider.Timeout(); timeout != DefaultPropagationTimeout || interval != DefaultPollingInterval {
+		t.Errorf("Expected the default timeouts, got %v, %v", timeout, interval)
+	}
+
+	t.Setenv(EnvPropagationTimeout, "600")
+	t.Setenv(EnvPollingInterval, "1m30s")
+	if provider, err = NewDNSProvider(); err != nil {
+		t.Fatal(err)
+	}
+	if timeout, interval := provider.Timeout(); timeout != 10*time.Minute || interval != 90*time.Second {
+		t.Errorf("Expected the configured timeouts, got %v, %v", timeout, interval)
+	}
+}
+
+func TestNewDNSProviderErrors(t *testing.T) {
+	autodnstest.SetEnv(t, testZone())
+	t.Setenv(EnvPollingInterval, "often")
+	if _, err := NewDNSProvider(); err == nil || !strings.Contains(err.Error(), EnvPollingInterval) {
+		t.Errorf("Expected an invalid interval error, got %v", err)
+	}
+
+	t.Setenv(EnvPollingInterval, "")
+	t.Setenv(autodns.EnvPassword, "")
+	if _, err := NewDNSProvider(); err == nil || !strings.Contains(err.Error(), "password is required") {
+		t.Errorf("Expected a missing password error, got %v", err)
+	}
+
+	if _, err := NewDNSProviderConfig(NewDefaultConfig()); err == nil {
+		t.Error("Expected an error without a Provider")
+	}
+}
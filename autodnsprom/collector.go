@@ -0,0 +1,165 @@
+// Package autodnsprom exports AutoDNS provider activity as Prometheus
+// metrics.
+//
+// A Collector is attached to a provider as its Observer and registered with
+// a Prometheus registry:
+//
+//	collector := autodnsprom.NewCollector()
+//	prometheus.MustRegister(collector)
+//	provider.Observer = collector
+package autodnsprom
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	autodns "github.com/saveenergy/libdns-autodns"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "autodns"
+
+// Collector is a prometheus.Collector fed by an autodns.Provider through
+// the autodns.Observer interface. It is safe for concurrent use and may be
+// shared by several providers.
+type Collector struct {
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	retries         *prometheus.CounterVec
+	rateLimitWait   *prometheus.CounterVec
+	cacheLookups    *prometheus.CounterVec
+	cacheHitRatio   prometheus.GaugeFunc
+	lastUpdate      *prometheus.GaugeVec
+
+	mu           sync.Mutex
+	cacheHits    uint64
+	cacheLookupN uint64
+}
+
+// NewCollector creates a Collector with all metrics at zero.
+func NewCollector() *Collector {
+	c := &Collector{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "requests_total",
+			Help:      "AutoDNS API requests by endpoint, method and HTTP status (\"error\" if no response was received).",
+		}, []string{"endpoint", "method", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "request_duration_seconds",
+			Help:      "Duration of AutoDNS API requests.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"endpoint", "method"}),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "retries_total",
+			Help:      "AutoDNS API requests retried by endpoint, method and the HTTP status that caused the retry.",
+		}, []string{"endpoint", "method", "status"}),
+		rateLimitWait: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "rate_limit_wait_seconds_total",
+			Help:      "Time spent waiting after rate limited AutoDNS API requests.",
+		}, []string{"endpoint"}),
+		cacheLookups: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "zone_cache_lookups_total",
+			Help:      "Zone cache lookups by result (hit or miss).",
+		}, []string{"result"}),
+		lastUpdate: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "zone_last_update_timestamp_seconds",
+			Help:      "Unix time of the last successful update per zone.",
+		}, []string{"zone"}),
+	}
+	c.cacheHitRatio = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "zone_cache_hit_ratio",
+		Help:      "Share of zone lookups served from the cache.",
+	}, c.hitRatio)
+
+	// Initialize both results so rate() works from the first scrape
+	c.cacheLookups.WithLabelValues("hit")
+	c.cacheLookups.WithLabelValues("miss")
+	return c
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.requests.Describe(ch)
+	c.requestDuration.Describe(ch)
+	c.retries.Describe(ch)
+	c.rateLimitWait.Describe(ch)
+	c.cacheLookups.Describe(ch)
+	c.cacheHitRatio.Describe(ch)
+	c.lastUpdate.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.requests.Collect(ch)
+	c.requestDuration.Collect(ch)
+	c.retries.Collect(ch)
+	c.rateLimitWait.Collect(ch)
+	c.cacheLookups.Collect(ch)
+	c.cacheHitRatio.Collect(ch)
+	c.lastUpdate.Collect(ch)
+}
+
+// ObserveRequest implements autodns.Observer.
+func (c *Collector) ObserveRequest(event autodns.RequestEvent) {
+	status := "error"
+	if event.Status != 0 {
+		status = strconv.Itoa(event.Status)
+	}
+	c.requests.WithLabelValues(event.Endpoint, event.Method, status).Inc()
+	c.requestDuration.WithLabelValues(event.Endpoint, event.Method).Observe(event.Duration.Seconds())
+}
+
+// ObserveRetry implements autodns.Observer.
+func (c *Collector) ObserveRetry(event autodns.RetryEvent) {
+	c.retries.WithLabelValues(event.Endpoint, event.Method, strconv.Itoa(event.Status)).Inc()
+}
+
+// ObserveRateLimitWait implements autodns.Observer.
+func (c *Collector) ObserveRateLimitWait(endpoint string, wait time.Duration) {
+	c.rateLimitWait.WithLabelValues(endpoint).Add(wait.Seconds())
+}
+
+// ObserveZoneCache implements autodns.Observer.
+func (c *Collector) ObserveZoneCache(zone string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	c.cacheLookups.WithLabelValues(result).Inc()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cacheLookupN++
+	if hit {
+		c.cacheHits++
+	}
+}
+
+// ObserveZoneUpdate implements autodns.Observer.
+func (c *Collector) ObserveZoneUpdate(zone string, at time.Time) {
+	c.lastUpdate.WithLabelValues(zone).Set(float64(at.UnixNano()) / float64(time.Second))
+}
+
+// hitRatio returns the cache hit ratio, or 0 before the first lookup
+func (c *Collector) hitRatio() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cacheLookupN == 0 {
+		return 0
+	}
+	return float64(c.cacheHits) / float64(c.cacheLookupN)
+}
+
+// Interface guards
+var (
+	_ prometheus.Collector = (*Collector)(nil)
+	_ autodns.Observer     = (*Collector)(nil)
+)
@@ -0,0 +1,114 @@
+package autodnsprom
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+	autodns "github.com/saveenergy/libdns-autodns"
+	"github.com/saveenergy/libdns-autodns/internal/autodnstest"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// testZone returns the zone served by the fake API
+func testZone() autodns.Zone {
+	return autodns.Zone{
+		Origin: "example.com",
+		ResourceRecords: []autodns.ResourceRecord{
+			{Name: "www", TTL: 300, Type: "A", Value: "192.0.2.1"},
+		},
+	}
+}
+
+func TestCollector(t *testing.T) {
+	collector := NewCollector()
+	provider := autodnstest.NewServer(t, testZone()).Provider()
+	provider.Observer = collector
+
+	ctx := context.Background()
+	before := time.Now()
+	_, err := provider.AppendRecords(ctx, "example.com", []libdns.Record{
+		libdns.TXT{Name: "metrics", Text: "value", TTL: 300 * time.Second},
+	})
+	if err != nil {
+		t.Fatalf("AppendRecords failed: %v", err)
+	}
+	// The update clears the cache, so this is a miss followed by a hit
+	if _, err := provider.GetRecords(ctx, "example.com"); err != nil {
+		t.Fatalf("GetRecords failed: %v", err)
+	}
+	if _, err := provider.GetRecords(ctx, "example.com"); err != nil {
+		t.Fatalf("GetRecords failed: %v", err)
+	}
+	if _, err := provider.GetRecords(ctx, "missing.example"); err == nil {
+		t.Fatal("Expected GetRecords on a missing zone to fail")
+	}
+
+	expected := `
+# HELP autodns_requests_total AutoDNS API requests by endpoint, method and HTTP status ("error" if no response was received).
+# TYPE autodns_requests_total counter
+autodns_requests_total{endpoint="/zone/{name}",method="GET",status="200"} 2
+autodns_requests_total{endpoint="/zone/{name}",method="GET",status="404"} 1
+autodns_requests_total{endpoint="/zone/{name}",method="PUT",status="200"} 1
+# HELP autodns_zone_cache_lookups_total Zone cache lookups by result (hit or miss).
+# TYPE autodns_zone_cache_lookups_total counter
+autodns_zone_cache_lookups_total{result="hit"} 1
+autodns_zone_cache_lookups_total{result="miss"} 3
+# HELP autodns_zone_cache_hit_ratio Share of zone lookups served from the cache.
+# TYPE autodns_zone_cache_hit_ratio gauge
+autodns_zone_cache_hit_ratio 0.25
+`
+	err = testutil.CollectAndCompare(collector, strings.NewReader(expected),
+		"autodns_requests_total", "autodns_zone_cache_lookups_total", "autodns_zone_cache_hit_ratio")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if n := testutil.CollectAndCount(collector, "autodns_request_duration_seconds"); n != 2 {
+		t.Errorf("Expected duration histograms for GET and PUT, got %d", n)
+	}
+
+	updated := testutil.ToFloat64(collector.lastUpdate.WithLabelValues("example.com"))
+	if updated < float64(before.Unix()) {
+		t.Errorf("Expected last update timestamp after %d, got %f", before.Unix(), updated)
+	}
+}
+
+func TestCollectorRetries(t *testing.T) {
+	api := autodnstest.NewServer(t, testZone())
+	api.RateLimit(2)
+	collector := NewCollector()
+	provider := api.Provider()
+	provider.Observer = collector
+	if _, err := provider.GetRecords(context.Background(), "example.com"); err != nil {
+		t.Fatalf("GetRecords failed: %v", err)
+	}
+
+	expected := `
+# HELP autodns_retries_total AutoDNS API requests retried by endpoint, method and the HTTP status that caused the retry.
+# TYPE autodns_retries_total counter
+autodns_retries_total{endpoint="/zone/{name}",method="GET",status="429"} 2
+`
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(expected), "autodns_retries_total"); err != nil {
+		t.Error(err)
+	}
+	if n := testutil.CollectAndCount(collector, "autodns_rate_limit_wait_seconds_total"); n != 1 {
+		t.Errorf("Expected rate limit wait time for one endpoint, got %d series", n)
+	}
+	if wait := testutil.ToFloat64(collector.rateLimitWait.WithLabelValues("/zone/{name}")); wait <= 0 {
+		t.Errorf("Expected a positive rate limit wait time, got %f", wait)
+	}
+}
+
+func TestCollectorLint(t *testing.T) {
+	problems, err := testutil.CollectAndLint(NewCollector())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, problem := range problems {
+		t.Errorf("%s: %s", problem.Metric, problem.Text)
+	}
+}
@@ -0,0 +1,313 @@
+package autodns
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OperationRollback identifies Rollback in change logs.
+const OperationRollback Operation = "rollback"
+
+// ErrBackupNotFound is returned when a backup does not exist in the store.
+var ErrBackupNotFound = errors.New("backup not found")
+
+// Backup is the state of a zone saved before an update overwrote it.
+type Backup struct {
+	// ID identifies the backup within its zone; assigned by the store
+	ID string `json:"id"`
+	// Zone is the zone name
+	Zone string `json:"zone"`
+	// CreatedAt is the time the backup was taken
+	CreatedAt time.Time `json:"createdAt"`
+	// STID is the AutoDNS transaction that fetched the saved state
+	STID string `json:"stid,omitempty"`
+	// Operation is the update that was about to overwrite the zone
+	Operation Operation `json:"operation"`
+	// Snapshot is the saved zone state
+	Snapshot *ZoneSnapshot `json:"snapshot"`
+}
+
+// BackupStore persists zone backups. Implementations must be safe for
+// concurrent use.
+type BackupStore interface {
+	// SaveBackup stores the backup and returns its ID
+	SaveBackup(ctx context.Context, backup Backup) (string, error)
+	// LoadBackup returns the backup with the given ID, or an error wrapping
+	// ErrBackupNotFound
+	LoadBackup(ctx context.Context, zone, id string) (Backup, error)
+	// ListBackups returns the backups of a zone, newest first. Listed
+	// backups may lack the snapshot and STID; LoadBackup returns them
+	// complete.
+	ListBackups(ctx context.Context, zone string) ([]Backup, error)
+}
+
+// backupZone saves the current state of the zone before it is overwritten.
+// A failed backup aborts the update.
+func (p *Provider) backupZone(ctx context.Context, zoneName string, operation Operation, current Zone) error {
+	if p.BackupStore == nil {
+		return nil
+	}
+
+	snapshot := newZoneSnapshot(zoneName, current)
+	id, err := p.BackupStore.SaveBackup(ctx, Backup{
+		Zone:      snapshot.Zone,
+		CreatedAt: snapshot.TakenAt,
+		STID:      p.zoneSTID(zoneName),
+		Operation: operation,
+		Snapshot:  snapshot,
+	})
+	if err != nil {
+		p.logger().ErrorContext(ctx, "zone backup failed", "zone", zoneName, "operation", operation, "error", err)
+		return fmt.Errorf("failed to back up zone %s: %v", zoneName, err)
+	}
+	p.logger().DebugContext(ctx, "zone backed up", "zone", zoneName, "operation", operation, "backup", id)
+	return nil
+}
+
+// Rollback restores the zone to the state saved in a backup, as returned by
+// ListBackups of the Provider's BackupStore. An empty id selects the most
+// recent backup. The rollback itself is backed up first, so it can be undone
+// the same way.
+func (p *Provider) Rollback(ctx context.Context, zone, id string) (_ RestorePlan, err error) {
+	ctx, end := p.startOperation(ctx, "Rollback", zone, 0)
+	defer func() { end(err) }()
+
+	if err := p.ensureInitialized(); err != nil {
+		return RestorePlan{}, err
+	}
+
+	if zone == "" {
+		return RestorePlan{}, fmt.Errorf("zone name is required")
+	}
+	if p.BackupStore == nil {
+		return RestorePlan{}, fmt.Errorf("no backup store configured")
+	}
+
+	if id == "" {
+		backups, err := p.BackupStore.ListBackups(ctx, zone)
+		if err != nil {
+			return RestorePlan{}, fmt.Errorf("failed to list backups of %s: %v", zone, err)
+		}
+		if len(backups) == 0 {
+			return RestorePlan{}, fmt.Errorf("no backups of %s: %w", zone, ErrBackupNotFound)
+		}
+		id = backups[0].ID
+	}
+
+	backup, err := p.BackupStore.LoadBackup(ctx, zone, id)
+	if err != nil {
+		return RestorePlan{}, fmt.Errorf("failed to load backup %s of %s: %w", id, zone, err)
+	}
+	p.logger().InfoContext(ctx, "rolling back zone", "zone", zone, "backup", backup.ID, "stid", backup.STID)
+
+	return p.restore(ctx, backup.Snapshot, OperationRollback, true)
+}
+
+// FileBackupStore keeps backups as JSON files in Dir/<zone>/<id>.json. The
+// ID holds the creation time and the operation, so backups are listed
+// without reading the files.
+type FileBackupStore struct {
+	// Dir is the backup directory; it is created when needed
+	Dir string
+	// Keep is the number of backups kept per zone; 0 keeps all (optional)
+	Keep int
+	// MaxAge removes backups older than this; 0 keeps them forever (optional)
+	MaxAge time.Duration
+}
+
+// backupIDLayout makes backup IDs sort chronologically
+const backupIDLayout = "20060102T150405.000000000Z"
+
+// SaveBackup implements BackupStore. Older backups are then pruned
+// according to Keep and MaxAge; pruning is best effort and does not fail the
+// save.
+func (s *FileBackupStore) SaveBackup(ctx context.Context, backup Backup) (string, error) {
+	dir, err := s.zoneDir(backup.Zone)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+
+	base := backup.CreatedAt.UTC().Format(backupIDLayout)
+	for attempt := 0; ; attempt++ {
+		backup.ID = base
+		if attempt > 0 {
+			backup.ID = fmt.Sprintf("%s-%d", base, attempt)
+		}
+		if isBackupIDOperation(backup.Operation) {
+			backup.ID += "_" + string(backup.Operation)
+		}
+
+		f, err := os.OpenFile(filepath.Join(dir, backup.ID+".json"), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(backup)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(f.Name())
+			return "", err
+		}
+
+		s.Prune(ctx, backup.Zone)
+		return backup.ID, nil
+	}
+}
+
+// LoadBackup implements BackupStore.
+func (s *FileBackupStore) LoadBackup(_ context.Context, zone, id string) (Backup, error) {
+	dir, err := s.zoneDir(zone)
+	if err != nil {
+		return Backup{}, err
+	}
+	if id == "" || filepath.Base(id) != id || strings.HasPrefix(id, ".") {
+		return Backup{}, fmt.Errorf("invalid backup id %q", id)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, id+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return Backup{}, ErrBackupNotFound
+	}
+	if err != nil {
+		return Backup{}, err
+	}
+
+	var backup Backup
+	if err := json.Unmarshal(data, &backup); err != nil {
+		return Backup{}, fmt.Errorf("failed to decode backup %s: %v", id, err)
+	}
+	return backup, nil
+}
+
+// ListBackups implements BackupStore. The backups are built from the file
+// names and carry the ID, zone, creation time and operation only.
+func (s *FileBackupStore) ListBackups(_ context.Context, zone string) ([]Backup, error) {
+	dir, err := s.zoneDir(zone)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []Backup
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		backup, ok := parseBackupID(id)
+		if !ok {
+			continue
+		}
+		backup.Zone = strings.ToLower(strings.TrimSuffix(zone, "."))
+		backups = append(backups, backup)
+	}
+
+	slices.SortFunc(backups, func(a, b Backup) int {
+		return cmp.Or(b.CreatedAt.Compare(a.CreatedAt), cmp.Compare(backupSequence(b.ID), backupSequence(a.ID)))
+	})
+	return backups, nil
+}
+
+// Prune removes the backups of a zone that exceed Keep or MaxAge. The most
+// recent backup is always kept.
+func (s *FileBackupStore) Prune(ctx context.Context, zone string) error {
+	if s.Keep <= 0 && s.MaxAge <= 0 {
+		return nil
+	}
+
+	backups, err := s.ListBackups(ctx, zone)
+	if err != nil {
+		return err
+	}
+	dir, err := s.zoneDir(zone)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for i, backup := range backups {
+		withinKeep := s.Keep <= 0 || i < s.Keep
+		expired := s.MaxAge > 0 && time.Since(backup.CreatedAt) > s.MaxAge
+		if i == 0 || withinKeep && !expired {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, backup.ID+".json")); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// parseBackupID reads the creation time and operation from a backup ID of
+// the form <time>[-<n>][_<operation>]
+func parseBackupID(id string) (Backup, bool) {
+	stamp, operation, _ := strings.Cut(id, "_")
+	stamp, _, _ = strings.Cut(stamp, "-")
+	createdAt, err := time.Parse(backupIDLayout, stamp)
+	if err != nil {
+		return Backup{}, false
+	}
+	return Backup{ID: id, CreatedAt: createdAt, Operation: Operation(operation)}, true
+}
+
+// backupSequence returns n of a backup ID, which orders backups taken at
+// the same time
+func backupSequence(id string) int {
+	stamp, _, _ := strings.Cut(id, "_")
+	_, n, _ := strings.Cut(stamp, "-")
+	seq, _ := strconv.Atoi(n)
+	return seq
+}
+
+// isBackupIDOperation reports whether an operation can be part of a backup
+// ID, which is also a file name
+func isBackupIDOperation(operation Operation) bool {
+	if operation == "" {
+		return false
+	}
+	for _, c := range operation {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// zoneDir returns the backup directory of a zone, rejecting names that
+// would escape Dir
+func (s *FileBackupStore) zoneDir(zone string) (string, error) {
+	if s.Dir == "" {
+		return "", fmt.Errorf("backup directory is required")
+	}
+	zone = strings.ToLower(strings.TrimSuffix(zone, "."))
+	if zone == "" || strings.ContainsAny(zone, `/\`) || strings.HasPrefix(zone, ".") {
+		return "", fmt.Errorf("invalid zone name %q", zone)
+	}
+	return filepath.Join(s.Dir, zone), nil
+}
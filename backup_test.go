@@ -0,0 +1,177 @@
+package autodns
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+func TestBackupAndRollback(t *testing.T) {
+	ctx := context.Background()
+	api := newFakeAPI(t, testZone())
+	provider := api.provider()
+	store := &FileBackupStore{Dir: t.TempDir()}
+	provider.BackupStore = store
+
+	// A SetRecords call with the wrong address
+	_, err := provider.SetRecords(ctx, "example.com", []libdns.Record{
+		libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.99"), TTL: 300 * time.Second},
+	})
+	if err != nil {
+		t.Fatalf("SetRecords failed: %v", err)
+	}
+
+	backups, err := store.ListBackups(ctx, "example.com")
+	if err != nil {
+		t.Fatalf("ListBackups failed: %v", err)
+	}
+	if len(backups) != 1 {
+		t.Fatalf("Expected 1 backup, got %d", len(backups))
+	}
+	if backups[0].Operation != OperationSet {
+		t.Errorf("Expected the operation in the listing, got %+v", backups[0])
+	}
+	backup, err := store.LoadBackup(ctx, "example.com", backups[0].ID)
+	if err != nil {
+		t.Fatalf("LoadBackup failed: %v", err)
+	}
+	if backup.Operation != OperationSet || !strings.HasPrefix(backup.STID, "20261018-stid-") || len(backup.Snapshot.ResourceRecords) != 3 {
+		t.Errorf("Unexpected backup %+v", backup)
+	}
+
+	plan, err := provider.Rollback(ctx, "example.com", "")
+	if err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+	if plan.Records.String() != "example.com: +0 -0 ~1" {
+		t.Errorf("Unexpected rollback plan %s", plan)
+	}
+	if got := api.Zone("example.com").ResourceRecords; len(got) != 3 || got[0].Value != "192.0.2.1" {
+		t.Errorf("Zone not rolled back: %+v", got)
+	}
+
+	// The rollback is backed up as well and can be undone by ID
+	backups, _ = store.ListBackups(ctx, "example.com")
+	if len(backups) != 2 || backups[0].Operation != OperationRollback {
+		t.Fatalf("Expected the rollback to be backed up first, got %+v", backups)
+	}
+	if _, err := provider.Rollback(ctx, "example.com", backups[0].ID); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+	if got := api.Zone("example.com").ResourceRecords; got[2].Value != "192.0.2.99" {
+		t.Errorf("Expected the rollback to be undone, got %+v", got)
+	}
+
+	if _, err := provider.Rollback(ctx, "example.com", "19700101T000000.000000000Z"); !errors.Is(err, ErrBackupNotFound) {
+		t.Errorf("Expected ErrBackupNotFound, got %v", err)
+	}
+}
+
+func TestBackupSkipped(t *testing.T) {
+	ctx := context.Background()
+	api := newFakeAPI(t, testZone())
+	provider := api.provider()
+	store := &FileBackupStore{Dir: t.TempDir()}
+	provider.BackupStore = store
+
+	record := libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.1"), TTL: 300 * time.Second}
+	if _, err := provider.SetRecords(ctx, "example.com", []libdns.Record{record}); err != nil {
+		t.Fatalf("SetRecords failed: %v", err)
+	}
+	if _, err := provider.Plan(ctx, "example.com", OperationDelete, []libdns.Record{record}); err != nil {
+		t.Fatalf("Plan failed: %v", err)
+	}
+
+	if backups, _ := store.ListBackups(ctx, "example.com"); len(backups) != 0 {
+		t.Errorf("Expected no backups for unchanged zones and dry runs, got %d", len(backups))
+	}
+}
+
+func TestBackupFailureAbortsUpdate(t *testing.T) {
+	ctx := context.Background()
+	api := newFakeAPI(t, testZone())
+	provider := api.provider()
+
+	// A file where the backup directory should be
+	dir := filepath.Join(t.TempDir(), "backups")
+	if err := os.WriteFile(dir, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	provider.BackupStore = &FileBackupStore{Dir: dir}
+
+	_, err := provider.DeleteRecords(ctx, "example.com", []libdns.Record{
+		libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.1"), TTL: 300 * time.Second},
+	})
+	if err == nil || !strings.Contains(err.Error(), "failed to back up zone") {
+		t.Fatalf("Expected a backup error, got %v", err)
+	}
+	for _, req := range api.Requests() {
+		if strings.HasPrefix(req, "PUT") {
+			t.Errorf("Expected no zone update, got %v", api.Requests())
+		}
+	}
+}
+
+func TestFileBackupStoreRetention(t *testing.T) {
+	ctx := context.Background()
+	store := &FileBackupStore{Dir: t.TempDir()}
+	snapshot := newZoneSnapshot("example.com", testZone())
+
+	// Five backups, the first two older than MaxAge, two sharing a time
+	now := time.Now().UTC()
+	for _, createdAt := range []time.Time{
+		now.Add(-72 * time.Hour),
+		now.Add(-48 * time.Hour),
+		now.Add(-time.Hour),
+		now,
+		now,
+	} {
+		if _, err := store.SaveBackup(ctx, Backup{Zone: "example.com", CreatedAt: createdAt, Operation: OperationSet, Snapshot: snapshot}); err != nil {
+			t.Fatalf("SaveBackup failed: %v", err)
+		}
+	}
+	backups, err := store.ListBackups(ctx, "example.com")
+	if err != nil || len(backups) != 5 {
+		t.Fatalf("Expected 5 backups without retention, got %d (%v)", len(backups), err)
+	}
+	if !strings.HasSuffix(backups[0].ID, "-1_set") || backups[0].Operation != OperationSet {
+		t.Errorf("Expected the later of two simultaneous backups first, got %+v", backups[0])
+	}
+
+	store.MaxAge = 24 * time.Hour
+	if err := store.Prune(ctx, "example.com"); err != nil {
+		t.Fatalf("Prune failed: %v", err)
+	}
+	if backups, _ = store.ListBackups(ctx, "example.com"); len(backups) != 3 {
+		t.Errorf("Expected 3 backups within MaxAge, got %d", len(backups))
+	}
+
+	// Saving prunes as well
+	store.Keep = 2
+	if _, err := store.SaveBackup(ctx, Backup{Zone: "example.com", CreatedAt: now.Add(time.Second), Operation: OperationDelete, Snapshot: snapshot}); err != nil {
+		t.Fatalf("SaveBackup failed: %v", err)
+	}
+	backups, _ = store.ListBackups(ctx, "example.com")
+	if len(backups) != 2 || backups[0].Operation != OperationDelete {
+		t.Errorf("Expected the 2 newest backups, got %+v", backups)
+	}
+}
+
+func TestFileBackupStoreRejectsPaths(t *testing.T) {
+	ctx := context.Background()
+	store := &FileBackupStore{Dir: t.TempDir()}
+
+	if _, err := store.SaveBackup(ctx, Backup{Zone: "../etc"}); err == nil {
+		t.Error("Expected an invalid zone name to be rejected")
+	}
+	if _, err := store.LoadBackup(ctx, "example.com", "../../secret"); err == nil {
+		t.Error("Expected an invalid backup id to be rejected")
+	}
+}
@@ -0,0 +1,185 @@
+// Package autodns registers the AutoDNS provider as the Caddy module
+// dns.providers.autodns, so it can solve ACME DNS-01 challenges:
+//
+//	xcaddy build --with github.com/saveenergy/libdns-autodns/caddy
+package autodns
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	libdnsautodns "github.com/saveenergy/libdns-autodns"
+)
+
+// Provider lets Caddy read and manipulate DNS records hosted by AutoDNS.
+// Besides the fields of the embedded provider, its JSON config accepts
+// files for the credentials, a backup directory and an audit log.
+type Provider struct {
+	*libdnsautodns.Provider
+
+	// UsernameFile holds the username, e.g. a mounted secret (optional)
+	UsernameFile string `json:"username_file,omitempty"`
+	// PasswordFile holds the password and is re-read when it changes (optional)
+	PasswordFile string `json:"password_file,omitempty"`
+	// BackupDir stores a backup of every zone before it is updated (optional)
+	BackupDir string `json:"backup_dir,omitempty"`
+	// AuditLog appends a JSON line for every zone update (optional)
+	AuditLog string `json:"audit_log,omitempty"`
+}
+
+func init() {
+	caddy.RegisterModule(Provider{})
+}
+
+// CaddyModule returns the Caddy module information.
+func (Provider) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "dns.providers.autodns",
+		New: func() caddy.Module { return &Provider{Provider: new(libdnsautodns.Provider)} },
+	}
+}
+
+// Provision replaces placeholders such as {env.AUTODNS_PASSWORD} in the
+// configuration and sets up logging, credential files, backups and the
+// audit log.
+func (p *Provider) Provision(ctx caddy.Context) error {
+	repl := caddy.NewReplacer()
+	for _, field := range []*string{
+		&p.Username, &p.Password, &p.Context, &p.Endpoint,
+		&p.UsernameFile, &p.PasswordFile, &p.BackupDir, &p.AuditLog,
+	} {
+		*field = repl.ReplaceAll(*field, "")
+	}
+
+	p.Logger = ctx.Slogger()
+	if p.PasswordFile != "" {
+		if p.Password != "" {
+			return fmt.Errorf("both password and password_file are set")
+		}
+		p.CredentialSource = &libdnsautodns.FileCredentials{
+			Username:     p.Username,
+			UsernameFile: p.UsernameFile,
+			PasswordFile: p.PasswordFile,
+		}
+	} else if p.UsernameFile != "" {
+		return fmt.Errorf("username_file requires password_file")
+	}
+	if p.BackupDir != "" {
+		p.BackupStore = &libdnsautodns.FileBackupStore{Dir: p.BackupDir}
+	}
+	if p.AuditLog != "" {
+		p.AuditSink = &libdnsautodns.JSONLinesAuditSink{Path: p.AuditLog}
+	}
+	return nil
+}
+
+// Validate checks the provisioned configuration.
+func (p *Provider) Validate() error {
+	if err := p.Provider.Validate(); err != nil {
+		return fmt.Errorf("autodns: %w", err)
+	}
+	return nil
+}
+
+// UnmarshalCaddyfile sets up the DNS provider from Caddyfile tokens. Syntax:
+//
+//	autodns [<username> <password>] {
+//	    username      <username>
+//	    password      <password>
+//	    username_file <path>
+//	    password_file <path>
+//	    context       <1|4>
+//	    endpoint      <url>
+//	    dry_run       [true|false]
+//	    max_retries   <n>
+//	    backup_dir    <path>
+//	    audit_log     <path>
+//	}
+func (p *Provider) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	d.Next() // consume the provider name
+
+	if d.NextArg() {
+		p.Username = d.Val()
+		if !d.NextArg() {
+			return d.ArgErr()
+		}
+		p.Password = d.Val()
+	}
+	if d.NextArg() {
+		return d.ArgErr()
+	}
+
+	for nesting := d.Nesting(); d.NextBlock(nesting); {
+		option := d.Val()
+		if option == "dry_run" {
+			p.DryRun = true
+			if d.NextArg() {
+				value, err := strconv.ParseBool(d.Val())
+				if err != nil {
+					return d.Errf("invalid dry_run value %q", d.Val())
+				}
+				p.DryRun = value
+			}
+			if d.NextArg() {
+				return d.ArgErr()
+			}
+			continue
+		}
+		if option == "max_retries" {
+			if !d.NextArg() {
+				return d.ArgErr()
+			}
+			value, err := strconv.Atoi(d.Val())
+			if err != nil {
+				return d.Errf("invalid max_retries value %q", d.Val())
+			}
+			p.MaxRetries = value
+			if d.NextArg() {
+				return d.ArgErr()
+			}
+			continue
+		}
+
+		var dest *string
+		switch option {
+		case "username":
+			dest = &p.Username
+		case "password":
+			dest = &p.Password
+		case "username_file":
+			dest = &p.UsernameFile
+		case "password_file":
+			dest = &p.PasswordFile
+		case "context":
+			dest = &p.Context
+		case "endpoint":
+			dest = &p.Endpoint
+		case "backup_dir":
+			dest = &p.BackupDir
+		case "audit_log":
+			dest = &p.AuditLog
+		default:
+			return d.Errf("unrecognized subdirective %q", option)
+		}
+		if *dest != "" {
+			return d.Errf("%s already set", option)
+		}
+		if !d.NextArg() {
+			return d.ArgErr()
+		}
+		*dest = d.Val()
+		if d.NextArg() {
+			return d.ArgErr()
+		}
+	}
+	return nil
+}
+
+// Interface guards
+var (
+	_ caddyfile.Unmarshaler = (*Provider)(nil)
+	_ caddy.Provisioner     = (*Provider)(nil)
+	_ caddy.Validator       = (*Provider)(nil)
+)
@@ -0,0 +1,144 @@
+package autodns
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	libdnsautodns "github.com/saveenergy/libdns-autodns"
+)
+
+func newProvider() *Provider {
+	return Provider{}.CaddyModule().New().(*Provider)
+}
+
+func provision(t *testing.T, p *Provider) error {
+	t.Helper()
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	t.Cleanup(cancel)
+	if err := p.Provision(ctx); err != nil {
+		return err
+	}
+	return p.Validate()
+}
+
+func TestUnmarshalCaddyfile(t *testing.T) {
+	p := newProvider()
+	d := caddyfile.NewTestDispenser(`autodns {
+		username api-user
+		password {env.AUTODNS_TEST_PASSWORD}
+		context 1
+		endpoint https://api.demo.autodns.com/v1
+		dry_run
+		max_retries 5
+		backup_dir /var/lib/caddy/autodns-backups
+		audit_log /var/log/caddy/autodns-audit.jsonl
+	}`)
+	if err := p.UnmarshalCaddyfile(d); err != nil {
+		t.Fatalf("UnmarshalCaddyfile failed: %v", err)
+	}
+
+	t.Setenv("AUTODNS_TEST_PASSWORD", "secret")
+	if err := provision(t, p); err != nil {
+		t.Fatalf("Provision failed: %v", err)
+	}
+	if p.Username != "api-user" || p.Password != "secret" || p.Context != "1" ||
+		p.Endpoint != "https://api.demo.autodns.com/v1" || !p.DryRun || p.MaxRetries != 5 {
+		t.Errorf("Unexpected configuration: %+v", p.Provider)
+	}
+	if store, ok := p.BackupStore.(*libdnsautodns.FileBackupStore); !ok || store.Dir != "/var/lib/caddy/autodns-backups" {
+		t.Errorf("Expected a file backup store, got %#v", p.BackupStore)
+	}
+	if sink, ok := p.AuditSink.(*libdnsautodns.JSONLinesAuditSink); !ok || sink.Path != "/var/log/caddy/autodns-audit.jsonl" {
+		t.Errorf("Expected a JSON lines audit sink, got %#v", p.AuditSink)
+	}
+	if p.Logger == nil {
+		t.Error("Expected the Caddy logger to be used")
+	}
+}
+
+func TestUnmarshalCaddyfileShortForm(t *testing.T) {
+	p := newProvider()
+	if err := p.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`autodns api-user secret`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := provision(t, p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Username != "api-user" || p.Password != "secret" || p.Context != "4" {
+		t.Errorf("Unexpected configuration: %+v", p.Provider)
+	}
+}
+
+func TestUnmarshalCaddyfileErrors(t *testing.T) {
+	for _, input := range []string{
+		`autodns api-user`,
+		`autodns a b c`,
+		"autodns {\n username\n}",
+		"autodns {\n username a b\n}",
+		"autodns {\n username a\n username b\n}",
+		"autodns {\n dry_run maybe\n}",
+		"autodns {\n max_retries\n}",
+		"autodns {\n max_retries many\n}",
+		"autodns {\n ttl 60\n}",
+	} {
+		if err := newProvider().UnmarshalCaddyfile(caddyfile.NewTestDispenser(input)); err == nil {
+			t.Errorf("Expected an error for %q", input)
+		}
+	}
+}
+
+func TestProvisionErrors(t *testing.T) {
+	for _, tc := range []struct {
+		config string
+		want   string
+	}{
+		{`{"username": "user"}`, "password is required"},
+		{`{"username": "user", "password": "secret", "context": "live"}`, "invalid context"},
+		{`{"username": "user", "password": "secret", "password_file": "/run/secrets/autodns"}`, "both password and password_file"},
+		{`{"username_file": "/run/secrets/user"}`, "username_file requires password_file"},
+	} {
+		p := newProvider()
+		if err := json.Unmarshal([]byte(tc.config), p); err != nil {
+			t.Fatal(err)
+		}
+		if err := provision(t, p); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: expected %q, got %v", tc.config, tc.want, err)
+		}
+	}
+}
+
+func TestJSONConfig(t *testing.T) {
+	dir := t.TempDir()
+	config := `{
+		"username": "api-user",
+		"password_file": "` + filepath.Join(dir, "password") + `",
+		"context": "4",
+		"dry_run": true,
+		"max_retries": -1
+	}`
+	p := newProvider()
+	if err := json.Unmarshal([]byte(config), p); err != nil {
+		t.Fatal(err)
+	}
+	if err := provision(t, p); err != nil {
+		t.Fatalf("Provision failed: %v", err)
+	}
+	source, ok := p.CredentialSource.(*libdnsautodns.FileCredentials)
+	if !ok || source.Username != "api-user" || source.PasswordFile != filepath.Join(dir, "password") || !p.DryRun || p.MaxRetries != -1 {
+		t.Errorf("Unexpected configuration: %+v, %#v", p.Provider, p.CredentialSource)
+	}
+
+	// The password read from the file is not copied into the config
+	out, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), `"password_file"`) || strings.Contains(string(out), `"password":`) {
+		t.Errorf("Unexpected JSON %s", out)
+	}
+}
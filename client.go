@@ -8,7 +8,9 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/libdns/libdns"
@@ -18,6 +20,13 @@ const (
 	userAgent = "libdns-autodns/1.0.6"
 )
 
+// cachedZone is a zone cache entry along with the STID of the request that
+// fetched it
+type cachedZone struct {
+	zone Zone
+	stid string
+}
+
 // getZone retrieves a zone from the AutoDNS API
 func (p *Provider) getZone(ctx context.Context, zoneName string) (Zone, error) {
 	p.zonesMutex.Lock()
@@ -25,12 +34,20 @@ func (p *Provider) getZone(ctx context.Context, zoneName string) (Zone, error) {
 
 	// Initialize cache if needed
 	if p.zones == nil {
-		p.zones = make(map[string]Zone)
+		p.zones = make(map[string]cachedZone)
 	}
 
 	// Check cache first
-	if zone, ok := p.zones[zoneName]; ok {
-		return zone, nil
+	if cached, ok := p.zones[zoneName]; ok {
+		p.logger().DebugContext(ctx, "zone cache hit", "zone", zoneName, "records", len(cached.zone.ResourceRecords))
+		if p.Observer != nil {
+			p.Observer.ObserveZoneCache(zoneName, true)
+		}
+		return cached.zone, nil
+	}
+	p.logger().DebugContext(ctx, "zone cache miss", "zone", zoneName)
+	if p.Observer != nil {
+		p.Observer.ObserveZoneCache(zoneName, false)
 	}
 
 	// Make API call to get zone
@@ -42,7 +59,7 @@ func (p *Provider) getZone(ctx context.Context, zoneName string) (Zone, error) {
 
 	// Try to get the zone - the API might return an array or a single object
 	var zones []Zone
-	_, err = p.sendAPIRequest(req, &zones)
+	resp, err := p.sendAPIRequest(req, &zones)
 	if err != nil {
 		return Zone{}, fmt.Errorf("failed to get zone %s: %v", zoneName, err)
 	}
@@ -55,13 +72,79 @@ func (p *Provider) getZone(ctx context.Context, zoneName string) (Zone, error) {
 		return Zone{}, fmt.Errorf("no zones found for %s", zoneName)
 	}
 
+	p.logger().DebugContext(ctx, "zone fetched", "zone", zoneName, "records", len(zone.ResourceRecords), "stid", resp.STID)
+
 	// Cache the zone
-	p.zones[zoneName] = zone
+	p.zones[zoneName] = cachedZone{zone: zone, stid: resp.STID}
 	return zone, nil
 }
 
-// setZone updates a zone via the AutoDNS API
-func (p *Provider) setZone(ctx context.Context, zoneName string, zoneData Zone) error {
+// lockZone serializes updates of a zone within this Provider, so that
+// concurrent calls do not overwrite each other's changes. The returned
+// function releases the lock.
+func (p *Provider) lockZone(zoneName string) func() {
+	key := strings.ToLower(strings.TrimSuffix(zoneName, "."))
+
+	p.zoneLocksMutex.Lock()
+	if p.zoneLocks == nil {
+		p.zoneLocks = make(map[string]*sync.Mutex)
+	}
+	lock, ok := p.zoneLocks[key]
+	if !ok {
+		lock = &sync.Mutex{}
+		p.zoneLocks[key] = lock
+	}
+	p.zoneLocksMutex.Unlock()
+
+	lock.Lock()
+	return lock.Unlock
+}
+
+// zoneSTID returns the STID of the request that fetched the cached zone
+func (p *Provider) zoneSTID(zoneName string) string {
+	p.zonesMutex.Lock()
+	defer p.zonesMutex.Unlock()
+	return p.zones[zoneName].stid
+}
+
+// zoneSearchPageSize is the number of zones requested per search page
+const zoneSearchPageSize = 1000
+
+// listZones returns all zones of the account, following the pages of the
+// zone search
+func (p *Provider) listZones(ctx context.Context) ([]Zone, error) {
+	reqURL := fmt.Sprintf("%s/zone/_search", p.Endpoint)
+
+	var zones []Zone
+	for offset := 0; ; offset += zoneSearchPageSize {
+		query := map[string]any{
+			"view": map[string]int{"limit": zoneSearchPageSize, "offset": offset},
+		}
+		jsonData, err := json.Marshal(query)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal zone search: %v", err)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, reqURL, bytes.NewBuffer(jsonData))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %v", err)
+		}
+
+		var page []Zone
+		if _, err := p.sendAPIRequest(req, &page); err != nil {
+			return nil, err
+		}
+		zones = append(zones, page...)
+
+		if len(page) < zoneSearchPageSize {
+			return zones, nil
+		}
+	}
+}
+
+// setZone updates a zone via the AutoDNS API. It returns the STID of the
+// update and the user it was made with.
+func (p *Provider) setZone(ctx context.Context, zoneName string, zoneData Zone) (stid, username string, err error) {
 	reqURL := fmt.Sprintf("%s/zone/%s", p.Endpoint, zoneName)
 
 	// Create zone data for API with only the fields we need
@@ -79,19 +162,24 @@ func (p *Provider) setZone(ctx context.Context, zoneName string, zoneData Zone)
 
 	jsonData, err := json.Marshal(zoneUpdate)
 	if err != nil {
-		return fmt.Errorf("failed to marshal zone data: %v", err)
+		return "", "", fmt.Errorf("failed to marshal zone data: %v", err)
 	}
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPut, reqURL, bytes.NewBuffer(jsonData))
 	if err != nil {
-		return fmt.Errorf("failed to create request: %v", err)
+		return "", "", fmt.Errorf("failed to create request: %v", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
 
-	_, err = p.sendAPIRequest(req, nil)
+	resp, err := p.sendAPIRequest(req, nil)
 	if err != nil {
-		return fmt.Errorf("failed to update zone %s: %v", zoneName, err)
+		p.logger().ErrorContext(ctx, "zone update failed", "zone", zoneName, "records", len(zoneUpdate.ResourceRecords), "stid", resp.STID, "error", err)
+		return "", "", fmt.Errorf("failed to update zone %s: %v", zoneName, err)
+	}
+	p.logger().InfoContext(ctx, "zone updated", "zone", zoneName, "records", len(zoneUpdate.ResourceRecords), "stid", resp.STID)
+	if p.Observer != nil {
+		p.Observer.ObserveZoneUpdate(zoneName, time.Now())
 	}
 
 	// Clear cache after update to ensure fresh data
@@ -99,17 +187,155 @@ func (p *Provider) setZone(ctx context.Context, zoneName string, zoneData Zone)
 	delete(p.zones, zoneName)
 	p.zonesMutex.Unlock()
 
-	return nil
+	// sendAPIRequest authenticated the request with the current credentials
+	username, _, _ = req.BasicAuth()
+	return resp.STID, username, nil
 }
 
-// sendAPIRequest handles the HTTP request/response cycle with proper error handling
+// updateZone writes target as the new state of a zone. It computes the
+// record change set against the current zone and only writes the zone if
+// the records or zone settings changed and the call is not a dry run. With a
+// BackupStore, the current zone is saved before it is overwritten, and a
+// successful write is reported to the AuditSink.
+func (p *Provider) updateZone(ctx context.Context, zoneName string, operation Operation, current, target Zone) (ChangeSet, error) {
+	changes := diffResourceRecords(zoneName, current.ResourceRecords, target.ResourceRecords)
+	reportChanges(ctx, changes)
+
+	if p.isDryRun(ctx) {
+		p.logger().InfoContext(ctx, "dry run: zone not updated", "zone", zoneName, "operation", operation,
+			"adds", len(changes.Adds), "removes", len(changes.Removes), "modifications", len(changes.Modifications))
+		return changes, nil
+	}
+	settings := zoneSettingChanges(current, target)
+	if changes.Empty() && len(settings) == 0 {
+		p.logger().DebugContext(ctx, "zone unchanged", "zone", zoneName, "operation", operation)
+		return changes, nil
+	}
+
+	if err := p.backupZone(ctx, zoneName, operation, current); err != nil {
+		return ChangeSet{}, err
+	}
+	stid, username, err := p.setZone(ctx, zoneName, target)
+	if err != nil {
+		return ChangeSet{}, err
+	}
+	p.audit(ctx, AuditEntry{
+		Zone:      zoneName,
+		Operation: operation,
+		Changes:   changes,
+		Settings:  settings,
+		STID:      stid,
+		Username:  username,
+	})
+	return changes, nil
+}
+
+// withRecords returns a copy of zoneData with its resource records replaced
+func withRecords(zoneData Zone, records []ResourceRecord) Zone {
+	zoneData.ResourceRecords = records
+	return zoneData
+}
+
+// Retry limits for requests that AutoDNS answers with 429 Too Many Requests
+// or 503 Service Unavailable
+const (
+	defaultMaxRetries = 3
+	retryBaseDelay    = time.Second
+	maxRetryDelay     = time.Minute
+)
+
+// sendAPIRequest handles the HTTP request/response cycle with proper error
+// handling. Rate limited and unavailable responses are retried up to
+// MaxRetries times, waiting as long as their Retry-After header asks for.
 func (p *Provider) sendAPIRequest(req *http.Request, data any) (JsonResponse, error) {
-	// Set authentication header
+	// Set authentication header once, so every attempt uses the same user
 	if req.Header.Get("Authorization") == "" {
-		auth := fmt.Sprintf("Basic %s", base64.StdEncoding.EncodeToString([]byte(p.Username+":"+p.Password)))
+		creds, err := p.credentials(req.Context())
+		if err != nil {
+			return JsonResponse{}, err
+		}
+		auth := fmt.Sprintf("Basic %s", base64.StdEncoding.EncodeToString([]byte(creds.Username+":"+creds.Password)))
 		req.Header.Set("Authorization", auth)
 	}
 
+	for attempt := 1; ; attempt++ {
+		result, status, header, err := p.sendAPIRequestOnce(req, data)
+		if !retryableStatus(status) || attempt > p.maxRetries() || (req.Body != nil && req.GetBody == nil) {
+			return result, err
+		}
+
+		wait := retryDelay(header, attempt)
+		p.logAPIRetry(req, status, attempt, wait)
+		p.recordRetry(req, status, wait)
+		p.observeRetry(req, status, attempt, wait)
+
+		waitStart := time.Now()
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			err = fmt.Errorf("%v (retry canceled: %v)", err, req.Context().Err())
+		case <-timer.C:
+			err = nil
+		}
+		if status == http.StatusTooManyRequests {
+			p.observeRateLimitWait(req, time.Since(waitStart))
+		}
+		if err != nil {
+			return result, err
+		}
+
+		// The previous attempt consumed the body
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return JsonResponse{}, fmt.Errorf("failed to rewind request body: %v", err)
+			}
+			req.Body = body
+		}
+	}
+}
+
+// maxRetries returns the configured retry limit
+func (p *Provider) maxRetries() int {
+	if p.MaxRetries == 0 {
+		return defaultMaxRetries
+	}
+	return max(p.MaxRetries, 0)
+}
+
+// retryableStatus reports whether a response status is worth retrying
+func retryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable
+}
+
+// retryDelay returns how long to wait before the given retry: the
+// Retry-After header if the response has one, and an exponential backoff
+// otherwise, capped at maxRetryDelay
+func retryDelay(header http.Header, attempt int) time.Duration {
+	delay := retryBaseDelay << (attempt - 1)
+	if value := header.Get("Retry-After"); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+			delay = time.Duration(seconds) * time.Second
+		} else if at, err := http.ParseTime(value); err == nil {
+			delay = max(time.Until(at), 0)
+		}
+	}
+	return min(delay, maxRetryDelay)
+}
+
+// sendAPIRequestOnce makes a single attempt of an API request. It returns
+// the HTTP status and headers along with the result, so the caller can
+// decide whether to retry.
+func (p *Provider) sendAPIRequestOnce(req *http.Request, data any) (result JsonResponse, status int, header http.Header, err error) {
+	req, endSpan := p.startRequestSpan(req)
+	start := time.Now()
+	defer func() {
+		endSpan(status, result.STID, err)
+		p.logAPIRequest(req, status, result.STID, time.Since(start), err)
+		p.observeRequest(req, status, result.STID, time.Since(start), err)
+	}()
+
 	// Set AutoDNS context header
 	if req.Header.Get("X-Domainrobot-Context") == "" {
 		req.Header.Set("X-Domainrobot-Context", p.Context)
@@ -126,89 +352,122 @@ func (p *Provider) sendAPIRequest(req *http.Request, data any) (JsonResponse, er
 		Timeout: 30 * time.Second,
 	}
 
+	p.debugRequest(req)
 	resp, err := client.Do(req)
 	if err != nil {
-		return JsonResponse{}, fmt.Errorf("request failed: %v", err)
+		return JsonResponse{}, 0, nil, fmt.Errorf("request failed: %v", err)
 	}
 	defer resp.Body.Close()
+	status, header = resp.StatusCode, resp.Header
 
 	// Read the response body
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return JsonResponse{}, fmt.Errorf("failed to read response body: %v", err)
+		return JsonResponse{}, status, header, fmt.Errorf("failed to read response body: %v", err)
 	}
+	p.debugResponse(resp, body, time.Since(start))
 
 	// Try to parse as JsonResponse first
 	var respData JsonResponse
 	if err := json.Unmarshal(body, &respData); err == nil {
 		// Successfully parsed as JsonResponse
 		// Check for HTTP errors
+		// The response is returned alongside errors so the STID can be logged
 		if resp.StatusCode >= 400 {
-			return JsonResponse{}, fmt.Errorf("HTTP %d: %s - %s", resp.StatusCode, respData.Status.Code, respData.Status.Text)
+			return respData, status, header, fmt.Errorf("HTTP %d: %s - %s", resp.StatusCode, respData.Status.Code, respData.Status.Text)
 		}
 
 		// Check for API errors
 		if respData.Status.Type == "ERROR" {
-			return JsonResponse{}, fmt.Errorf("API error: %s - %s", respData.Status.Code, respData.Status.Text)
+			return respData, status, header, fmt.Errorf("API error: %s - %s", respData.Status.Code, respData.Status.Text)
 		}
 
 		// Decode data if requested
 		if len(respData.Data) > 0 && data != nil {
 			if err := json.Unmarshal(respData.Data, data); err != nil {
-				return JsonResponse{}, fmt.Errorf("failed to decode response data: %v", err)
+				return JsonResponse{}, status, header, fmt.Errorf("failed to decode response data: %v", err)
 			}
 		}
-		return respData, nil
+		return respData, status, header, nil
+	}
+
+	// Error responses without a JSON body, e.g. from a proxy
+	if resp.StatusCode >= 400 {
+		return JsonResponse{}, status, header, fmt.Errorf("HTTP %d: %s", resp.StatusCode, http.StatusText(resp.StatusCode))
 	}
 
 	// If not a JsonResponse, try to parse directly as the expected data type
 	if data != nil {
 		if err := json.Unmarshal(body, data); err != nil {
-			return JsonResponse{}, fmt.Errorf("failed to decode response as %T: %v", data, err)
+			return JsonResponse{}, status, header, fmt.Errorf("failed to decode response as %T: %v", data, err)
 		}
 	}
 
 	// Return empty response for direct data responses
-	return JsonResponse{}, nil
+	return JsonResponse{}, status, header, nil
+}
+
+// convertRecords converts libdns records to AutoDNS resource records. With
+// validate set, record values are also checked, so an invalid batch is
+// rejected before any API call.
+func (p *Provider) convertRecords(ctx context.Context, zoneName string, records []libdns.Record, validate bool) ([]ResourceRecord, error) {
+	var resourceRecords []ResourceRecord
+	for _, record := range records {
+		rr, err := libdnsRecordToResourceRecord(record, zoneName)
+		if err == nil && validate {
+			err = validateResourceRecord(rr)
+		}
+		if err != nil {
+			p.logger().WarnContext(ctx, "rejecting record batch", "zone", zoneName, "records", len(records), "error", err)
+			return nil, err
+		}
+		resourceRecords = append(resourceRecords, rr)
+	}
+	return resourceRecords, nil
 }
 
 // addRecords adds records to a zone
 func (p *Provider) addRecords(ctx context.Context, zoneName string, records []libdns.Record) error {
+	// Convert and validate before touching the zone
+	newRecords, err := p.convertRecords(ctx, zoneName, records, true)
+	if err != nil {
+		return err
+	}
+
+	unlock := p.lockZone(zoneName)
+	defer unlock()
+
 	// Get the current zone
 	zoneData, err := p.getZone(ctx, zoneName)
 	if err != nil {
 		return fmt.Errorf("failed to get zone %s: %v", zoneName, err)
 	}
 
-	// Convert libdns records to AutoDNS resource records
-	var newRecords []ResourceRecord
-	for _, record := range records {
-		rr := libdnsRecordToResourceRecord(record, zoneName)
-		newRecords = append(newRecords, rr)
-	}
-
 	// Add new records to existing ones (preserve existing records)
-	zoneData.ResourceRecords = append(zoneData.ResourceRecords, newRecords...)
+	resourceRecords := append(append([]ResourceRecord(nil), zoneData.ResourceRecords...), newRecords...)
 
 	// Update the zone
-	return p.setZone(ctx, zoneName, zoneData)
+	_, err = p.updateZone(ctx, zoneName, OperationAppend, zoneData, withRecords(zoneData, resourceRecords))
+	return err
 }
 
 // setRecords updates existing records or creates new ones, preserving other records
 func (p *Provider) setRecords(ctx context.Context, zoneName string, records []libdns.Record) error {
+	// Convert and validate before touching the zone
+	newRecords, err := p.convertRecords(ctx, zoneName, records, true)
+	if err != nil {
+		return err
+	}
+
+	unlock := p.lockZone(zoneName)
+	defer unlock()
+
 	// Get the current zone
 	zoneData, err := p.getZone(ctx, zoneName)
 	if err != nil {
 		return fmt.Errorf("failed to get zone %s: %v", zoneName, err)
 	}
 
-	// Convert new records to AutoDNS format
-	var newRecords []ResourceRecord
-	for _, record := range records {
-		rr := libdnsRecordToResourceRecord(record, zoneName)
-		newRecords = append(newRecords, rr)
-	}
-
 	// Create a set of type/name combinations to replace
 	recordsToReplace := make(map[string]bool)
 	for _, rr := range newRecords {
@@ -234,14 +493,25 @@ func (p *Provider) setRecords(ctx context.Context, zoneName string, records []li
 	}
 
 	// Combine preserved records with new records
-	zoneData.ResourceRecords = append(preservedRecords, newRecords...)
+	resourceRecords := append(preservedRecords, newRecords...)
 
 	// Update the zone
-	return p.setZone(ctx, zoneName, zoneData)
+	_, err = p.updateZone(ctx, zoneName, OperationSet, zoneData, withRecords(zoneData, resourceRecords))
+	return err
 }
 
 // deleteRecords removes specific records from a zone
 func (p *Provider) deleteRecords(ctx context.Context, zoneName string, records []libdns.Record) error {
+	// Convert before touching the zone. Values are not validated, so that
+	// malformed records AutoDNS already holds can still be deleted.
+	oldRecords, err := p.convertRecords(ctx, zoneName, records, false)
+	if err != nil {
+		return err
+	}
+
+	unlock := p.lockZone(zoneName)
+	defer unlock()
+
 	// Get the current zone
 	zoneData, err := p.getZone(ctx, zoneName)
 	if err != nil {
@@ -250,8 +520,7 @@ func (p *Provider) deleteRecords(ctx context.Context, zoneName string, records [
 
 	// Create a map of records to delete for efficient lookup
 	recordsToDelete := make(map[string]bool)
-	for _, record := range records {
-		rr := libdnsRecordToResourceRecord(record, zoneName)
+	for _, rr := range oldRecords {
 		// Use a more specific key that includes part of the value to avoid false matches
 		key := fmt.Sprintf("%s:%s:%s", rr.Type, rr.Name, rr.Value)
 		recordsToDelete[key] = true
@@ -270,8 +539,8 @@ func (p *Provider) deleteRecords(ctx context.Context, zoneName string, records [
 			remainingRecords = append(remainingRecords, rr)
 		}
 	}
-	zoneData.ResourceRecords = remainingRecords
 
 	// Update the zone
-	return p.setZone(ctx, zoneName, zoneData)
+	_, err = p.updateZone(ctx, zoneName, OperationDelete, zoneData, withRecords(zoneData, remainingRecords))
+	return err
 }
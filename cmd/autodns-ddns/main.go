@@ -0,0 +1,184 @@
+// Command autodns-ddns keeps A and AAAA records pointed at the public
+// address of a site with a dynamic IP.
+//
+// Usage:
+//
+//	autodns-ddns [flags] <zone> <name>...
+//	autodns-ddns -listen <addr> -hosts <file> [flags]
+//
+// Every -interval, the public IPv4 and IPv6 addresses are detected and the
+// A and AAAA records of the names are set when an address changed. The
+// detectors are selected with -ipv4 and -ipv6:
+//
+//	none                  do not manage records of this family
+//	http[:<url>]          ask an echo service, api64.ipify.org by default
+//	interface:<name>      use the public address of a network interface
+//	upnp[:<url>]          ask the router via UPnP (IPv4 only); the device
+//	                      description URL is discovered if not given
+//
+// With -listen, the command instead serves the DynDNS2 update protocol
+// (/nic/update) for routers such as FritzBox and OpenWrt. The hostnames
+// that can be updated and their credentials are read from the YAML or JSON
+// file given with -hosts (see ddns.LoadHosts):
+//
+//	autodns-ddns -listen :8080 -hosts hosts.yaml
+//
+// The provider is configured from the AUTODNS_* environment variables (see
+// autodns.NewFromEnv) or from the file given with -config (see
+// autodns.NewFromConfigFile).
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	autodns "github.com/saveenergy/libdns-autodns"
+	"github.com/saveenergy/libdns-autodns/ddns"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err := run(ctx, os.Args[1:], os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(2)
+	}
+	if err != nil && !errors.Is(err, context.Canceled) {
+		fmt.Fprintln(os.Stderr, "autodns-ddns:", err)
+		os.Exit(1)
+	}
+}
+
+// run executes the command line args. It is separate from main so that the
+// daemon can be tested without a process.
+func run(ctx context.Context, args []string, stderr io.Writer) error {
+	updater := &ddns.Updater{}
+	var config, ipv4, ipv6, listen, hostsFile string
+	var once, trustProxy, verbose bool
+
+	fs := flag.NewFlagSet("autodns-ddns", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&config, "config", "", "JSON, YAML or TOML config `file` instead of the AUTODNS_* environment")
+	fs.StringVar(&ipv4, "ipv4", "http", "IPv4 `detector`: none, http[:url], interface:name or upnp[:url]")
+	fs.StringVar(&ipv6, "ipv6", "none", "IPv6 `detector`: none, http[:url] or interface:name")
+	fs.DurationVar(&updater.TTL, "ttl", ddns.DefaultTTL, "TTL of the records")
+	fs.DurationVar(&updater.Interval, "interval", ddns.DefaultInterval, "time between checks")
+	fs.DurationVar(&updater.MaxBackoff, "max-backoff", ddns.DefaultMaxBackoff, "longest retry delay after failures")
+	fs.StringVar(&updater.StateFile, "state", "", "`file` keeping the published addresses across restarts")
+	fs.StringVar(&listen, "listen", "", "serve DynDNS2 updates on this `address` instead of detecting addresses")
+	fs.StringVar(&hostsFile, "hosts", "", "YAML or JSON `file` with the hostnames and credentials for -listen")
+	fs.BoolVar(&trustProxy, "trust-proxy", false, "take the client address from X-Forwarded-For in -listen mode")
+	fs.BoolVar(&once, "once", false, "check once and exit")
+	fs.BoolVar(&verbose, "verbose", false, "log debug messages")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: autodns-ddns [flags] <zone> <name>...")
+		fmt.Fprintln(stderr, "       autodns-ddns -listen <addr> -hosts <file> [flags]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if (listen == "" && fs.NArg() < 2) || (listen != "" && (fs.NArg() > 0 || hostsFile == "")) {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	var err error
+	if config != "" {
+		updater.Provider, err = autodns.NewFromConfigFile(config)
+	} else {
+		updater.Provider, err = autodns.NewFromEnv()
+	}
+	if err != nil {
+		return err
+	}
+
+	level := slog.LevelInfo
+	if verbose {
+		level = slog.LevelDebug
+	}
+	logger := slog.New(slog.NewTextHandler(stderr, &slog.HandlerOptions{Level: level}))
+	updater.Provider.Logger = logger
+
+	if listen != "" {
+		hosts, err := ddns.LoadHosts(hostsFile)
+		if err != nil {
+			return err
+		}
+		return serve(ctx, listen, &ddns.DynDNS2Handler{
+			Provider:   updater.Provider,
+			Hosts:      hosts,
+			TrustProxy: trustProxy,
+			Logger:     logger,
+		})
+	}
+
+	updater.Zone, updater.Names = fs.Arg(0), fs.Args()[1:]
+	updater.Logger = logger
+	if updater.IPv4, err = parseDetector(ipv4); err != nil {
+		return fmt.Errorf("-ipv4: %v", err)
+	}
+	if updater.IPv6, err = parseDetector(ipv6); err != nil {
+		return fmt.Errorf("-ipv6: %v", err)
+	}
+	if updater.IPv4 == nil && updater.IPv6 == nil {
+		return fmt.Errorf("-ipv4 and -ipv6 are both none")
+	}
+
+	if once {
+		_, err := updater.Update(ctx)
+		return err
+	}
+	return updater.Run(ctx)
+}
+
+// serve runs the DynDNS2 endpoint until ctx is done
+func serve(ctx context.Context, addr string, handler http.Handler) error {
+	mux := http.NewServeMux()
+	mux.Handle("/nic/update", handler)
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	errc := make(chan error, 1)
+	go func() { errc <- server.ListenAndServe() }()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+		return ctx.Err()
+	}
+}
+
+// parseDetector returns the detector for a -ipv4 or -ipv6 value, or nil for
+// "none"
+func parseDetector(spec string) (ddns.Detector, error) {
+	kind, arg, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "none":
+		return nil, nil
+	case "http":
+		return ddns.HTTPDetector{URL: arg}, nil
+	case "interface":
+		if arg == "" {
+			return nil, fmt.Errorf("interface name is required")
+		}
+		return ddns.InterfaceDetector{Name: arg}, nil
+	case "upnp":
+		return ddns.UPnPDetector{Location: arg}, nil
+	default:
+		return nil, fmt.Errorf("unknown detector %q", spec)
+	}
+}
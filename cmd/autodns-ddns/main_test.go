@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	autodns "github.com/saveenergy/libdns-autodns"
+	"github.com/saveenergy/libdns-autodns/ddns"
+	"github.com/saveenergy/libdns-autodns/internal/autodnstest"
+)
+
+// testZone returns the zone served by the fake API
+func testZone() autodns.Zone {
+	return autodns.Zone{
+		Origin: "example.com",
+		SOA:    &autodns.SOA{TTL: 86400, Email: "hostmaster@example.com"},
+	}
+}
+
+func TestRunOnce(t *testing.T) {
+	api := autodnstest.SetEnv(t, testZone())
+
+	echo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "198.51.100.7")
+	}))
+	defer echo.Close()
+
+	var stderr bytes.Buffer
+	state := filepath.Join(t.TempDir(), "state.json")
+	err := run(context.Background(), []string{"-once", "-ipv4", "http:" + echo.URL, "-ttl", "1m", "-state", state, "example.com", "office", "vpn"}, &stderr)
+	if err != nil {
+		t.Fatalf("run failed: %v\n%s", err, stderr.String())
+	}
+
+	records := api.Zone("example.com").ResourceRecords
+	if len(records) != 2 || records[0].Value != "198.51.100.7" || records[0].TTL != 60 {
+		t.Errorf("Expected two A records, got %+v", records)
+	}
+	if !strings.Contains(stderr.String(), "address changed") {
+		t.Errorf("Expected the change to be logged, got:\n%s", stderr.String())
+	}
+}
+
+func TestParseDetector(t *testing.T) {
+	tests := []struct {
+		spec string
+		want ddns.Detector
+	}{
+		{"none", nil},
+		{"http", ddns.HTTPDetector{}},
+		{"http:https://ipv4.icanhazip.com", ddns.HTTPDetector{URL: "https://ipv4.icanhazip.com"}},
+		{"interface:eth0", ddns.InterfaceDetector{Name: "eth0"}},
+		{"upnp", ddns.UPnPDetector{}},
+		{"upnp:http://192.168.178.1:49000/igddesc.xml", ddns.UPnPDetector{Location: "http://192.168.178.1:49000/igddesc.xml"}},
+	}
+	for _, tt := range tests {
+		got, err := parseDetector(tt.spec)
+		if err != nil || got != tt.want {
+			t.Errorf("%s: expected %#v, got %#v, %v", tt.spec, tt.want, got, err)
+		}
+	}
+
+	for _, spec := range []string{"", "dns", "interface"} {
+		if _, err := parseDetector(spec); err == nil {
+			t.Errorf("%q: expected an error", spec)
+		}
+	}
+}
+
+func TestListen(t *testing.T) {
+	api := autodnstest.SetEnv(t, testZone())
+	hosts := filepath.Join(t.TempDir(), "hosts.yaml")
+	if err := os.WriteFile(hosts, []byte("- {hostname: office.example.com, zone: example.com, username: office, password: secret}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reserve a free port for the server
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- run(ctx, []string{"-listen", addr, "-hosts", hosts}, io.Discard) }()
+	defer func() {
+		cancel()
+		if err := <-done; !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected the server to stop with the context, got %v", err)
+		}
+	}()
+
+	req, _ := http.NewRequest(http.MethodGet, "http://"+addr+"/nic/update?hostname=office.example.com&myip=198.51.100.7", nil)
+	req.SetBasicAuth("office", "secret")
+	var resp *http.Response
+	for range 50 {
+		if resp, err = http.DefaultClient.Do(req); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "good 198.51.100.7\n" {
+		t.Errorf("Expected good, got %q", body)
+	}
+	if records := api.Zone("example.com").ResourceRecords; len(records) != 1 || records[0].Value != "198.51.100.7" {
+		t.Errorf("Expected the A record to be set, got %+v", records)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	autodnstest.SetEnv(t, testZone())
+	for _, args := range [][]string{
+		{"example.com"},
+		{"-listen", ":8080"},
+		{"-listen", ":8080", "-hosts", "hosts.yaml", "example.com", "office"},
+	} {
+		if err := run(context.Background(), args, io.Discard); !errors.Is(err, flag.ErrHelp) {
+			t.Errorf("%v: expected usage, got %v", args, err)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+// Command autodns-rfc2136 is a DNS UPDATE (RFC 2136) gateway to AutoDNS.
+//
+// Usage:
+//
+//	autodns-rfc2136 -keys <file> [flags]
+//
+// It accepts TSIG-signed UPDATE messages over UDP and TCP, checks their
+// prerequisites against the current AutoDNS zone and applies the changes,
+// so clients such as nsupdate, certbot's dns-rfc2136 plugin and ISC DHCP
+// can manage AutoDNS records. The TSIG keys are read from the YAML or JSON
+// file given with -keys, optionally with the zones and names each key may
+// update (see rfc2136.LoadKeyFile):
+//
+//	certbot.: "c2VjcmV0IHNoYXJlZCB3aXRoIHRoZSBjbGllbnQ="
+//	dhcp.:
+//	  secret: "YW5vdGhlciBzZWNyZXQ="
+//	  zones: [example.com]
+//	  names: ["*.dhcp.example.com"]
+//
+// Keys without zones may update every zone given with -zones, or every zone
+// of the account if -zones is empty, which is logged as a warning.
+//
+// The provider is configured from the AUTODNS_* environment variables (see
+// autodns.NewFromEnv) or from the file given with -config (see
+// autodns.NewFromConfigFile).
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	autodns "github.com/saveenergy/libdns-autodns"
+	"github.com/saveenergy/libdns-autodns/rfc2136"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err := run(ctx, os.Args[1:], os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(2)
+	}
+	if err != nil && !errors.Is(err, context.Canceled) {
+		fmt.Fprintln(os.Stderr, "autodns-rfc2136:", err)
+		os.Exit(1)
+	}
+}
+
+// run executes the command line args. It is separate from main so that the
+// server can be tested without a process.
+func run(ctx context.Context, args []string, stderr io.Writer) error {
+	var config, listen, keysFile, zones string
+	var verbose bool
+
+	fs := flag.NewFlagSet("autodns-rfc2136", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&config, "config", "", "JSON, YAML or TOML config `file` instead of the AUTODNS_* environment")
+	fs.StringVar(&listen, "listen", ":53", "UDP and TCP `address` to serve updates on")
+	fs.StringVar(&keysFile, "keys", "", "YAML or JSON `file` mapping TSIG key names to base64 secrets and policies")
+	fs.StringVar(&zones, "zones", "", "comma-separated `zones` that may be updated; all zones of the account if empty")
+	fs.BoolVar(&verbose, "verbose", false, "log debug messages")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: autodns-rfc2136 -keys <file> [flags]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 || keysFile == "" {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	keys, policies, err := rfc2136.LoadKeyFile(keysFile)
+	if err != nil {
+		return err
+	}
+
+	var provider *autodns.Provider
+	if config != "" {
+		provider, err = autodns.NewFromConfigFile(config)
+	} else {
+		provider, err = autodns.NewFromEnv()
+	}
+	if err != nil {
+		return err
+	}
+
+	level := slog.LevelInfo
+	if verbose {
+		level = slog.LevelDebug
+	}
+	logger := slog.New(slog.NewTextHandler(stderr, &slog.HandlerOptions{Level: level}))
+	provider.Logger = logger
+
+	server := &rfc2136.Server{Provider: provider, Keys: keys, Policies: policies, Logger: logger}
+	for zone := range strings.SplitSeq(zones, ",") {
+		if zone = strings.TrimSpace(zone); zone != "" {
+			server.Zones = append(server.Zones, zone)
+		}
+	}
+	return server.ListenAndServe(ctx, listen)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	autodns "github.com/saveenergy/libdns-autodns"
+	"github.com/saveenergy/libdns-autodns/internal/autodnstest"
+)
+
+const testSecret = "c2VjcmV0IHNoYXJlZCB3aXRoIHRoZSBjbGllbnQ="
+
+func TestServe(t *testing.T) {
+	api := autodnstest.SetEnv(t, autodns.Zone{
+		Origin: "example.com",
+		SOA:    &autodns.SOA{TTL: 86400, Email: "hostmaster@example.com"},
+	})
+
+	keys := filepath.Join(t.TempDir(), "keys.yaml")
+	if err := os.WriteFile(keys, []byte("certbot.:\n  secret: "+testSecret+"\n  names: [_acme-challenge.example.com]\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reserve a free port for both UDP and TCP
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := conn.LocalAddr().String()
+	conn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var stderr bytes.Buffer
+	done := make(chan error, 1)
+	go func() { done <- run(ctx, []string{"-listen", addr, "-keys", keys, "-zones", "example.com"}, &stderr) }()
+	defer func() {
+		cancel()
+		if err := <-done; !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got %v\n%s", err, stderr.String())
+		}
+	}()
+
+	m := new(dns.Msg)
+	m.SetUpdate("example.com.")
+	rr, _ := dns.NewRR(`_acme-challenge.example.com. 60 IN TXT "token"`)
+	m.Insert([]dns.RR{rr})
+	c := &dns.Client{Net: "tcp", Timeout: time.Second, TsigSecret: map[string]string{"certbot.": testSecret}}
+
+	var resp *dns.Msg
+	for range 50 {
+		m.Extra = nil
+		m.SetTsig("certbot.", dns.HmacSHA256, 300, time.Now().Unix())
+		if resp, _, err = c.Exchange(m, addr); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("Exchange failed: %v", err)
+	}
+	if resp.Rcode != dns.RcodeSuccess {
+		t.Fatalf("Expected NOERROR, got %s", dns.RcodeToString[resp.Rcode])
+	}
+	if records := api.Zone("example.com").ResourceRecords; len(records) != 1 || records[0].Value != "token" {
+		t.Errorf("Expected the TXT record, got %+v", records)
+	}
+
+	// The key may only change the challenge name
+	m = new(dns.Msg)
+	m.SetUpdate("example.com.")
+	rr, _ = dns.NewRR("www.example.com. 300 IN A 198.51.100.7")
+	m.Insert([]dns.RR{rr})
+	m.SetTsig("certbot.", dns.HmacSHA256, 300, time.Now().Unix())
+	if resp, _, err = c.Exchange(m, addr); err != nil || resp.Rcode != dns.RcodeRefused {
+		t.Errorf("Expected REFUSED outside the key's names, got %v, %v", resp, err)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	var stderr bytes.Buffer
+	if err := run(context.Background(), nil, &stderr); !errors.Is(err, flag.ErrHelp) {
+		t.Errorf("Expected flag.ErrHelp without -keys, got %v", err)
+	}
+	if !strings.Contains(stderr.String(), "Usage: autodns-rfc2136") {
+		t.Errorf("Expected usage, got:\n%s", stderr.String())
+	}
+}
@@ -0,0 +1,127 @@
+// Command autodns-webhook is an external-dns webhook provider for AutoDNS.
+//
+// Usage:
+//
+//	autodns-webhook [flags]
+//
+// It serves the external-dns webhook protocol on -listen (localhost:8888,
+// the address external-dns expects by default) and a /healthz endpoint for
+// Kubernetes probes on -health-listen. Run it as a sidecar of external-dns
+// started with --provider=webhook.
+//
+// The provider is configured from the AUTODNS_* environment variables (see
+// autodns.NewFromEnv) or from the file given with -config (see
+// autodns.NewFromConfigFile).
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	autodns "github.com/saveenergy/libdns-autodns"
+	"github.com/saveenergy/libdns-autodns/externaldns"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err := run(ctx, os.Args[1:], os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(2)
+	}
+	if err != nil && !errors.Is(err, context.Canceled) {
+		fmt.Fprintln(os.Stderr, "autodns-webhook:", err)
+		os.Exit(1)
+	}
+}
+
+// run executes the command line args. It is separate from main so that the
+// server can be tested without a process.
+func run(ctx context.Context, args []string, stderr io.Writer) error {
+	webhook := &externaldns.Webhook{}
+	var config, listen, healthListen, zones string
+	var verbose bool
+
+	fs := flag.NewFlagSet("autodns-webhook", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&config, "config", "", "JSON, YAML or TOML config `file` instead of the AUTODNS_* environment")
+	fs.StringVar(&listen, "listen", "localhost:8888", "`address` to serve the webhook protocol on")
+	fs.StringVar(&healthListen, "health-listen", ":8080", "`address` to serve /healthz on; empty disables it")
+	fs.StringVar(&zones, "zones", "", "comma-separated `zones` to manage; all zones of the account if empty")
+	fs.DurationVar(&webhook.DefaultTTL, "ttl", externaldns.DefaultTTL, "TTL of records whose endpoint has none")
+	fs.BoolVar(&verbose, "verbose", false, "log debug messages")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: autodns-webhook [flags]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	var err error
+	if config != "" {
+		webhook.Provider, err = autodns.NewFromConfigFile(config)
+	} else {
+		webhook.Provider, err = autodns.NewFromEnv()
+	}
+	if err != nil {
+		return err
+	}
+
+	level := slog.LevelInfo
+	if verbose {
+		level = slog.LevelDebug
+	}
+	logger := slog.New(slog.NewTextHandler(stderr, &slog.HandlerOptions{Level: level}))
+	webhook.Provider.Logger = logger
+	webhook.Logger = logger
+	for zone := range strings.SplitSeq(zones, ",") {
+		if zone = strings.TrimSpace(zone); zone != "" {
+			webhook.Zones = append(webhook.Zones, zone)
+		}
+	}
+
+	servers := []*http.Server{{Addr: listen, Handler: webhook, ReadHeaderTimeout: 10 * time.Second}}
+	if healthListen != "" {
+		health := http.NewServeMux()
+		health.Handle("GET /healthz", webhook)
+		servers = append(servers, &http.Server{Addr: healthListen, Handler: health, ReadHeaderTimeout: 10 * time.Second})
+	}
+	return serve(ctx, servers)
+}
+
+// serve runs the servers until ctx is done or one of them fails
+func serve(ctx context.Context, servers []*http.Server) error {
+	errc := make(chan error, len(servers))
+	for _, server := range servers {
+		go func() { errc <- server.ListenAndServe() }()
+	}
+
+	var err error
+	select {
+	case err = <-errc:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, server := range servers {
+		server.Shutdown(shutdownCtx)
+	}
+	return err
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	autodns "github.com/saveenergy/libdns-autodns"
+	"github.com/saveenergy/libdns-autodns/externaldns"
+	"github.com/saveenergy/libdns-autodns/internal/autodnstest"
+)
+
+// freeAddr reserves a free local port
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+func TestServe(t *testing.T) {
+	api := autodnstest.SetEnv(t, autodns.Zone{
+		Origin: "example.com",
+		SOA:    &autodns.SOA{TTL: 86400, Email: "hostmaster@example.com"},
+	})
+
+	addr, healthAddr := freeAddr(t), freeAddr(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	var stderr bytes.Buffer
+	done := make(chan error, 1)
+	go func() {
+		done <- run(ctx, []string{"-listen", addr, "-health-listen", healthAddr, "-zones", "example.com"}, &stderr)
+	}()
+	defer func() {
+		cancel()
+		if err := <-done; !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got %v\n%s", err, stderr.String())
+		}
+	}()
+
+	var resp *http.Response
+	var err error
+	for range 50 {
+		if resp, err = http.Get("http://" + healthAddr + "/healthz"); err == nil {
+			resp.Body.Close()
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected a healthy server, got %v %v", resp, err)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, "http://"+addr+"/records",
+		strings.NewReader(`{"create": [{"dnsName": "app.example.com", "targets": ["198.51.100.7"], "recordType": "A"}]}`))
+	req.Header.Set("Content-Type", externaldns.MediaType)
+	if resp, err = http.DefaultClient.Do(req); err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d %s", resp.StatusCode, body)
+	}
+	if records := api.Zone("example.com").ResourceRecords; len(records) != 1 || records[0].Value != "198.51.100.7" || records[0].TTL != 300 {
+		t.Errorf("Expected the A record, got %+v", records)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	if err := run(context.Background(), []string{"example.com"}, io.Discard); !errors.Is(err, flag.ErrHelp) {
+		t.Errorf("Expected usage, got %v", err)
+	}
+}
@@ -0,0 +1,472 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/libdns/libdns"
+	autodns "github.com/saveenergy/libdns-autodns"
+)
+
+// cli holds the global flags shared by all commands
+type cli struct {
+	config                                string
+	username, password, context, endpoint string
+	output                                string
+	dryRun, verbose                       bool
+
+	stdin          io.Reader
+	stdout, stderr io.Writer
+}
+
+// command describes a subcommand. setup registers the command's flags and
+// returns the function that runs it with the remaining arguments.
+type command struct {
+	name    string
+	usage   string
+	summary string
+	minArgs int
+	maxArgs int // -1 for no limit
+	setup   func(c *cli, fs *flag.FlagSet) func(ctx context.Context, args []string) error
+}
+
+var commands = []command{
+	{
+		name: "list-zones", summary: "list the zones in the account",
+		minArgs: 0, maxArgs: 0,
+		setup: func(c *cli, fs *flag.FlagSet) func(context.Context, []string) error {
+			return c.listZones
+		},
+	},
+	{
+		name: "get", usage: "<zone>", summary: "list the records of a zone",
+		minArgs: 1, maxArgs: 1,
+		setup: func(c *cli, fs *flag.FlagSet) func(context.Context, []string) error {
+			return c.get
+		},
+	},
+	{
+		name: "append", usage: "[-ttl duration] <zone> <name> <type> <data>...", summary: "add a record to a zone",
+		minArgs: 4, maxArgs: -1,
+		setup: func(c *cli, fs *flag.FlagSet) func(context.Context, []string) error {
+			ttl := fs.Duration("ttl", time.Hour, "record TTL")
+			return func(ctx context.Context, args []string) error {
+				return c.change(ctx, autodns.OperationAppend, args, *ttl)
+			}
+		},
+	},
+	{
+		name: "set", usage: "[-ttl duration] <zone> <name> <type> <data>...", summary: "replace the records with this name and type",
+		minArgs: 4, maxArgs: -1,
+		setup: func(c *cli, fs *flag.FlagSet) func(context.Context, []string) error {
+			ttl := fs.Duration("ttl", time.Hour, "record TTL")
+			return func(ctx context.Context, args []string) error {
+				return c.change(ctx, autodns.OperationSet, args, *ttl)
+			}
+		},
+	},
+	{
+		name: "delete", usage: "<zone> <name> <type> [data...]", summary: "delete matching records; without data all records with this name and type",
+		minArgs: 3, maxArgs: -1,
+		setup: func(c *cli, fs *flag.FlagSet) func(context.Context, []string) error {
+			return c.delete
+		},
+	},
+	{
+		name: "export", usage: "[-o file] <zone>", summary: "write the zone as a BIND master file",
+		minArgs: 1, maxArgs: 1,
+		setup: func(c *cli, fs *flag.FlagSet) func(context.Context, []string) error {
+			out := fs.String("o", "", "output `file` (default stdout)")
+			return func(ctx context.Context, args []string) error {
+				return c.export(ctx, args[0], *out)
+			}
+		},
+	},
+	{
+		name: "import", usage: "[-replace] [-allow-include] [-allow-empty] <zone> <file|->", summary: "write the records of a BIND master file to a zone",
+		minArgs: 2, maxArgs: 2,
+		setup: func(c *cli, fs *flag.FlagSet) func(context.Context, []string) error {
+			opts := importFlags(fs)
+			return func(ctx context.Context, args []string) error {
+				return c.importZone(ctx, args[0], args[1], *opts)
+			}
+		},
+	},
+	{
+		name: "diff", usage: "[-replace] [-allow-include] [-allow-empty] <zone> <file|->", summary: "show what importing a zone file or restoring a .json/.yaml snapshot would change",
+		minArgs: 2, maxArgs: 2,
+		setup: func(c *cli, fs *flag.FlagSet) func(context.Context, []string) error {
+			opts := importFlags(fs)
+			return func(ctx context.Context, args []string) error {
+				return c.diff(ctx, args[0], args[1], *opts)
+			}
+		},
+	},
+}
+
+// importFlags registers the zone file import flags
+func importFlags(fs *flag.FlagSet) *autodns.ImportOptions {
+	opts := &autodns.ImportOptions{}
+	fs.BoolVar(&opts.Replace, "replace", false, "make the file the complete record set of the zone")
+	fs.BoolVar(&opts.AllowInclude, "allow-include", false, "allow $INCLUDE directives")
+	fs.BoolVar(&opts.AllowEmpty, "allow-empty", false, "allow -replace to remove every record")
+	return opts
+}
+
+// provider builds the Provider from the config file or the environment,
+// with the global flags taking precedence
+func (c *cli) provider() (*autodns.Provider, error) {
+	var p *autodns.Provider
+	var err error
+	switch {
+	case c.config != "":
+		p, err = autodns.NewFromConfigFile(c.config)
+	case c.username != "" && c.password != "":
+		// Credentials come from the flags, everything else still from the
+		// environment
+		p = &autodns.Provider{}
+		err = p.LoadEnv()
+	default:
+		p, err = autodns.NewFromEnv()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if c.username != "" || c.password != "" {
+		// Flags replace credentials read from secret files
+		p.CredentialSource = nil
+	}
+	for _, override := range []struct {
+		flag string
+		dest *string
+	}{
+		{c.username, &p.Username},
+		{c.password, &p.Password},
+		{c.context, &p.Context},
+		{c.endpoint, &p.Endpoint},
+	} {
+		if override.flag != "" {
+			*override.dest = override.flag
+		}
+	}
+	// AUTODNS_DRY_RUN or dry_run in the config file enable it as well
+	p.DryRun = p.DryRun || c.dryRun
+	c.dryRun = p.DryRun
+	if c.verbose {
+		p.Logger = slog.New(slog.NewTextHandler(c.stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	}
+	return p, nil
+}
+
+func (c *cli) listZones(ctx context.Context, _ []string) error {
+	p, err := c.provider()
+	if err != nil {
+		return err
+	}
+	zones, err := p.ListZones(ctx)
+	if err != nil {
+		return err
+	}
+
+	if c.output == "json" {
+		return c.writeJSON(zones)
+	}
+	tw := c.table("ZONE")
+	for _, zone := range zones {
+		fmt.Fprintln(tw, zone.Name)
+	}
+	return tw.Flush()
+}
+
+func (c *cli) get(ctx context.Context, args []string) error {
+	p, err := c.provider()
+	if err != nil {
+		return err
+	}
+	records, err := p.GetRecords(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	return c.writeRecords(records)
+}
+
+// change appends or sets the record given as 'zone name type data...'. The
+// changes are planned first so they can be shown; the write reuses the zone
+// fetched for the plan.
+func (c *cli) change(ctx context.Context, operation autodns.Operation, args []string, ttl time.Duration) error {
+	zone := args[0]
+	record, err := parseRecord(args[1:], ttl)
+	if err != nil {
+		return err
+	}
+	records := []libdns.Record{record}
+
+	p, err := c.provider()
+	if err != nil {
+		return err
+	}
+	changes, err := p.Plan(ctx, zone, operation, records)
+	if err != nil {
+		return err
+	}
+	if !c.dryRun && !changes.Empty() {
+		if operation == autodns.OperationAppend {
+			_, err = p.AppendRecords(ctx, zone, records)
+		} else {
+			_, err = p.SetRecords(ctx, zone, records)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return c.writeChanges(changes)
+}
+
+func (c *cli) delete(ctx context.Context, args []string) error {
+	zone, name, recordType := args[0], args[1], strings.ToUpper(args[2])
+	p, err := c.provider()
+	if err != nil {
+		return err
+	}
+
+	var records []libdns.Record
+	if len(args) > 3 {
+		record, err := parseRecord(args[1:], 0)
+		if err != nil {
+			return err
+		}
+		records = []libdns.Record{record}
+	} else {
+		// Without data, delete the whole record set
+		existing, err := p.GetRecords(ctx, zone)
+		if err != nil {
+			return err
+		}
+		for _, record := range existing {
+			rr := record.RR()
+			if rr.Type == recordType && normalizeName(rr.Name) == normalizeName(name) {
+				records = append(records, record)
+			}
+		}
+		if len(records) == 0 {
+			return fmt.Errorf("no %s records named %s in %s", recordType, name, zone)
+		}
+	}
+
+	changes, err := p.Plan(ctx, zone, autodns.OperationDelete, records)
+	if err != nil {
+		return err
+	}
+	if !c.dryRun && !changes.Empty() {
+		if _, err := p.DeleteRecords(ctx, zone, records); err != nil {
+			return err
+		}
+	}
+	return c.writeChanges(changes)
+}
+
+func (c *cli) export(ctx context.Context, zone, out string) error {
+	p, err := c.provider()
+	if err != nil {
+		return err
+	}
+
+	if out == "" {
+		return p.ExportZoneFile(ctx, zone, c.stdout)
+	}
+
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	if err := p.ExportZoneFile(ctx, zone, f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (c *cli) importZone(ctx context.Context, zone, file string, opts autodns.ImportOptions) error {
+	r, closeFile, err := c.open(file)
+	if err != nil {
+		return err
+	}
+	defer closeFile()
+
+	if file != "-" {
+		opts.IncludeDir = filepath.Dir(file)
+	}
+	p, err := c.provider()
+	if err != nil {
+		return err
+	}
+	opts.DryRun = c.dryRun
+	changes, err := p.ImportZoneFile(ctx, zone, r, opts)
+	if err != nil {
+		return err
+	}
+	return c.writeChanges(changes)
+}
+
+func (c *cli) diff(ctx context.Context, zone, file string, opts autodns.ImportOptions) error {
+	r, closeFile, err := c.open(file)
+	if err != nil {
+		return err
+	}
+	defer closeFile()
+
+	p, err := c.provider()
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".json", ".yaml", ".yml":
+		format := autodns.SnapshotJSON
+		if filepath.Ext(file) != ".json" {
+			format = autodns.SnapshotYAML
+		}
+		snapshot, err := autodns.DecodeSnapshot(r, format)
+		if err != nil {
+			return err
+		}
+		if snapshot.Zone != strings.TrimSuffix(zone, ".") {
+			return fmt.Errorf("snapshot is of zone %s, not %s", snapshot.Zone, zone)
+		}
+		plan, err := p.CompareSnapshot(ctx, snapshot)
+		if err != nil {
+			return err
+		}
+		if c.output == "json" {
+			return c.writeJSON(plan)
+		}
+		for _, setting := range []struct {
+			name    string
+			changed bool
+		}{{"SOA", plan.SOA}, {"name servers", plan.NameServers}, {"wwwInclude", plan.WWWInclude}, {"virtual name server", plan.VirtualNameServer}} {
+			if setting.changed {
+				fmt.Fprintf(c.stdout, "~ %s differs\n", setting.name)
+			}
+		}
+		return c.writeChanges(plan.Records)
+	default:
+		if file != "-" {
+			opts.IncludeDir = filepath.Dir(file)
+		}
+		opts.DryRun = true
+		changes, err := p.ImportZoneFile(ctx, zone, r, opts)
+		if err != nil {
+			return err
+		}
+		return c.writeChanges(changes)
+	}
+}
+
+// open opens file for reading, with "-" meaning stdin
+func (c *cli) open(file string) (io.Reader, func(), error) {
+	if file == "-" {
+		return c.stdin, func() {}, nil
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, func() { f.Close() }, nil
+}
+
+// parseRecord builds a record from 'name type data...'
+func parseRecord(args []string, ttl time.Duration) (libdns.Record, error) {
+	rr := libdns.RR{
+		Name: args[0],
+		Type: strings.ToUpper(args[1]),
+		Data: strings.Join(args[2:], " "),
+		TTL:  ttl,
+	}
+	record, err := rr.Parse()
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s record %s: %v", rr.Type, rr.Name, err)
+	}
+	return record, nil
+}
+
+// normalizeName maps the apex spellings to "@"
+func normalizeName(name string) string {
+	if name == "" {
+		return "@"
+	}
+	return name
+}
+
+func (c *cli) writeRecords(records []libdns.Record) error {
+	if c.output == "json" {
+		rrs := make([]libdns.RR, 0, len(records))
+		for _, record := range records {
+			rrs = append(rrs, record.RR())
+		}
+		return c.writeJSON(rrs)
+	}
+
+	tw := c.table("NAME\tTTL\tTYPE\tDATA")
+	for _, record := range records {
+		rr := record.RR()
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", normalizeName(rr.Name), rr.TTL, rr.Type, rr.Data)
+	}
+	return tw.Flush()
+}
+
+func (c *cli) writeChanges(changes autodns.ChangeSet) error {
+	if c.output == "json" {
+		return c.writeJSON(changes)
+	}
+
+	tw := c.table("\tNAME\tTTL\tTYPE\tVALUE")
+	row := func(op string, rr autodns.ResourceRecord) {
+		value := rr.Value
+		if rr.Pref != 0 {
+			value = fmt.Sprintf("%d %s", rr.Pref, value)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\n", op, normalizeName(rr.Name), rr.TTL, rr.Type, value)
+	}
+	for _, rr := range changes.Adds {
+		row("+", rr)
+	}
+	for _, rr := range changes.Removes {
+		row("-", rr)
+	}
+	for _, mod := range changes.Modifications {
+		row("-", mod.Before)
+		row("+", mod.After)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	summary := changes.String()
+	if c.dryRun {
+		summary += " (dry run)"
+	}
+	_, err := fmt.Fprintln(c.stdout, summary)
+	return err
+}
+
+func (c *cli) writeJSON(v any) error {
+	enc := json.NewEncoder(c.stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// table returns a tabwriter with the header already written
+func (c *cli) table(header string) *tabwriter.Writer {
+	tw := tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, header)
+	return tw
+}
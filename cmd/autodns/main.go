@@ -0,0 +1,109 @@
+// Command autodns manages AutoDNS zones and records from the command line.
+//
+// Usage:
+//
+//	autodns [flags] <command> [command flags] [arguments]
+//
+// The commands are:
+//
+//	list-zones                        list the zones in the account
+//	get <zone>                        list the records of a zone
+//	append <zone> <name> <type> <data>  add a record
+//	set <zone> <name> <type> <data>   replace the records with this name and type
+//	delete <zone> <name> <type> [data]  delete matching records
+//	export <zone>                     write the zone as a BIND master file
+//	import <zone> <file>              write the records of a BIND master file
+//	diff <zone> <file>                show what importing a zone file or restoring a snapshot would change
+//
+// The provider is configured from the AUTODNS_* environment variables (see
+// autodns.NewFromEnv) or from the file given with -config (see
+// autodns.NewFromConfigFile). The -username, -password, -context and
+// -endpoint flags override either source.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	err := run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "autodns:", err)
+		os.Exit(1)
+	}
+}
+
+// run executes the command line args. It is separate from main so that the
+// tool can be tested without a process.
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	cli := &cli{stdin: stdin, stdout: stdout, stderr: stderr}
+
+	global := flag.NewFlagSet("autodns", flag.ContinueOnError)
+	global.SetOutput(stderr)
+	global.StringVar(&cli.config, "config", "", "JSON, YAML or TOML config `file` instead of the AUTODNS_* environment")
+	global.StringVar(&cli.username, "username", "", "AutoDNS `user` (AUTODNS_USERNAME)")
+	global.StringVar(&cli.password, "password", "", "AutoDNS password (AUTODNS_PASSWORD)")
+	global.StringVar(&cli.context, "context", "", "AutoDNS context, 1 = demo, 4 = live (AUTODNS_CONTEXT)")
+	global.StringVar(&cli.endpoint, "endpoint", "", "API endpoint `URL` (AUTODNS_ENDPOINT)")
+	global.StringVar(&cli.output, "output", "table", "output `format`: table or json")
+	global.BoolVar(&cli.dryRun, "dry-run", false, "show changes without writing zones")
+	global.BoolVar(&cli.verbose, "verbose", false, "log API requests to stderr")
+	global.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: autodns [flags] <command> [command flags] [arguments]")
+		fmt.Fprintln(stderr, "\nCommands:")
+		for _, cmd := range commands {
+			fmt.Fprintf(stderr, "  %-12s %s\n", cmd.name, cmd.summary)
+		}
+		fmt.Fprintln(stderr, "\nFlags:")
+		global.PrintDefaults()
+	}
+
+	if err := global.Parse(args); err != nil {
+		return err
+	}
+	if global.NArg() == 0 {
+		global.Usage()
+		return flag.ErrHelp
+	}
+	if cli.output != "table" && cli.output != "json" {
+		return fmt.Errorf("unknown output format %q", cli.output)
+	}
+
+	name := global.Arg(0)
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+
+		fs := flag.NewFlagSet("autodns "+cmd.name, flag.ContinueOnError)
+		fs.SetOutput(stderr)
+		fs.Usage = func() {
+			fmt.Fprintf(stderr, "Usage: autodns %s %s\n\n%s\n", cmd.name, cmd.usage, cmd.summary)
+			fs.PrintDefaults()
+		}
+		run := cmd.setup(cli, fs)
+		if err := fs.Parse(global.Args()[1:]); err != nil {
+			return err
+		}
+		if fs.NArg() < cmd.minArgs || (cmd.maxArgs >= 0 && fs.NArg() > cmd.maxArgs) {
+			fs.Usage()
+			return flag.ErrHelp
+		}
+		return run(ctx, fs.Args())
+	}
+
+	global.Usage()
+	return fmt.Errorf("unknown command %q", name)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	autodns "github.com/saveenergy/libdns-autodns"
+	"github.com/saveenergy/libdns-autodns/internal/autodnstest"
+)
+
+// newTestAPI serves a single example.com zone and points the environment
+// at it
+func newTestAPI(t *testing.T) *autodnstest.Server {
+	t.Helper()
+	return autodnstest.SetEnv(t, autodns.Zone{
+		Origin: "example.com",
+		SOA:    &autodns.SOA{TTL: 86400, Email: "hostmaster@example.com"},
+		ResourceRecords: []autodns.ResourceRecord{
+			{Name: "www", TTL: 300, Type: "A", Value: "192.0.2.1"},
+			{Name: "www", TTL: 300, Type: "A", Value: "192.0.2.2"},
+			{Name: "", TTL: 300, Type: "MX", Value: "mail.example.com", Pref: 10},
+		},
+	})
+}
+
+func runTool(t *testing.T, stdin string, args ...string) (string, error) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	err := run(context.Background(), args, strings.NewReader(stdin), &stdout, &stderr)
+	return stdout.String(), err
+}
+
+func TestListAndGet(t *testing.T) {
+	newTestAPI(t)
+
+	out, err := runTool(t, "", "list-zones")
+	if err != nil || !strings.Contains(out, "example.com") {
+		t.Errorf("list-zones: got %q, %v", out, err)
+	}
+
+	out, err = runTool(t, "", "get", "example.com")
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	if !strings.HasPrefix(out, "NAME") || !strings.Contains(out, "192.0.2.2") || !strings.Contains(out, "10 mail.example.com") {
+		t.Errorf("Unexpected table output:\n%s", out)
+	}
+
+	out, err = runTool(t, "", "-output", "json", "get", "example.com")
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	var records []map[string]any
+	if err := json.Unmarshal([]byte(out), &records); err != nil || len(records) != 3 {
+		t.Errorf("Expected 3 JSON records, got %q (%v)", out, err)
+	}
+}
+
+func TestChangeCommands(t *testing.T) {
+	api := newTestAPI(t)
+
+	out, err := runTool(t, "", "-dry-run", "set", "-ttl", "5m", "example.com", "www", "A", "192.0.2.9")
+	if err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	if !strings.Contains(out, "example.com: +0 -1 ~1 (dry run)") || len(api.Zone("example.com").ResourceRecords) != 3 {
+		t.Errorf("Expected a dry run, got:\n%s", out)
+	}
+
+	if _, err := runTool(t, "", "append", "example.com", "_acme-challenge", "TXT", "token"); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+	if len(api.Zone("example.com").ResourceRecords) != 4 {
+		t.Errorf("Expected the TXT record to be appended, got %+v", api.Zone("example.com").ResourceRecords)
+	}
+
+	// Without data the whole record set is deleted
+	out, err = runTool(t, "", "delete", "example.com", "www", "a")
+	if err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if !strings.Contains(out, "+0 -2 ~0") || len(api.Zone("example.com").ResourceRecords) != 2 {
+		t.Errorf("Expected both A records to be deleted, got:\n%s", out)
+	}
+}
+
+func TestExportImportDiff(t *testing.T) {
+	api := newTestAPI(t)
+	file := filepath.Join(t.TempDir(), "example.com.zone")
+
+	if _, err := runTool(t, "", "export", "-o", file, "example.com"); err != nil {
+		t.Fatalf("export failed: %v", err)
+	}
+	out, err := runTool(t, "", "diff", "-replace", "example.com", file)
+	if err != nil || !strings.Contains(out, "example.com: +0 -0 ~0") {
+		t.Errorf("Expected no differences after export, got %q, %v", out, err)
+	}
+
+	data, _ := os.ReadFile(file)
+	edited := strings.Replace(string(data), "192.0.2.2", "192.0.2.3", 1)
+	out, err = runTool(t, edited, "import", "example.com", "-")
+	if err != nil || !strings.Contains(out, "~1") {
+		t.Fatalf("import: got %q, %v", out, err)
+	}
+	if got := api.Zone("example.com").ResourceRecords; !strings.Contains(recordValues(got), "192.0.2.3") {
+		t.Errorf("Expected the imported record, got %+v", got)
+	}
+}
+
+func TestUsageErrors(t *testing.T) {
+	newTestAPI(t)
+
+	if _, err := runTool(t, "", "bogus"); err == nil || !strings.Contains(err.Error(), "unknown command") {
+		t.Errorf("Expected an unknown command error, got %v", err)
+	}
+	if _, err := runTool(t, "", "get"); err == nil {
+		t.Error("Expected a missing argument error")
+	}
+	if _, err := runTool(t, "", "append", "example.com", "www", "A", "not-an-ip"); err == nil {
+		t.Error("Expected an invalid record error")
+	}
+}
+
+func recordValues(records []autodns.ResourceRecord) string {
+	var values []string
+	for _, rr := range records {
+		values = append(values, rr.Value)
+	}
+	return strings.Join(values, " ")
+}
+
+func TestConfigFile(t *testing.T) {
+	newTestAPI(t)
+	endpoint := os.Getenv("AUTODNS_ENDPOINT")
+	t.Setenv("AUTODNS_USERNAME", "")
+	t.Setenv("AUTODNS_PASSWORD", "")
+
+	// The environment alone is incomplete now
+	if _, err := runTool(t, "", "list-zones"); err == nil || !strings.Contains(err.Error(), "AUTODNS_USERNAME") {
+		t.Errorf("Expected a missing username error, got %v", err)
+	}
+
+	config := filepath.Join(t.TempDir(), "autodns.yaml")
+	if err := os.WriteFile(config, []byte("username: user\npassword: wrong\nendpoint: "+endpoint+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// Flags override the config file
+	out, err := runTool(t, "", "-config", config, "-password", "secret", "list-zones")
+	if err != nil || !strings.Contains(out, "example.com") {
+		t.Errorf("list-zones: got %q, %v", out, err)
+	}
+}
+
+func TestCredentialFlagsKeepEnvironment(t *testing.T) {
+	api := newTestAPI(t)
+
+	// Only the credentials are given as flags; the demo context and the
+	// endpoint still come from the environment
+	t.Setenv("AUTODNS_USERNAME", "")
+	t.Setenv("AUTODNS_PASSWORD", "")
+	t.Setenv("AUTODNS_CONTEXT", "1")
+
+	out, err := runTool(t, "", "-username", "user", "-password", "secret", "list-zones")
+	if err != nil || !strings.Contains(out, "example.com") {
+		t.Fatalf("list-zones: got %q, %v", out, err)
+	}
+	if contexts := api.Contexts(); len(contexts) != 1 || contexts[0] != "1" {
+		t.Errorf("Expected a request in context 1, got %v", contexts)
+	}
+}
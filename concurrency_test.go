@@ -0,0 +1,86 @@
+package autodns
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+// These tests are meant for go test -race; they share one Provider across
+// goroutines the way Caddy does.
+
+func TestConcurrentInitialization(t *testing.T) {
+	api := newFakeAPI(t, testZone())
+	// Context is left empty so the first calls race to set the default
+	provider := &Provider{Username: "user", Password: "secret", Endpoint: api.URL + "/"}
+
+	var wg sync.WaitGroup
+	for range 16 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := provider.GetRecords(context.Background(), "example.com"); err != nil {
+				t.Errorf("GetRecords failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestConcurrentOperations(t *testing.T) {
+	ctx := context.Background()
+	api := newFakeAPI(t, testZone())
+	provider := api.provider()
+
+	const workers = 8
+	var wg sync.WaitGroup
+	for i := range workers {
+		wg.Add(4)
+		go func() {
+			defer wg.Done()
+			_, err := provider.AppendRecords(ctx, "example.com", []libdns.Record{
+				libdns.TXT{Name: fmt.Sprintf("append-%d", i), Text: "value", TTL: time.Minute},
+			})
+			if err != nil {
+				t.Errorf("AppendRecords failed: %v", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := provider.SetRecords(ctx, "example.com", []libdns.Record{
+				libdns.Address{Name: fmt.Sprintf("set-%d", i), IP: netip.AddrFrom4([4]byte{192, 0, 2, byte(i)}), TTL: time.Minute},
+			})
+			if err != nil {
+				t.Errorf("SetRecords failed: %v", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			// Deleting records that do not exist leaves the zone unchanged
+			_, err := provider.DeleteRecords(ctx, "example.com", []libdns.Record{
+				libdns.TXT{Name: fmt.Sprintf("missing-%d", i), Text: "value", TTL: time.Minute},
+			})
+			if err != nil {
+				t.Errorf("DeleteRecords failed: %v", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := provider.GetRecords(ctx, "example.com"); err != nil {
+				t.Errorf("GetRecords failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Per-zone locking means no update was lost to a concurrent one
+	got := len(api.Zone("example.com").ResourceRecords)
+	if want := len(testZone().ResourceRecords) + 2*workers; got != want {
+		t.Errorf("Expected %d records after concurrent updates, got %d", want, got)
+	}
+}
@@ -0,0 +1,246 @@
+package autodns
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Environment variables read by NewFromEnv. Each can instead be given as a
+// variable with the _FILE suffix naming a file that holds the value, as
+// used for Docker and Kubernetes secrets.
+const (
+	EnvUsername = "AUTODNS_USERNAME"
+	EnvPassword = "AUTODNS_PASSWORD"
+	EnvContext  = "AUTODNS_CONTEXT"
+	EnvEndpoint = "AUTODNS_ENDPOINT"
+	EnvDryRun   = "AUTODNS_DRY_RUN"
+)
+
+// NewFromEnv creates a Provider from the AUTODNS_* environment variables
+// and validates it.
+func NewFromEnv() (*Provider, error) {
+	return newFromEnv(os.LookupEnv)
+}
+
+// newFromEnv reads the configuration through lookup so tests can supply
+// their own environment
+func newFromEnv(lookup func(string) (string, bool)) (*Provider, error) {
+	p := &Provider{}
+	if err := p.loadEnv(lookup); err != nil {
+		return nil, err
+	}
+
+	if p.Username == "" {
+		return nil, fmt.Errorf("username is required: set %s or %s_FILE", EnvUsername, EnvUsername)
+	}
+	if p.Password == "" {
+		return nil, fmt.Errorf("password is required: set %s or %s_FILE", EnvPassword, EnvPassword)
+	}
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("invalid AutoDNS environment: %w", err)
+	}
+	return p, nil
+}
+
+// LoadEnv sets the fields of p from the AUTODNS_* environment variables that
+// are set and leaves the others unchanged. Unlike NewFromEnv, it neither
+// requires credentials nor validates p, so callers can apply their own
+// settings, such as command-line flags, on top of the environment.
+func (p *Provider) LoadEnv() error {
+	return p.loadEnv(os.LookupEnv)
+}
+
+// loadEnv reads the environment through lookup
+func (p *Provider) loadEnv(lookup func(string) (string, bool)) error {
+	for _, v := range []struct {
+		name string
+		dest *string
+	}{
+		{EnvUsername, &p.Username},
+		{EnvPassword, &p.Password},
+		{EnvContext, &p.Context},
+		{EnvEndpoint, &p.Endpoint},
+	} {
+		value, err := lookupEnv(lookup, v.name)
+		if err != nil {
+			return err
+		}
+		if value != "" {
+			*v.dest = value
+		}
+	}
+
+	dryRun, err := lookupEnv(lookup, EnvDryRun)
+	if err != nil {
+		return err
+	}
+	if dryRun != "" {
+		if p.DryRun, err = strconv.ParseBool(dryRun); err != nil {
+			return fmt.Errorf("invalid %s %q: expected true or false", EnvDryRun, dryRun)
+		}
+	}
+
+	// Secrets given as files are re-read when they are rotated
+	usernameFile, _ := lookup(EnvUsername + "_FILE")
+	passwordFile, _ := lookup(EnvPassword + "_FILE")
+	if source := secretFileSource(p, usernameFile, passwordFile); source != nil {
+		p.CredentialSource = source
+	}
+	return nil
+}
+
+// secretFileSource returns a FileCredentials source for the secret files, or
+// nil if the password is not read from a file
+func secretFileSource(p *Provider, usernameFile, passwordFile string) CredentialSource {
+	if passwordFile == "" {
+		return nil
+	}
+	return &FileCredentials{Username: p.Username, UsernameFile: usernameFile, PasswordFile: passwordFile}
+}
+
+// lookupEnv returns the value of name, or the contents of the file named by
+// name_FILE. Setting both is an error.
+func lookupEnv(lookup func(string) (string, bool), name string) (string, error) {
+	value, ok := lookup(name)
+	file, fileOK := lookup(name + "_FILE")
+	switch {
+	case ok && fileOK:
+		return "", fmt.Errorf("both %s and %s_FILE are set", name, name)
+	case fileOK:
+		value, err := readSecretFile(file)
+		if err != nil {
+			return "", fmt.Errorf("%s_FILE: %v", name, err)
+		}
+		return value, nil
+	default:
+		return value, nil
+	}
+}
+
+// readSecretFile reads a value from a file, dropping the trailing newline
+// most editors and secret stores add
+func readSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// fileConfig is the document read by NewFromConfigFile. The keys match the
+// JSON encoding of Provider.
+type fileConfig struct {
+	Username     string        `json:"username"`
+	UsernameFile string        `json:"username_file"`
+	Password     string        `json:"password"`
+	PasswordFile string        `json:"password_file"`
+	Context      configContext `json:"context"`
+	Endpoint     string        `json:"endpoint"`
+	DryRun       bool          `json:"dry_run"`
+	MaxRetries   int           `json:"max_retries"`
+}
+
+// configContext is the context of a config file, written as a string or as
+// a number such as context: 4
+type configContext string
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (c *configContext) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(data, []byte(`"`)) {
+		return json.Unmarshal(data, (*string)(c))
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return err
+	}
+	if _, err := strconv.ParseUint(n.String(), 10, 64); err != nil {
+		return fmt.Errorf("context %s is not a whole number", n)
+	}
+	*c = configContext(n)
+	return nil
+}
+
+// NewFromConfigFile creates a Provider from a JSON, YAML or TOML file,
+// selected by the .json, .yaml/.yml or .toml extension, and validates it.
+// The keys are username, password, context, endpoint, dry_run and
+// max_retries. Instead of username and password, username_file and
+// password_file can name files that hold the secret; relative paths are
+// resolved against the directory of the config file.
+func NewFromConfigFile(path string) (*Provider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// YAML and TOML are converted to JSON so all formats share the same
+	// keys and strict decoding
+	var doc any
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("config %s: %v", path, err)
+		}
+	case ".toml":
+		if _, err := toml.Decode(string(data), &doc); err != nil {
+			return nil, fmt.Errorf("config %s: %v", path, err)
+		}
+	default:
+		return nil, fmt.Errorf("config %s: unknown format %q; use .json, .yaml, .yml or .toml", path, ext)
+	}
+	if doc != nil {
+		if data, err = json.Marshal(doc); err != nil {
+			return nil, fmt.Errorf("config %s: %v", path, err)
+		}
+	}
+
+	var cfg fileConfig
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("config %s: %v", path, err)
+	}
+
+	p := &Provider{
+		Username:   cfg.Username,
+		Password:   cfg.Password,
+		Context:    string(cfg.Context),
+		Endpoint:   cfg.Endpoint,
+		DryRun:     cfg.DryRun,
+		MaxRetries: cfg.MaxRetries,
+	}
+	for _, secret := range []struct {
+		key        string
+		file, dest *string
+	}{
+		{"username", &cfg.UsernameFile, &p.Username},
+		{"password", &cfg.PasswordFile, &p.Password},
+	} {
+		if *secret.file == "" {
+			continue
+		}
+		if *secret.dest != "" {
+			return nil, fmt.Errorf("config %s: both %s and %s_file are set", path, secret.key, secret.key)
+		}
+		if !filepath.IsAbs(*secret.file) {
+			*secret.file = filepath.Join(filepath.Dir(path), *secret.file)
+		}
+		if *secret.dest, err = readSecretFile(*secret.file); err != nil {
+			return nil, fmt.Errorf("config %s: %s_file: %v", path, secret.key, err)
+		}
+	}
+
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("config %s: %w", path, err)
+	}
+	p.CredentialSource = secretFileSource(p, cfg.UsernameFile, cfg.PasswordFile)
+	return p, nil
+}
@@ -0,0 +1,147 @@
+package autodns
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewFromEnv(t *testing.T) {
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "password")
+	if err := os.WriteFile(secret, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		want *Provider
+		err  string
+	}{
+		{
+			name: "Plain",
+			env:  map[string]string{EnvUsername: "user", EnvPassword: "secret", EnvContext: "1", EnvDryRun: "true"},
+			want: &Provider{Username: "user", Password: "secret", Context: "1", Endpoint: defaultEndpoint, DryRun: true},
+		},
+		{
+			name: "SecretFile",
+			env:  map[string]string{EnvUsername: "user", EnvPassword + "_FILE": secret},
+			want: &Provider{Username: "user", Password: "from-file", Context: defaultContext, Endpoint: defaultEndpoint},
+		},
+		{
+			name: "MissingPassword",
+			env:  map[string]string{EnvUsername: "user"},
+			err:  "password is required: set AUTODNS_PASSWORD or AUTODNS_PASSWORD_FILE",
+		},
+		{
+			name: "BothSet",
+			env:  map[string]string{EnvUsername: "user", EnvPassword: "secret", EnvPassword + "_FILE": secret},
+			err:  "both AUTODNS_PASSWORD and AUTODNS_PASSWORD_FILE are set",
+		},
+		{
+			name: "MissingFile",
+			env:  map[string]string{EnvUsername: "user", EnvPassword + "_FILE": filepath.Join(dir, "missing")},
+			err:  "AUTODNS_PASSWORD_FILE:",
+		},
+		{
+			name: "BadDryRun",
+			env:  map[string]string{EnvUsername: "user", EnvPassword: "secret", EnvDryRun: "maybe"},
+			err:  "invalid AUTODNS_DRY_RUN",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := newFromEnv(func(key string) (string, bool) {
+				value, ok := tt.env[key]
+				return value, ok
+			})
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Expected error containing %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("newFromEnv failed: %v", err)
+			}
+			if p.Username != tt.want.Username || p.Password != tt.want.Password || p.Context != tt.want.Context ||
+				p.Endpoint != tt.want.Endpoint || p.DryRun != tt.want.DryRun {
+				t.Errorf("Expected %s/%s/%s/%s/%v, got %s/%s/%s/%s/%v",
+					tt.want.Username, tt.want.Password, tt.want.Context, tt.want.Endpoint, tt.want.DryRun,
+					p.Username, p.Password, p.Context, p.Endpoint, p.DryRun)
+			}
+		})
+	}
+}
+
+func TestLoadEnv(t *testing.T) {
+	// Unset variables keep the fields, and credentials are not required
+	p := &Provider{Username: "flag-user", Password: "flag-secret", Endpoint: "https://api.demo.autodns.com/v1"}
+	env := map[string]string{EnvContext: "1"}
+	err := p.loadEnv(func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	})
+	if err != nil {
+		t.Fatalf("loadEnv failed: %v", err)
+	}
+	if p.Username != "flag-user" || p.Password != "flag-secret" || p.Context != "1" || p.Endpoint != "https://api.demo.autodns.com/v1" {
+		t.Errorf("Unexpected provider %s/%s/%s/%s", p.Username, p.Password, p.Context, p.Endpoint)
+	}
+}
+
+func TestNewFromConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "password.txt"), []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		"config.json": `{"username": "user", "password_file": "password.txt", "context": "1"}`,
+		"config.yaml": "username: user\npassword_file: password.txt\ncontext: \"1\"\n",
+		"config.toml": "username = \"user\"\npassword_file = \"password.txt\"\ncontext = \"1\"\n",
+		// The context is a number and may be written unquoted
+		"number.json": `{"username": "user", "password_file": "password.txt", "context": 1}`,
+		"number.yaml": "username: user\npassword_file: password.txt\ncontext: 1\n",
+		"number.toml": "username = \"user\"\npassword_file = \"password.txt\"\ncontext = 1\n",
+	}
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name)
+			if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			p, err := NewFromConfigFile(path)
+			if err != nil {
+				t.Fatalf("NewFromConfigFile failed: %v", err)
+			}
+			if p.Username != "user" || p.Password != "from-file" || p.Context != "1" || p.Endpoint != defaultEndpoint {
+				t.Errorf("Unexpected provider %s/%s/%s/%s", p.Username, p.Password, p.Context, p.Endpoint)
+			}
+		})
+	}
+
+	errorFiles := []struct {
+		name, content, err string
+	}{
+		{"typo.yaml", "username: user\npasword: secret\n", `unknown field "pasword"`},
+		{"missing.toml", "username = \"user\"\n", "password is required"},
+		{"both.json", `{"username": "u", "password": "p", "password_file": "password.txt"}`, "both password and password_file are set"},
+		{"config.ini", "username=user", "unknown format"},
+		{"fraction.yaml", "username: user\npassword: secret\ncontext: 1.5\n", "not a whole number"},
+	}
+	for _, tt := range errorFiles {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name)
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			_, err := NewFromConfigFile(path)
+			if err == nil || !strings.Contains(err.Error(), tt.err) || !strings.Contains(err.Error(), tt.name) {
+				t.Errorf("Expected error about %s containing %q, got %v", tt.name, tt.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package autodns
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Credentials are the AutoDNS user and password used for Basic
+// Authentication.
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// CredentialSource supplies the credentials for each API request, so they
+// can be rotated without restarting the process. Implementations must be
+// safe for concurrent use.
+type CredentialSource interface {
+	Credentials(ctx context.Context) (Credentials, error)
+}
+
+// credentials returns the credentials for the next request, from the
+// CredentialSource if one is set and from Username and Password otherwise
+func (p *Provider) credentials(ctx context.Context) (Credentials, error) {
+	if p.CredentialSource == nil {
+		return Credentials{Username: p.Username, Password: p.Password}, nil
+	}
+
+	creds, err := p.CredentialSource.Credentials(ctx)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("failed to get credentials: %v", err)
+	}
+	if creds.Username == "" || creds.Password == "" {
+		return Credentials{}, fmt.Errorf("failed to get credentials: username and password are required")
+	}
+	return creds, nil
+}
+
+// StaticCredentials is a CredentialSource with fixed values.
+type StaticCredentials Credentials
+
+// Credentials implements CredentialSource.
+func (s StaticCredentials) Credentials(context.Context) (Credentials, error) {
+	return Credentials(s), nil
+}
+
+// EnvCredentials reads the credentials from environment variables on every
+// request. Like NewFromEnv, each variable can instead be given with the
+// _FILE suffix naming a file that holds the value.
+type EnvCredentials struct {
+	// UsernameVar defaults to AUTODNS_USERNAME
+	UsernameVar string
+	// PasswordVar defaults to AUTODNS_PASSWORD
+	PasswordVar string
+}
+
+// Credentials implements CredentialSource.
+func (e EnvCredentials) Credentials(context.Context) (Credentials, error) {
+	usernameVar, passwordVar := e.UsernameVar, e.PasswordVar
+	if usernameVar == "" {
+		usernameVar = EnvUsername
+	}
+	if passwordVar == "" {
+		passwordVar = EnvPassword
+	}
+
+	username, err := lookupEnv(os.LookupEnv, usernameVar)
+	if err != nil {
+		return Credentials{}, err
+	}
+	password, err := lookupEnv(os.LookupEnv, passwordVar)
+	if err != nil {
+		return Credentials{}, err
+	}
+	return Credentials{Username: username, Password: password}, nil
+}
+
+// FileCredentials reads the credentials from files, such as mounted
+// Kubernetes secrets. A file is read again when its modification time or
+// size changes, so rotated secrets are picked up by the next request.
+type FileCredentials struct {
+	// Username is used when UsernameFile is empty
+	Username string
+	// UsernameFile holds the username (optional)
+	UsernameFile string
+	// PasswordFile holds the password
+	PasswordFile string
+
+	mu       sync.Mutex
+	username cachedFile
+	password cachedFile
+}
+
+// cachedFile is the last read content of a file
+type cachedFile struct {
+	modTime time.Time
+	size    int64
+	value   string
+}
+
+// Credentials implements CredentialSource.
+func (f *FileCredentials) Credentials(context.Context) (Credentials, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	creds := Credentials{Username: f.Username}
+	if f.UsernameFile != "" {
+		username, err := f.username.read(f.UsernameFile)
+		if err != nil {
+			return Credentials{}, err
+		}
+		creds.Username = username
+	}
+	if f.PasswordFile == "" {
+		return Credentials{}, fmt.Errorf("password file is required")
+	}
+	password, err := f.password.read(f.PasswordFile)
+	if err != nil {
+		return Credentials{}, err
+	}
+	creds.Password = password
+	return creds, nil
+}
+
+// read returns the content of path, reading it only if it changed since
+// the last call
+func (c *cachedFile) read(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if info.ModTime().Equal(c.modTime) && info.Size() == c.size {
+		return c.value, nil
+	}
+
+	value, err := readSecretFile(path)
+	if err != nil {
+		return "", err
+	}
+	*c = cachedFile{modTime: info.ModTime(), size: info.Size(), value: value}
+	return value, nil
+}
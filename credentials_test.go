@@ -0,0 +1,90 @@
+package autodns
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileCredentialsRotation(t *testing.T) {
+	ctx := context.Background()
+	api := newFakeAPI(t, testZone())
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(passwordFile, []byte("expired-password\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	provider := &Provider{
+		Endpoint:         api.URL,
+		CredentialSource: &FileCredentials{Username: "user", PasswordFile: passwordFile},
+	}
+
+	if _, err := provider.GetRecords(ctx, "example.com"); err == nil || !strings.Contains(err.Error(), "HTTP 401") {
+		t.Fatalf("Expected the expired password to be rejected, got %v", err)
+	}
+
+	// The secret manager rotates the password; the next call picks it up
+	if err := os.WriteFile(passwordFile, []byte("secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(passwordFile, future, future); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := provider.GetRecords(ctx, "example.com"); err != nil {
+		t.Fatalf("Expected the rotated password to be used, got %v", err)
+	}
+}
+
+func TestCredentialSources(t *testing.T) {
+	ctx := context.Background()
+
+	creds, err := StaticCredentials{Username: "user", Password: "secret"}.Credentials(ctx)
+	if err != nil || creds.Username != "user" || creds.Password != "secret" {
+		t.Errorf("StaticCredentials: got %+v, %v", creds, err)
+	}
+
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "password")
+	if err := os.WriteFile(secret, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DNS_USER", "env-user")
+	t.Setenv("DNS_PASSWORD_FILE", secret)
+	creds, err = EnvCredentials{UsernameVar: "DNS_USER", PasswordVar: "DNS_PASSWORD"}.Credentials(ctx)
+	if err != nil || creds.Username != "env-user" || creds.Password != "from-file" {
+		t.Errorf("EnvCredentials: got %+v, %v", creds, err)
+	}
+
+	// An incomplete source fails the request before it is sent
+	api := newFakeAPI(t, testZone())
+	provider := &Provider{Endpoint: api.URL, CredentialSource: StaticCredentials{Username: "user"}}
+	if _, err := provider.GetRecords(ctx, "example.com"); err == nil || !strings.Contains(err.Error(), "failed to get credentials") {
+		t.Errorf("Expected a credentials error, got %v", err)
+	}
+	if len(api.Requests()) != 0 {
+		t.Errorf("Expected no request, got %v", api.Requests())
+	}
+}
+
+func TestNewFromEnvUsesSecretFiles(t *testing.T) {
+	secret := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(secret, []byte("secret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	env := map[string]string{EnvUsername: "user", EnvPassword + "_FILE": secret}
+	p, err := newFromEnv(func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	})
+	if err != nil {
+		t.Fatalf("newFromEnv failed: %v", err)
+	}
+	source, ok := p.CredentialSource.(*FileCredentials)
+	if !ok || source.PasswordFile != secret || source.Username != "user" {
+		t.Errorf("Expected a FileCredentials source for the secret file, got %#v", p.CredentialSource)
+	}
+}
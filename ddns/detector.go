@@ -0,0 +1,168 @@
+package ddns
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// Network selects the address family to detect.
+type Network string
+
+// Address families
+const (
+	IPv4 Network = "ip4"
+	IPv6 Network = "ip6"
+)
+
+// recordType returns the DNS record type for addresses of the family
+func (n Network) recordType() string {
+	if n == IPv6 {
+		return "AAAA"
+	}
+	return "A"
+}
+
+// matches reports whether addr belongs to the family
+func (n Network) matches(addr netip.Addr) bool {
+	if n == IPv6 {
+		return addr.Is6() && !addr.Is4In6()
+	}
+	return addr.Unmap().Is4()
+}
+
+// Detector finds the public address of this site. Implementations must be
+// safe for concurrent use.
+type Detector interface {
+	Detect(ctx context.Context, network Network) (netip.Addr, error)
+}
+
+// DetectorFunc adapts a function to the Detector interface, e.g. to use a
+// fixed address in tests.
+type DetectorFunc func(ctx context.Context, network Network) (netip.Addr, error)
+
+// Detect implements Detector.
+func (f DetectorFunc) Detect(ctx context.Context, network Network) (netip.Addr, error) {
+	return f(ctx, network)
+}
+
+// sharedAddressSpace is used for carrier-grade NAT (RFC 6598)
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// isPublic reports whether addr is routable on the internet
+func isPublic(addr netip.Addr) bool {
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !sharedAddressSpace.Contains(addr)
+}
+
+// InterfaceDetector reads the address of a local network interface, for
+// hosts that are directly connected, e.g. IPv6 hosts behind a router that
+// does not translate addresses.
+type InterfaceDetector struct {
+	// Name is the interface name, e.g. "eth0"
+	Name string
+}
+
+// Detect implements Detector. It returns the first public address of the
+// interface in the family.
+func (d InterfaceDetector) Detect(_ context.Context, network Network) (netip.Addr, error) {
+	iface, err := net.InterfaceByName(d.Name)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("interface %s: %v", d.Name, err)
+	}
+
+	var prefixes []netip.Prefix
+	for _, addr := range addrs {
+		if prefix, err := netip.ParsePrefix(addr.String()); err == nil {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return publicAddr(prefixes, network, "interface "+d.Name)
+}
+
+// publicAddr returns the first public address of the family among prefixes
+func publicAddr(prefixes []netip.Prefix, network Network, source string) (netip.Addr, error) {
+	for _, prefix := range prefixes {
+		addr := prefix.Addr().Unmap()
+		if network.matches(addr) && isPublic(addr) {
+			return addr, nil
+		}
+	}
+	return netip.Addr{}, fmt.Errorf("%s has no public %s address", source, network.recordType())
+}
+
+// DefaultHTTPDetectorURL answers with the client address over IPv4 and IPv6.
+const DefaultHTTPDetectorURL = "https://api64.ipify.org"
+
+// HTTPDetector asks an echo service for the address requests come from.
+// The service must answer with the address as plain text. The connection
+// is made over the requested family, so a service reachable over IPv4 and
+// IPv6 detects both.
+type HTTPDetector struct {
+	// URL of the echo service; defaults to DefaultHTTPDetectorURL
+	URL string
+	// Timeout of the request; defaults to 10 seconds
+	Timeout time.Duration
+}
+
+// Detect implements Detector.
+func (d HTTPDetector) Detect(ctx context.Context, network Network) (netip.Addr, error) {
+	url := d.URL
+	if url == "" {
+		url = DefaultHTTPDetectorURL
+	}
+	timeout := d.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+
+	dialer := &net.Dialer{Timeout: timeout}
+	tcp := "tcp4"
+	if network == IPv6 {
+		tcp = "tcp6"
+	}
+	client := &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, addr string) (net.Conn, error) {
+				return dialer.DialContext(ctx, tcp, addr)
+			},
+		},
+	}
+	defer client.CloseIdleConnections()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return netip.Addr{}, fmt.Errorf("%s: unexpected status %s", url, resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 256))
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	addr, err := netip.ParseAddr(strings.TrimSpace(string(body)))
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("%s: invalid address %q", url, strings.TrimSpace(string(body)))
+	}
+	addr = addr.Unmap()
+	if !network.matches(addr) {
+		return netip.Addr{}, fmt.Errorf("%s: expected an %s address, got %s", url, network.recordType(), addr)
+	}
+	return addr, nil
+}
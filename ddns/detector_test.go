@@ -0,0 +1,125 @@
+package ddns
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestHTTPDetector(t *testing.T) {
+	answer := "198.51.100.7\n"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, answer)
+	}))
+	defer server.Close()
+
+	detector := HTTPDetector{URL: server.URL}
+	addr, err := detector.Detect(context.Background(), IPv4)
+	if err != nil || addr.String() != "198.51.100.7" {
+		t.Errorf("Expected 198.51.100.7, got %v, %v", addr, err)
+	}
+
+	answer = "<html>rate limited</html>"
+	if _, err := detector.Detect(context.Background(), IPv4); err == nil || !strings.Contains(err.Error(), "invalid address") {
+		t.Errorf("Expected an invalid address error, got %v", err)
+	}
+
+	answer = "2001:db8::7"
+	if _, err := detector.Detect(context.Background(), IPv4); err == nil || !strings.Contains(err.Error(), "expected an A address") {
+		t.Errorf("Expected a family error, got %v", err)
+	}
+}
+
+func TestPublicAddr(t *testing.T) {
+	prefixes := []netip.Prefix{
+		netip.MustParsePrefix("127.0.0.1/8"),
+		netip.MustParsePrefix("192.168.1.10/24"),
+		netip.MustParsePrefix("100.64.3.4/10"),
+		netip.MustParsePrefix("fe80::1/64"),
+		netip.MustParsePrefix("fd00::1/64"),
+		netip.MustParsePrefix("2001:db8::7/64"),
+		netip.MustParsePrefix("198.51.100.7/24"),
+	}
+	for network, want := range map[Network]string{IPv4: "198.51.100.7", IPv6: "2001:db8::7"} {
+		addr, err := publicAddr(prefixes, network, "test")
+		if err != nil || addr.String() != want {
+			t.Errorf("%s: expected %s, got %v, %v", network, want, addr, err)
+		}
+	}
+
+	if _, err := publicAddr(prefixes[:5], IPv4, "interface lo"); err == nil || err.Error() != "interface lo has no public A address" {
+		t.Errorf("Expected no public address, got %v", err)
+	}
+}
+
+// newTestGateway serves a FritzBox-like device description and the
+// WANIPConnection control endpoint
+func newTestGateway(t *testing.T, external string) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /igddesc.xml", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `<?xml version="1.0"?>
+<root xmlns="urn:schemas-upnp-org:device-1-0">
+  <device>
+    <deviceType>urn:schemas-upnp-org:device:InternetGatewayDevice:1</deviceType>
+    <deviceList>
+      <device>
+        <deviceType>urn:schemas-upnp-org:device:WANDevice:1</deviceType>
+        <deviceList>
+          <device>
+            <deviceType>urn:schemas-upnp-org:device:WANConnectionDevice:1</deviceType>
+            <serviceList>
+              <service>
+                <serviceType>urn:schemas-upnp-org:service:WANIPConnection:1</serviceType>
+                <controlURL>/igdupnp/control/WANIPConn1</controlURL>
+              </service>
+            </serviceList>
+          </device>
+        </deviceList>
+      </device>
+    </deviceList>
+  </device>
+</root>`)
+	})
+	mux.HandleFunc("POST /igdupnp/control/WANIPConn1", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("SOAPAction") != `"urn:schemas-upnp-org:service:WANIPConnection:1#GetExternalIPAddress"` {
+			http.Error(w, "unknown action", http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintf(w, `<?xml version="1.0"?>
+<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/">
+  <s:Body>
+    <u:GetExternalIPAddressResponse xmlns:u="urn:schemas-upnp-org:service:WANIPConnection:1">
+      <NewExternalIPAddress>%s</NewExternalIPAddress>
+    </u:GetExternalIPAddressResponse>
+  </s:Body>
+</s:Envelope>`, external)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestUPnPDetector(t *testing.T) {
+	gateway := newTestGateway(t, "198.51.100.7")
+	detector := UPnPDetector{Location: gateway.URL + "/igddesc.xml"}
+
+	addr, err := detector.Detect(context.Background(), IPv4)
+	if err != nil || addr.String() != "198.51.100.7" {
+		t.Errorf("Expected 198.51.100.7, got %v, %v", addr, err)
+	}
+	if _, err := detector.Detect(context.Background(), IPv6); err == nil {
+		t.Error("Expected UPnP to reject IPv6")
+	}
+
+	// A router behind carrier-grade NAT does not know the public address
+	gateway = newTestGateway(t, "100.64.12.34")
+	detector = UPnPDetector{Location: gateway.URL + "/igddesc.xml"}
+	if _, err := detector.Detect(context.Background(), IPv4); err == nil || !strings.Contains(err.Error(), "non-public") {
+		t.Errorf("Expected a non-public address error, got %v", err)
+	}
+}
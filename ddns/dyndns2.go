@@ -0,0 +1,302 @@
+package ddns
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/libdns/libdns"
+	autodns "github.com/saveenergy/libdns-autodns"
+	"gopkg.in/yaml.v3"
+)
+
+// Host is a hostname that DynDNS2 clients may update, with the credentials
+// they authenticate with.
+type Host struct {
+	// Hostname is the fully qualified name, e.g. "office.example.com"
+	Hostname string `yaml:"hostname"`
+	// Zone is the AutoDNS zone holding the name, e.g. "example.com"
+	Zone string `yaml:"zone"`
+	// Username and Password are the credentials of this host only
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	// TTL of the records; defaults to DefaultTTL
+	TTL time.Duration `yaml:"ttl"`
+}
+
+// LoadHosts reads a list of hosts from a YAML or JSON file:
+//
+//	# hosts.yaml
+//	- hostname: office.example.com
+//	  zone: example.com
+//	  username: office
+//	  password: secret
+//	  ttl: 5m
+func LoadHosts(path string) ([]Host, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var hosts []Host
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&hosts); err != nil {
+		return nil, fmt.Errorf("hosts %s: %v", path, err)
+	}
+
+	seen := make(map[string]bool)
+	for i, host := range hosts {
+		if host.Hostname == "" || host.Zone == "" || host.Username == "" || host.Password == "" {
+			return nil, fmt.Errorf("hosts %s: entry %d: hostname, zone, username and password are required", path, i+1)
+		}
+		name := canonicalHostname(host.Hostname)
+		if name != canonicalHostname(host.Zone) && !strings.HasSuffix(name, "."+canonicalHostname(host.Zone)) {
+			return nil, fmt.Errorf("hosts %s: %s is not in zone %s", path, host.Hostname, host.Zone)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("hosts %s: %s is listed twice", path, host.Hostname)
+		}
+		seen[name] = true
+	}
+	return hosts, nil
+}
+
+// DynDNS2 return codes
+const (
+	dyndnsGood    = "good"
+	dyndnsNoChg   = "nochg"
+	dyndnsBadAuth = "badauth"
+	dyndnsNotFQDN = "notfqdn"
+	dyndnsNoHost  = "nohost"
+	dyndnsNumHost = "numhost"
+	dyndnsDNSErr  = "dnserr"
+	dyndnsError   = "911"
+)
+
+// maxHostnames limits the hostnames of one update request
+const maxHostnames = 20
+
+// DynDNS2Handler serves the DynDNS2 update protocol (/nic/update) spoken by
+// routers such as FritzBox and OpenWrt's ddns-scripts, and applies the
+// updates with SetRecords. Every host has its own credentials, so a client
+// can only update the hostnames it was given.
+type DynDNS2Handler struct {
+	// Provider writes the records
+	Provider *autodns.Provider
+	// Hosts lists the hostnames that may be updated
+	Hosts []Host
+	// TrustProxy takes the client address from X-Forwarded-For when the
+	// request has no myip parameter; only enable it behind a reverse proxy
+	TrustProxy bool
+	// Logger receives diagnostics; nil discards them (optional)
+	Logger *slog.Logger
+}
+
+// ServeHTTP implements http.Handler. The request parameters are:
+//
+//	hostname  comma-separated hostnames to update
+//	myip      comma-separated IPv4 and/or IPv6 address; defaults to the
+//	          client address
+//	myipv6    IPv6 address, as sent by some routers
+//
+// The response has one line per hostname with "good <ip>", "nochg <ip>",
+// "nohost", "notfqdn" or "dnserr", or a single "badauth", "numhost" or
+// "911" line for the whole request.
+func (h *DynDNS2Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	ctx := r.Context()
+
+	username, password, ok := r.BasicAuth()
+	if !ok || !h.authenticate(username, password) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="DynDNS"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintln(w, dyndnsBadAuth)
+		return
+	}
+
+	query := r.URL.Query()
+	hostnames := strings.Split(query.Get("hostname"), ",")
+	if len(hostnames) > maxHostnames {
+		fmt.Fprintln(w, dyndnsNumHost)
+		return
+	}
+
+	addrs, err := h.requestAddrs(r)
+	if err != nil {
+		h.logger().WarnContext(ctx, "invalid dyndns2 request", "username", username, "error", err)
+		fmt.Fprintln(w, dyndnsError)
+		return
+	}
+
+	for _, hostname := range hostnames {
+		fmt.Fprintln(w, h.update(r, username, strings.TrimSpace(hostname), addrs))
+	}
+}
+
+// update sets the records of one hostname and returns its response line
+func (h *DynDNS2Handler) update(r *http.Request, username, hostname string, addrs []netip.Addr) string {
+	ctx := r.Context()
+	if !strings.Contains(strings.Trim(hostname, "."), ".") {
+		return dyndnsNotFQDN
+	}
+	host, ok := h.host(hostname)
+	if !ok || subtle.ConstantTimeCompare([]byte(host.Username), []byte(username)) != 1 {
+		return dyndnsNoHost
+	}
+
+	name := libdns.RelativeName(canonicalHostname(host.Hostname)+".", canonicalHostname(host.Zone)+".")
+	current, err := h.Provider.GetRecords(ctx, host.Zone)
+	if err != nil {
+		h.logger().ErrorContext(ctx, "dyndns2 update failed", "hostname", hostname, "error", err)
+		return dyndnsDNSErr
+	}
+
+	var records []libdns.Record
+	for _, addr := range addrs {
+		if !slices.Equal(addressesOf(current, name, addr), []netip.Addr{addr}) {
+			records = append(records, libdns.Address{Name: recordName(name), IP: addr, TTL: withDefault(host.TTL, DefaultTTL)})
+		}
+	}
+	result := joinAddrs(addrs)
+	if len(records) == 0 {
+		return dyndnsNoChg + " " + result
+	}
+
+	if _, err := h.Provider.SetRecords(ctx, host.Zone, records); err != nil {
+		h.logger().ErrorContext(ctx, "dyndns2 update failed", "hostname", hostname, "error", err)
+		return dyndnsDNSErr
+	}
+	h.logger().InfoContext(ctx, "dyndns2 update", "hostname", hostname, "addresses", result)
+	return dyndnsGood + " " + result
+}
+
+// authenticate reports whether the credentials belong to any host, so that
+// a client with valid credentials learns about hostnames it cannot update
+// and others are rejected outright
+func (h *DynDNS2Handler) authenticate(username, password string) bool {
+	ok := false
+	for _, host := range h.Hosts {
+		userOK := subtle.ConstantTimeCompare([]byte(host.Username), []byte(username))
+		passOK := subtle.ConstantTimeCompare([]byte(host.Password), []byte(password))
+		if userOK&passOK == 1 {
+			ok = true
+		}
+	}
+	return ok
+}
+
+// host returns the configured host for a hostname
+func (h *DynDNS2Handler) host(hostname string) (Host, bool) {
+	name := canonicalHostname(hostname)
+	for _, host := range h.Hosts {
+		if canonicalHostname(host.Hostname) == name {
+			return host, true
+		}
+	}
+	return Host{}, false
+}
+
+// requestAddrs returns at most one IPv4 and one IPv6 address from the myip
+// and myipv6 parameters, or the client address if there are none
+func (h *DynDNS2Handler) requestAddrs(r *http.Request) ([]netip.Addr, error) {
+	query := r.URL.Query()
+	var values []string
+	for _, param := range []string{"myip", "myipv6"} {
+		for value := range strings.SplitSeq(query.Get(param), ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+	}
+	if len(values) == 0 {
+		values = []string{h.clientAddr(r)}
+	}
+
+	var v4, v6 netip.Addr
+	for _, value := range values {
+		addr, err := netip.ParseAddr(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address %q", value)
+		}
+		addr = addr.Unmap()
+		switch {
+		case IPv4.matches(addr) && !v4.IsValid():
+			v4 = addr
+		case IPv6.matches(addr) && !v6.IsValid():
+			v6 = addr
+		default:
+			return nil, fmt.Errorf("more than one address per family in %v", values)
+		}
+	}
+
+	var addrs []netip.Addr
+	for _, addr := range []netip.Addr{v4, v6} {
+		if addr.IsValid() {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs, nil
+}
+
+// clientAddr returns the address the request came from
+func (h *DynDNS2Handler) clientAddr(r *http.Request) string {
+	if h.TrustProxy {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			first, _, _ := strings.Cut(forwarded, ",")
+			return strings.TrimSpace(first)
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func (h *DynDNS2Handler) logger() *slog.Logger {
+	if h.Logger != nil {
+		return h.Logger
+	}
+	return slog.New(slog.DiscardHandler)
+}
+
+// addressesOf returns the addresses of the records named name in the
+// family of addr
+func addressesOf(records []libdns.Record, name string, addr netip.Addr) []netip.Addr {
+	var addrs []netip.Addr
+	for _, record := range records {
+		address, ok := record.(libdns.Address)
+		if ok && sameName(address.Name, name) && IPv4.matches(address.IP) == IPv4.matches(addr) {
+			addrs = append(addrs, address.IP.Unmap())
+		}
+	}
+	return addrs
+}
+
+// sameName compares relative record names, treating "" and "@" as the apex
+func sameName(a, b string) bool {
+	return strings.EqualFold(recordName(a), recordName(b))
+}
+
+// canonicalHostname lowercases a name and drops the trailing dot
+func canonicalHostname(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
+
+// joinAddrs formats addresses the way DynDNS2 responses list them
+func joinAddrs(addrs []netip.Addr) string {
+	s := make([]string, len(addrs))
+	for i, addr := range addrs {
+		s[i] = addr.String()
+	}
+	return strings.Join(s, ",")
+}
@@ -0,0 +1,149 @@
+package ddns
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/saveenergy/libdns-autodns/internal/autodnstest"
+)
+
+func newTestHandler(t *testing.T) (*DynDNS2Handler, func() []string) {
+	api := autodnstest.NewServer(t, testZone())
+	h := &DynDNS2Handler{
+		Provider: api.Provider(),
+		Hosts: []Host{
+			{Hostname: "office.example.com", Zone: "example.com", Username: "office", Password: "office-secret", TTL: time.Minute},
+			{Hostname: "example.com", Zone: "example.com", Username: "apex", Password: "apex-secret"},
+		},
+	}
+	return h, func() []string { return values(api.Zone("example.com")) }
+}
+
+// update sends a dyndns2 request and returns the status and body
+func update(t *testing.T, h http.Handler, username, password, query string) (int, string) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/nic/update?"+query, nil)
+	req.RemoteAddr = "198.51.100.99:40000"
+	if username != "" {
+		req.SetBasicAuth(username, password)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	body, _ := io.ReadAll(rec.Body)
+	return rec.Code, string(body)
+}
+
+func TestDynDNS2Update(t *testing.T) {
+	h, zone := newTestHandler(t)
+
+	if code, body := update(t, h, "office", "office-secret", "hostname=office.example.com&myip=198.51.100.7,2001:db8::7"); code != 200 || body != "good 198.51.100.7,2001:db8::7\n" {
+		t.Fatalf("Expected good, got %d %q", code, body)
+	}
+	want := []string{" A 192.0.2.1", "office A 198.51.100.7", "office AAAA 2001:db8::7", "www A 192.0.2.1"}
+	if got := zone(); !slices.Equal(got, want) {
+		t.Fatalf("Expected %v, got %v", want, got)
+	}
+
+	// Repeating the update does not write the zone
+	if _, body := update(t, h, "office", "office-secret", "hostname=office.example.com&myip=198.51.100.7&myipv6=2001:db8::7"); body != "nochg 198.51.100.7,2001:db8::7\n" {
+		t.Errorf("Expected nochg, got %q", body)
+	}
+
+	// Without myip the client address is used; the apex is replaced
+	if _, body := update(t, h, "apex", "apex-secret", "hostname=example.com"); body != "good 198.51.100.99\n" {
+		t.Errorf("Expected the client address, got %q", body)
+	}
+	want = []string{" A 198.51.100.99", "office A 198.51.100.7", "office AAAA 2001:db8::7", "www A 192.0.2.1"}
+	if got := zone(); !slices.Equal(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestDynDNS2Errors(t *testing.T) {
+	h, zone := newTestHandler(t)
+	before := zone()
+
+	tests := []struct {
+		username, password, query string
+		code                      int
+		body                      string
+	}{
+		{"", "", "hostname=office.example.com", 401, "badauth\n"},
+		{"office", "wrong", "hostname=office.example.com", 401, "badauth\n"},
+		{"office", "office-secret", "hostname=www.example.com", 200, "nohost\n"},
+		{"office", "office-secret", "hostname=example.com", 200, "nohost\n"},
+		{"office", "office-secret", "hostname=office", 200, "notfqdn\n"},
+		{"office", "office-secret", "hostname=office.example.com&myip=not-an-ip", 200, "911\n"},
+		{"office", "office-secret", "hostname=office.example.com&myip=198.51.100.7,198.51.100.8", 200, "911\n"},
+		{"office", "office-secret", "hostname=" + strings.Repeat("office.example.com,", 21), 200, "numhost\n"},
+		{"office", "office-secret", "hostname=OFFICE.example.com.,www.example.com&myip=198.51.100.7", 200, "good 198.51.100.7\nnohost\n"},
+	}
+	for _, tt := range tests {
+		code, body := update(t, h, tt.username, tt.password, tt.query)
+		if code != tt.code || body != tt.body {
+			t.Errorf("%s:%s %s: expected %d %q, got %d %q", tt.username, tt.password, tt.query, tt.code, tt.body, code, body)
+		}
+	}
+	if got := zone(); slices.Contains(got, "www A 198.51.100.7") || len(got) != len(before) {
+		t.Errorf("Expected only office to change, got %v", got)
+	}
+}
+
+func TestDynDNS2TrustProxy(t *testing.T) {
+	h, _ := newTestHandler(t)
+	h.TrustProxy = true
+
+	req := httptest.NewRequest(http.MethodGet, "/nic/update?hostname=office.example.com", nil)
+	req.SetBasicAuth("office", "office-secret")
+	req.Header.Set("X-Forwarded-For", "203.0.113.5, 10.0.0.1")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Body.String() != "good 203.0.113.5\n" {
+		t.Errorf("Expected the forwarded address, got %q", rec.Body.String())
+	}
+}
+
+func TestLoadHosts(t *testing.T) {
+	dir := t.TempDir()
+	write := func(content string) string {
+		path := filepath.Join(dir, "hosts.yaml")
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	hosts, err := LoadHosts(write(`
+- hostname: office.example.com
+  zone: example.com
+  username: office
+  password: secret
+  ttl: 2m
+`))
+	if err != nil || len(hosts) != 1 || hosts[0].TTL != 2*time.Minute || hosts[0].Username != "office" {
+		t.Errorf("Unexpected hosts %+v, %v", hosts, err)
+	}
+
+	// JSON is valid YAML
+	if hosts, err := LoadHosts(write(`[{"hostname": "example.com", "zone": "example.com", "username": "a", "password": "b"}]`)); err != nil || len(hosts) != 1 {
+		t.Errorf("Unexpected hosts %+v, %v", hosts, err)
+	}
+
+	for content, want := range map[string]string{
+		`[{hostname: office.example.com, zone: example.com, username: a}]`:                                                                                    "password are required",
+		`[{hostname: office.example.org, zone: example.com, username: a, password: b}]`:                                                                       "not in zone",
+		`[{hostname: office.example.com, zone: example.com, username: a, password: b, user: c}]`:                                                              "field user not found",
+		"- {hostname: a.example.com, zone: example.com, username: a, password: b}\n- {hostname: A.example.com., zone: example.com, username: c, password: d}": "listed twice",
+	} {
+		if _, err := LoadHosts(write(content)); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected %q, got %v", content, want, err)
+		}
+	}
+}
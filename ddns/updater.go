@@ -0,0 +1,261 @@
+// Package ddns keeps A and AAAA records in AutoDNS pointed at a site with a
+// dynamic address.
+//
+// An Updater detects the public IPv4 and IPv6 address with a Detector and
+// sets the configured names whenever an address changes:
+//
+//	updater := &ddns.Updater{
+//		Provider: provider,
+//		Zone:     "example.com",
+//		Names:    []string{"office", "vpn.office"},
+//		IPv4:     ddns.HTTPDetector{},
+//		IPv6:     ddns.InterfaceDetector{Name: "eth0"},
+//	}
+//	err := updater.Run(ctx)
+package ddns
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/libdns/libdns"
+	autodns "github.com/saveenergy/libdns-autodns"
+)
+
+// Updater defaults
+const (
+	DefaultTTL        = 5 * time.Minute
+	DefaultInterval   = 5 * time.Minute
+	DefaultMinBackoff = 30 * time.Second
+	DefaultMaxBackoff = 30 * time.Minute
+)
+
+// Updater sets A and AAAA records to the detected public address.
+type Updater struct {
+	// Provider writes the records
+	Provider *autodns.Provider
+	// Zone holding the records
+	Zone string
+	// Names of the records relative to Zone; "@" is the zone apex
+	Names []string
+	// IPv4 detects the address for A records; nil skips IPv4
+	IPv4 Detector
+	// IPv6 detects the address for AAAA records; nil skips IPv6
+	IPv6 Detector
+	// TTL of the records; defaults to DefaultTTL
+	TTL time.Duration
+	// Interval between checks; defaults to DefaultInterval
+	Interval time.Duration
+	// MinBackoff is the first delay after a failed check; it doubles with
+	// every further failure up to MaxBackoff
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// StateFile keeps the published addresses across restarts, so a
+	// restart does not update unchanged records (optional)
+	StateFile string
+	// Logger receives diagnostics; nil discards them (optional)
+	Logger *slog.Logger
+
+	mu     sync.Mutex
+	state  State
+	loaded bool
+}
+
+// State is the last published address of each family and the records it
+// was published to.
+type State struct {
+	Zone    string     `json:"zone"`
+	Names   []string   `json:"names"`
+	IPv4    netip.Addr `json:"ipv4,omitzero"`
+	IPv6    netip.Addr `json:"ipv6,omitzero"`
+	Updated time.Time  `json:"updated,omitzero"`
+}
+
+// Run checks the address every Interval until ctx is done. Failed checks
+// are retried with exponential backoff. It returns ctx.Err().
+func (u *Updater) Run(ctx context.Context) error {
+	interval := withDefault(u.Interval, DefaultInterval)
+	minBackoff := withDefault(u.MinBackoff, DefaultMinBackoff)
+	maxBackoff := max(withDefault(u.MaxBackoff, DefaultMaxBackoff), minBackoff)
+
+	backoff := minBackoff
+	for {
+		wait := interval
+		if _, err := u.Update(ctx); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			wait = backoff
+			backoff = min(2*backoff, maxBackoff)
+			u.logger().WarnContext(ctx, "address update failed", "zone", u.Zone, "retry", wait, "error", err)
+		} else {
+			backoff = minBackoff
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Update detects the addresses once and sets the records of every family
+// whose address changed since the last update. It reports whether records
+// were set. A failing detector does not keep the other family from being
+// updated; its error is returned along with the result.
+func (u *Updater) Update(ctx context.Context) (bool, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.Provider == nil || u.Zone == "" || len(u.Names) == 0 {
+		return false, fmt.Errorf("ddns: Provider, Zone and Names are required")
+	}
+	if u.IPv4 == nil && u.IPv6 == nil {
+		return false, fmt.Errorf("ddns: at least one of IPv4 and IPv6 must have a detector")
+	}
+	if err := u.load(); err != nil {
+		return false, err
+	}
+
+	// Changing the configured records publishes the addresses again
+	next := u.state
+	if next.Zone != u.Zone || !slices.Equal(next.Names, u.Names) {
+		next = State{Zone: u.Zone, Names: slices.Clone(u.Names)}
+	}
+
+	var records []libdns.Record
+	var errs []error
+	for _, family := range []struct {
+		network  Network
+		detector Detector
+		current  *netip.Addr
+	}{
+		{IPv4, u.IPv4, &next.IPv4},
+		{IPv6, u.IPv6, &next.IPv6},
+	} {
+		if family.detector == nil {
+			continue
+		}
+		addr, err := family.detector.Detect(ctx, family.network)
+		if err == nil && !family.network.matches(addr) {
+			err = fmt.Errorf("detector returned %s", addr)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to detect %s address: %w", family.network.recordType(), err))
+			continue
+		}
+		if addr == *family.current {
+			continue
+		}
+
+		u.logger().InfoContext(ctx, "address changed", "zone", u.Zone, "type", family.network.recordType(), "old", *family.current, "new", addr)
+		*family.current = addr
+		for _, name := range u.Names {
+			records = append(records, libdns.Address{Name: recordName(name), IP: addr, TTL: withDefault(u.TTL, DefaultTTL)})
+		}
+	}
+
+	if len(records) > 0 {
+		if _, err := u.Provider.SetRecords(ctx, u.Zone, records); err != nil {
+			return false, errors.Join(append(errs, fmt.Errorf("failed to update %s: %w", u.Zone, err))...)
+		}
+		next.Updated = time.Now().UTC()
+		u.state = next
+		if err := u.save(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return len(records) > 0, errors.Join(errs...)
+}
+
+// State returns the last published addresses.
+func (u *Updater) State() (State, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if err := u.load(); err != nil {
+		return State{}, err
+	}
+	return u.state, nil
+}
+
+// recordName maps the apex to the empty name AutoDNS uses for it, so the
+// existing apex records are replaced
+func recordName(name string) string {
+	if name == "@" {
+		return ""
+	}
+	return name
+}
+
+// load reads the StateFile the first time the Updater is used
+func (u *Updater) load() error {
+	if u.loaded || u.StateFile == "" {
+		u.loaded = true
+		return nil
+	}
+
+	data, err := os.ReadFile(u.StateFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		u.loaded = true
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read ddns state: %v", err)
+	}
+	if err := json.Unmarshal(data, &u.state); err != nil {
+		return fmt.Errorf("failed to read ddns state %s: %v", u.StateFile, err)
+	}
+	u.loaded = true
+	return nil
+}
+
+// save writes the state to the StateFile, replacing it atomically
+func (u *Updater) save() error {
+	if u.StateFile == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(u.state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal ddns state: %v", err)
+	}
+	tmp := u.StateFile + ".tmp"
+	if err := os.MkdirAll(filepath.Dir(u.StateFile), 0o755); err != nil {
+		return fmt.Errorf("failed to write ddns state: %v", err)
+	}
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write ddns state: %v", err)
+	}
+	if err := os.Rename(tmp, u.StateFile); err != nil {
+		return fmt.Errorf("failed to write ddns state: %v", err)
+	}
+	return nil
+}
+
+func (u *Updater) logger() *slog.Logger {
+	if u.Logger != nil {
+		return u.Logger
+	}
+	return slog.New(slog.DiscardHandler)
+}
+
+// withDefault returns d, or def if d is not positive
+func withDefault(d, def time.Duration) time.Duration {
+	if d > 0 {
+		return d
+	}
+	return def
+}
@@ -0,0 +1,176 @@
+package ddns
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	autodns "github.com/saveenergy/libdns-autodns"
+	"github.com/saveenergy/libdns-autodns/internal/autodnstest"
+)
+
+// fakeDetector returns an address that tests can change, or an error
+type fakeDetector struct {
+	mu    sync.Mutex
+	addr  netip.Addr
+	err   error
+	calls int
+}
+
+func (d *fakeDetector) Detect(context.Context, Network) (netip.Addr, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.calls++
+	return d.addr, d.err
+}
+
+func (d *fakeDetector) set(addr string, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.addr, d.err = netip.Addr{}, err
+	if addr != "" {
+		d.addr = netip.MustParseAddr(addr)
+	}
+}
+
+// testZone returns the zone served by the fake API
+func testZone() autodns.Zone {
+	return autodns.Zone{
+		Origin: "example.com",
+		SOA:    &autodns.SOA{TTL: 86400, Email: "hostmaster@example.com"},
+		ResourceRecords: []autodns.ResourceRecord{
+			{Name: "", TTL: 300, Type: "A", Value: "192.0.2.1"},
+			{Name: "office", TTL: 300, Type: "A", Value: "192.0.2.1"},
+			{Name: "www", TTL: 300, Type: "A", Value: "192.0.2.1"},
+		},
+	}
+}
+
+// values returns the sorted "name type value" of the address records
+func values(zone autodns.Zone) []string {
+	var values []string
+	for _, rr := range zone.ResourceRecords {
+		if rr.Type == "A" || rr.Type == "AAAA" {
+			values = append(values, rr.Name+" "+rr.Type+" "+rr.Value)
+		}
+	}
+	slices.Sort(values)
+	return values
+}
+
+func TestUpdate(t *testing.T) {
+	api := autodnstest.NewServer(t, testZone())
+	v4, v6 := &fakeDetector{}, &fakeDetector{}
+	v4.set("198.51.100.7", nil)
+	v6.set("2001:db8::7", nil)
+	updater := &Updater{
+		Provider:  api.Provider(),
+		Zone:      "example.com",
+		Names:     []string{"@", "office"},
+		IPv4:      v4,
+		IPv6:      v6,
+		StateFile: filepath.Join(t.TempDir(), "state.json"),
+	}
+	ctx := context.Background()
+
+	if changed, err := updater.Update(ctx); err != nil || !changed {
+		t.Fatalf("Expected an update, got %v, %v", changed, err)
+	}
+	want := []string{" A 198.51.100.7", " AAAA 2001:db8::7", "office A 198.51.100.7", "office AAAA 2001:db8::7", "www A 192.0.2.1"}
+	if got := values(api.Zone("example.com")); !slices.Equal(got, want) {
+		t.Fatalf("Expected %v, got %v", want, got)
+	}
+
+	// Unchanged addresses do not touch the zone, even after a restart
+	requests := len(api.Requests())
+	restarted := &Updater{
+		Provider:  updater.Provider,
+		Zone:      updater.Zone,
+		Names:     updater.Names,
+		IPv4:      v4,
+		IPv6:      v6,
+		StateFile: updater.StateFile,
+	}
+	if changed, err := restarted.Update(ctx); err != nil || changed {
+		t.Fatalf("Expected no update, got %v, %v", changed, err)
+	}
+	if len(api.Requests()) != requests {
+		t.Errorf("Expected no API requests, got %v", api.Requests()[requests:])
+	}
+
+	// A failing IPv6 detector does not hold back the IPv4 update
+	v4.set("198.51.100.8", nil)
+	v6.set("", errors.New("no route"))
+	changed, err := restarted.Update(ctx)
+	if !changed || err == nil {
+		t.Fatalf("Expected an IPv4 update and an IPv6 error, got %v, %v", changed, err)
+	}
+	want = []string{" A 198.51.100.8", " AAAA 2001:db8::7", "office A 198.51.100.8", "office AAAA 2001:db8::7", "www A 192.0.2.1"}
+	if got := values(api.Zone("example.com")); !slices.Equal(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+	state, _ := restarted.State()
+	if state.IPv4.String() != "198.51.100.8" || state.IPv6.String() != "2001:db8::7" {
+		t.Errorf("Unexpected state %+v", state)
+	}
+
+	// Adding a name publishes the addresses again
+	restarted.Names = append(restarted.Names, "vpn")
+	v6.set("2001:db8::7", nil)
+	if changed, err := restarted.Update(ctx); err != nil || !changed {
+		t.Fatalf("Expected an update for the new name, got %v, %v", changed, err)
+	}
+	if got := values(api.Zone("example.com")); !slices.Contains(got, "vpn AAAA 2001:db8::7") {
+		t.Errorf("Expected the new name to be set, got %v", got)
+	}
+}
+
+func TestUpdateRejectsWrongFamily(t *testing.T) {
+	api := autodnstest.NewServer(t, testZone())
+	v4 := &fakeDetector{}
+	v4.set("2001:db8::7", nil)
+	updater := &Updater{Provider: api.Provider(), Zone: "example.com", Names: []string{"office"}, IPv4: v4}
+
+	if changed, err := updater.Update(context.Background()); changed || err == nil {
+		t.Errorf("Expected an error for an IPv6 address from the IPv4 detector, got %v, %v", changed, err)
+	}
+}
+
+func TestRunBackoff(t *testing.T) {
+	api := autodnstest.NewServer(t, testZone())
+	v4 := &fakeDetector{}
+	v4.set("", errors.New("offline"))
+	updater := &Updater{
+		Provider:   api.Provider(),
+		Zone:       "example.com",
+		Names:      []string{"office"},
+		IPv4:       v4,
+		Interval:   time.Hour,
+		MinBackoff: 10 * time.Millisecond,
+		MaxBackoff: 40 * time.Millisecond,
+	}
+
+	// Failures are retried at 10, 20, 40, 40, ... ms; once the address is
+	// detected the next check waits the full interval
+	time.AfterFunc(150*time.Millisecond, func() { v4.set("198.51.100.7", nil) })
+	ctx, cancel := context.WithTimeout(context.Background(), 400*time.Millisecond)
+	defer cancel()
+	if err := updater.Run(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected Run to stop with the context, got %v", err)
+	}
+
+	v4.mu.Lock()
+	calls := v4.calls
+	v4.mu.Unlock()
+	if calls < 4 || calls > 8 {
+		t.Errorf("Expected about 6 backed off checks, got %d", calls)
+	}
+	if got := values(api.Zone("example.com")); !slices.Contains(got, "office A 198.51.100.7") {
+		t.Errorf("Expected the address to be set after recovering, got %v", got)
+	}
+}
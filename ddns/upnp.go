@@ -0,0 +1,209 @@
+package ddns
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// UPnP Internet Gateway Device discovery
+const (
+	ssdpAddr  = "239.255.255.250:1900"
+	igdSearch = "urn:schemas-upnp-org:device:InternetGatewayDevice:1"
+)
+
+// UPnPDetector asks the router for its external IPv4 address through the
+// UPnP Internet Gateway Device protocol, as supported by FritzBox, OpenWrt
+// with miniupnpd and most home routers. It only detects IPv4.
+type UPnPDetector struct {
+	// Location is the URL of the router's device description, e.g.
+	// "http://192.168.178.1:49000/igddesc.xml"; it is discovered with SSDP
+	// when empty
+	Location string
+	// Timeout limits discovery and each request; defaults to 5 seconds
+	Timeout time.Duration
+}
+
+// Detect implements Detector.
+func (d UPnPDetector) Detect(ctx context.Context, network Network) (netip.Addr, error) {
+	if network != IPv4 {
+		return netip.Addr{}, fmt.Errorf("UPnP only reports IPv4 addresses")
+	}
+	timeout := d.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	client := &http.Client{Timeout: timeout}
+
+	location := d.Location
+	if location == "" {
+		var err error
+		if location, err = discoverGateway(ctx, timeout); err != nil {
+			return netip.Addr{}, err
+		}
+	}
+
+	serviceType, controlURL, err := wanService(ctx, client, location)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	return externalIPAddress(ctx, client, serviceType, controlURL)
+}
+
+// discoverGateway sends an SSDP search and returns the location of the
+// first gateway that answers
+func discoverGateway(ctx context.Context, timeout time.Duration) (string, error) {
+	conn, err := net.ListenPacket("udp4", ":0")
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	dst, err := net.ResolveUDPAddr("udp4", ssdpAddr)
+	if err != nil {
+		return "", err
+	}
+	search := "M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: " + ssdpAddr + "\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 2\r\n" +
+		"ST: " + igdSearch + "\r\n\r\n"
+	if _, err := conn.WriteTo([]byte(search), dst); err != nil {
+		return "", fmt.Errorf("UPnP discovery: %v", err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetReadDeadline(deadline)
+
+	buf := make([]byte, 2048)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return "", fmt.Errorf("UPnP discovery: no gateway found: %v", err)
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(buf[:n])), nil)
+		if err != nil {
+			continue
+		}
+		resp.Body.Close()
+		if location := resp.Header.Get("Location"); location != "" {
+			return location, nil
+		}
+	}
+}
+
+// deviceDescription is the part of a UPnP device description needed to
+// find the WAN connection service
+type deviceDescription struct {
+	URLBase string `xml:"URLBase"`
+	Device  device `xml:"device"`
+}
+
+type device struct {
+	Services []struct {
+		ServiceType string `xml:"serviceType"`
+		ControlURL  string `xml:"controlURL"`
+	} `xml:"serviceList>service"`
+	Devices []device `xml:"deviceList>device"`
+}
+
+// wanService returns the type and absolute control URL of the gateway's
+// WANIPConnection or WANPPPConnection service
+func wanService(ctx context.Context, client *http.Client, location string) (serviceType, controlURL string, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return "", "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", "", fmt.Errorf("UPnP device description: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("UPnP device description: unexpected status %s", resp.Status)
+	}
+
+	var desc deviceDescription
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&desc); err != nil {
+		return "", "", fmt.Errorf("UPnP device description: %v", err)
+	}
+	base, err := url.Parse(location)
+	if err != nil {
+		return "", "", err
+	}
+	if desc.URLBase != "" {
+		if base, err = url.Parse(desc.URLBase); err != nil {
+			return "", "", fmt.Errorf("UPnP device description: invalid URLBase: %v", err)
+		}
+	}
+
+	// Depth-first search through the embedded devices
+	stack := []device{desc.Device}
+	for len(stack) > 0 {
+		d := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, service := range d.Services {
+			if strings.Contains(service.ServiceType, ":WANIPConnection:") || strings.Contains(service.ServiceType, ":WANPPPConnection:") {
+				control, err := base.Parse(service.ControlURL)
+				if err != nil {
+					return "", "", fmt.Errorf("UPnP device description: invalid control URL: %v", err)
+				}
+				return service.ServiceType, control.String(), nil
+			}
+		}
+		stack = append(stack, d.Devices...)
+	}
+	return "", "", fmt.Errorf("UPnP device %s has no WAN connection service", location)
+}
+
+// externalIPAddress calls the GetExternalIPAddress action of the service
+func externalIPAddress(ctx context.Context, client *http.Client, serviceType, controlURL string) (netip.Addr, error) {
+	body := `<?xml version="1.0"?>` +
+		`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">` +
+		`<s:Body><u:GetExternalIPAddress xmlns:u="` + serviceType + `"/></s:Body></s:Envelope>`
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, controlURL, strings.NewReader(body))
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("SOAPAction", `"`+serviceType+`#GetExternalIPAddress"`)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("UPnP GetExternalIPAddress: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return netip.Addr{}, fmt.Errorf("UPnP GetExternalIPAddress: unexpected status %s", resp.Status)
+	}
+
+	var envelope struct {
+		Address string `xml:"Body>GetExternalIPAddressResponse>NewExternalIPAddress"`
+	}
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(&envelope); err != nil {
+		return netip.Addr{}, fmt.Errorf("UPnP GetExternalIPAddress: %v", err)
+	}
+	addr, err := netip.ParseAddr(strings.TrimSpace(envelope.Address))
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("UPnP GetExternalIPAddress: invalid address %q", envelope.Address)
+	}
+	addr = addr.Unmap()
+	if !addr.Is4() || !isPublic(addr) {
+		// Routers behind carrier-grade NAT or another router report a
+		// private address
+		return netip.Addr{}, fmt.Errorf("UPnP gateway reports non-public address %s", addr)
+	}
+	return addr, nil
+}
@@ -0,0 +1,69 @@
+package autodns
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"regexp"
+	"time"
+)
+
+var (
+	// sensitiveHeaderPattern matches headers carrying credentials, 2FA
+	// tokens or session cookies in a dumped request or response
+	sensitiveHeaderPattern = regexp.MustCompile(`(?im)^(Authorization|Proxy-Authorization|Cookie|Set-Cookie|X-Domainrobot-2fa-Token|X-Domainrobot-Session-Id):[^\r\n]*`)
+
+	// sensitiveFieldPattern matches JSON string fields carrying secrets
+	sensitiveFieldPattern = regexp.MustCompile(`(?i)("(?:password|passwd|token|token2fa|2fa|otp|secret|sessionId|session)"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+)
+
+// redactDump removes credentials, 2FA tokens and session cookies from a
+// dumped HTTP message
+func redactDump(dump []byte) []byte {
+	dump = sensitiveHeaderPattern.ReplaceAll(dump, []byte("$1: REDACTED"))
+	return sensitiveFieldPattern.ReplaceAll(dump, []byte(`$1"REDACTED"`))
+}
+
+// debugRequest writes the outgoing request, including its body, to
+// DebugWriter. It is a no-op when DebugWriter is nil.
+func (p *Provider) debugRequest(req *http.Request) {
+	if p.DebugWriter == nil {
+		return
+	}
+
+	dump, err := httputil.DumpRequestOut(req, true)
+	if err != nil {
+		p.writeDebug(fmt.Appendf(nil, ">>> %s %s (dump failed: %v)\n\n", req.Method, req.URL.Path, err))
+		return
+	}
+	p.writeDebug(append(append([]byte(">>> AutoDNS request\n"), redactDump(dump)...), "\n\n"...))
+}
+
+// debugResponse writes the response headers and the already read body to
+// DebugWriter. It is a no-op when DebugWriter is nil.
+func (p *Provider) debugResponse(resp *http.Response, body []byte, duration time.Duration) {
+	if p.DebugWriter == nil {
+		return
+	}
+
+	dump, err := httputil.DumpResponse(resp, false)
+	if err != nil {
+		p.writeDebug(fmt.Appendf(nil, "<<< HTTP %d (dump failed: %v)\n\n", resp.StatusCode, err))
+		return
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "<<< AutoDNS response (%s)\n", duration.Round(time.Millisecond))
+	buf.Write(redactDump(dump))
+	buf.Write(redactDump(body))
+	buf.WriteString("\n\n")
+	p.writeDebug(buf.Bytes())
+}
+
+// writeDebug serializes writes so dumps of concurrent requests don't interleave
+func (p *Provider) writeDebug(b []byte) {
+	p.debugMutex.Lock()
+	defer p.debugMutex.Unlock()
+	p.DebugWriter.Write(b)
+}
@@ -0,0 +1,73 @@
+package autodns
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/saveenergy/libdns-autodns/internal/fakeapi"
+)
+
+func TestDebugWriterDumpsRedactedTraffic(t *testing.T) {
+	api := newFakeAPI(t, testZone())
+
+	var dump bytes.Buffer
+	provider := api.provider()
+	provider.DebugWriter = &dump
+
+	_, err := provider.AppendRecords(context.Background(), "example.com", []libdns.Record{
+		libdns.TXT{Name: "debug", Text: "dumped", TTL: 300 * time.Second},
+	})
+	if err != nil {
+		t.Fatalf("AppendRecords failed: %v", err)
+	}
+
+	output := dump.String()
+	for _, want := range []string{
+		">>> AutoDNS request",
+		"GET /zone/example.com HTTP/1.1",
+		"PUT /zone/example.com HTTP/1.1",
+		`"value":"dumped"`,
+		"<<< AutoDNS response",
+		"HTTP/1.1 200 OK",
+		`"stid":"20261018-stid-2"`,
+		"Authorization: REDACTED",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected dump to contain %q", want)
+		}
+	}
+
+	basic := base64.StdEncoding.EncodeToString([]byte(fakeapi.Username + ":" + fakeapi.Password))
+	if strings.Contains(output, basic) || strings.Contains(output, fakeapi.Password) {
+		t.Error("Dump leaks credentials")
+	}
+}
+
+func TestRedactDump(t *testing.T) {
+	dump := strings.Join([]string{
+		"POST /login HTTP/1.1",
+		"Authorization: Basic dXNlcjpzZWNyZXQ=",
+		"X-Domainrobot-2FA-Token: 123456",
+		"Cookie: domainrobot_session=abc123",
+		"Set-Cookie: domainrobot_session=abc123; Path=/",
+		"",
+		`{"user":"user","password":"s3cr\"et","context":4,"token2fa":"654321"}`,
+	}, "\r\n")
+
+	redacted := string(redactDump([]byte(dump)))
+	for _, secret := range []string{"dXNlcjpzZWNyZXQ=", "123456", "abc123", `s3cr\"et`, "654321"} {
+		if strings.Contains(redacted, secret) {
+			t.Errorf("Redacted dump still contains %q:\n%s", secret, redacted)
+		}
+	}
+	for _, kept := range []string{"POST /login HTTP/1.1", `"user":"user"`, `"context":4`} {
+		if !strings.Contains(redacted, kept) {
+			t.Errorf("Redacted dump lost %q:\n%s", kept, redacted)
+		}
+	}
+}
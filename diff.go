@@ -0,0 +1,124 @@
+package autodns
+
+import (
+	"fmt"
+
+	"github.com/libdns/libdns"
+)
+
+// ChangeSet describes how the resource records of a zone change.
+type ChangeSet struct {
+	// Zone is the name of the zone the changes apply to
+	Zone string `json:"zone"`
+	// Adds are records that are created
+	Adds []ResourceRecord `json:"adds,omitempty"`
+	// Removes are records that are deleted
+	Removes []ResourceRecord `json:"removes,omitempty"`
+	// Modifications are records whose TTL or value changes
+	Modifications []RecordModification `json:"modifications,omitempty"`
+}
+
+// RecordModification pairs a record with its replacement.
+type RecordModification struct {
+	Before ResourceRecord `json:"before"`
+	After  ResourceRecord `json:"after"`
+}
+
+// Empty reports whether the change set contains no changes.
+func (c ChangeSet) Empty() bool {
+	return len(c.Adds) == 0 && len(c.Removes) == 0 && len(c.Modifications) == 0
+}
+
+// String summarizes the change set, e.g. "example.com: +2 -1 ~1".
+func (c ChangeSet) String() string {
+	return fmt.Sprintf("%s: +%d -%d ~%d", c.Zone, len(c.Adds), len(c.Removes), len(c.Modifications))
+}
+
+// diffResourceRecords computes the minimal change set that turns before into
+// after. Unchanged records are omitted. A removed and an added record with
+// the same name and type are reported as a modification, preferring pairs
+// that only differ in TTL.
+func diffResourceRecords(zone string, before, after []ResourceRecord) ChangeSet {
+	changes := ChangeSet{Zone: zone}
+
+	// Records present on both sides are unchanged
+	removed := subtractRecords(before, after, zone)
+	added := subtractRecords(after, before, zone)
+
+	// Pair removals with additions of the same name and type
+	removedUsed := make([]bool, len(removed))
+	addedUsed := make([]bool, len(added))
+	for _, sameValue := range []bool{true, false} {
+		for i, rem := range removed {
+			if removedUsed[i] {
+				continue
+			}
+			for j, add := range added {
+				if addedUsed[j] || recordSetKey(rem, zone) != recordSetKey(add, zone) {
+					continue
+				}
+				if sameValue && recordKey(rem, zone, false) != recordKey(add, zone, false) {
+					continue
+				}
+				changes.Modifications = append(changes.Modifications, RecordModification{Before: rem, After: add})
+				removedUsed[i], addedUsed[j] = true, true
+				break
+			}
+		}
+	}
+
+	for i, rem := range removed {
+		if !removedUsed[i] {
+			changes.Removes = append(changes.Removes, rem)
+		}
+	}
+	for j, add := range added {
+		if !addedUsed[j] {
+			changes.Adds = append(changes.Adds, add)
+		}
+	}
+	return changes
+}
+
+// subtractRecords returns the records of a that are not matched by a record
+// in b, counting duplicates
+func subtractRecords(a, b []ResourceRecord, zone string) []ResourceRecord {
+	remaining := make(map[string]int)
+	for _, rr := range b {
+		remaining[recordKey(rr, zone, true)]++
+	}
+	var result []ResourceRecord
+	for _, rr := range a {
+		key := recordKey(rr, zone, true)
+		if remaining[key] > 0 {
+			remaining[key]--
+			continue
+		}
+		result = append(result, rr)
+	}
+	return result
+}
+
+// recordSetKey identifies the record set (name and type) a record belongs to
+func recordSetKey(rr ResourceRecord, zone string) string {
+	return fmt.Sprintf("%s:%s", rr.Type, normalizeRecordName(rr.Name, zone))
+}
+
+// recordKey identifies a record by name, type, value and preference, and
+// by TTL if withTTL is set
+func recordKey(rr ResourceRecord, zone string, withTTL bool) string {
+	key := fmt.Sprintf("%s:%s:%d:%s", rr.Type, normalizeRecordName(rr.Name, zone), rr.Pref, rr.Value)
+	if withTTL {
+		key += fmt.Sprintf(":%d", rr.TTL)
+	}
+	return key
+}
+
+// normalizeRecordName makes a record name relative to the zone and uses "@"
+// for the apex, so "", "@", "example.com" and "example.com." compare equal
+func normalizeRecordName(name, zone string) string {
+	if name == "" {
+		return "@"
+	}
+	return libdns.RelativeName(name, zone)
+}
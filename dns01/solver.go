@@ -0,0 +1,329 @@
+// Package dns01 solves ACME DNS-01 challenges with AutoDNS.
+//
+// A Solver creates the _acme-challenge TXT records, removes them again and
+// keeps track of every record it created, so that several orders for the
+// same name can run at once and records left behind by a crash can be
+// removed later. Its Present and CleanUp methods match lego's
+// challenge.Provider interface.
+package dns01
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libdns/libdns"
+	autodns "github.com/saveenergy/libdns-autodns"
+)
+
+// Solver defaults
+const (
+	DefaultTTL = 60 * time.Second
+	// DefaultTimeout limits Present and CleanUp, which take no context
+	DefaultTimeout = 2 * time.Minute
+)
+
+// maxCNAMEHops limits how many CNAME records are followed from a challenge
+// name
+const maxCNAMEHops = 8
+
+// Solver presents and cleans up DNS-01 challenge records. It is safe for
+// concurrent use.
+type Solver struct {
+	// Provider writes the records
+	Provider *autodns.Provider
+	// TTL of the challenge records; defaults to DefaultTTL
+	TTL time.Duration
+	// StateFile keeps the presented records across restarts, so that
+	// CleanupStale can remove records of a process that crashed (optional)
+	StateFile string
+	// PropagationTimeout makes Present wait up to this long until the
+	// zone's name servers serve the record; zero does not wait (optional)
+	PropagationTimeout time.Duration
+	// PropagationOptions configures the propagation check (optional)
+	PropagationOptions autodns.PropagationOptions
+	// Timeout limits Present and CleanUp; defaults to DefaultTimeout
+	Timeout time.Duration
+
+	mu      sync.Mutex
+	records []Record
+	loaded  bool
+}
+
+// Record is a challenge record created by a Solver.
+type Record struct {
+	// Zone is the AutoDNS zone holding the record
+	Zone string `json:"zone"`
+	// Name is the record name relative to Zone
+	Name string `json:"name"`
+	// Value is the TXT record value
+	Value string `json:"value"`
+	// Created is when the record was first presented
+	Created time.Time `json:"created"`
+	// Refs counts the challenges using the record
+	Refs int `json:"refs"`
+}
+
+// ChallengeRecord returns the name and TXT value of the DNS-01 challenge
+// record for domain and the key authorization of the challenge, as defined
+// by RFC 8555, section 8.4.
+func ChallengeRecord(domain, keyAuth string) (fqdn, value string) {
+	domain = strings.TrimPrefix(strings.TrimSuffix(domain, "."), "*.")
+	sum := sha256.Sum256([]byte(keyAuth))
+	return "_acme-challenge." + domain + ".", base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// Present creates the challenge record for domain. It implements lego's
+// challenge.Provider interface; token is not used.
+func (s *Solver) Present(domain, token, keyAuth string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout())
+	defer cancel()
+	fqdn, value := ChallengeRecord(domain, keyAuth)
+	return s.PresentRecord(ctx, fqdn, value)
+}
+
+// CleanUp removes the challenge record for domain once no other challenge
+// uses it. It implements lego's challenge.Provider interface; token is not
+// used.
+func (s *Solver) CleanUp(domain, token, keyAuth string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout())
+	defer cancel()
+	fqdn, value := ChallengeRecord(domain, keyAuth)
+	return s.CleanUpRecord(ctx, fqdn, value)
+}
+
+// PresentRecord creates a TXT record with value at fqdn, following CNAME
+// records in the AutoDNS zones to the zone the challenge is delegated to.
+// Other TXT records at the name are kept, so concurrent challenges for the
+// same name do not disturb each other. Presenting the same value twice
+// creates one record that is removed by the second CleanUpRecord.
+func (s *Solver) PresentRecord(ctx context.Context, fqdn, value string) error {
+	zone, record, err := s.present(ctx, fqdn, value)
+	if err != nil {
+		return err
+	}
+
+	// The wait does not hold the lock, so other challenges are presented
+	// and cleaned up meanwhile
+	if s.PropagationTimeout > 0 {
+		ctx, cancel := context.WithTimeout(ctx, s.PropagationTimeout)
+		defer cancel()
+		return s.Provider.WaitForPropagation(ctx, zone, []libdns.Record{record}, s.PropagationOptions)
+	}
+	return nil
+}
+
+// present creates or references the challenge record and returns the zone
+// and record to wait for
+func (s *Solver) present(ctx context.Context, fqdn, value string) (string, libdns.TXT, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return "", libdns.TXT{}, err
+	}
+
+	zone, name, records, err := s.resolve(ctx, fqdn)
+	if err != nil {
+		return "", libdns.TXT{}, err
+	}
+
+	record := libdns.TXT{Name: name, Text: value, TTL: s.ttl()}
+	if i := s.find(zone, name, value); i >= 0 {
+		s.records[i].Refs++
+		return zone, record, s.save()
+	}
+
+	if !hasTXT(records, name, value) {
+		if _, err := s.Provider.AppendRecords(ctx, zone, []libdns.Record{record}); err != nil {
+			return "", libdns.TXT{}, fmt.Errorf("failed to present challenge for %s: %w", fqdn, err)
+		}
+	}
+	s.records = append(s.records, Record{Zone: zone, Name: name, Value: value, Created: time.Now().UTC(), Refs: 1})
+	return zone, record, s.save()
+}
+
+// CleanUpRecord releases a record created by PresentRecord and deletes it
+// when no other challenge uses it. Records the Solver did not create are
+// deleted as well, so that a cleanup after a restart without StateFile
+// still succeeds.
+func (s *Solver) CleanUpRecord(ctx context.Context, fqdn, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return err
+	}
+
+	zone, name, _, err := s.resolve(ctx, fqdn)
+	if err != nil {
+		return err
+	}
+
+	i := s.find(zone, name, value)
+	if i >= 0 && s.records[i].Refs > 1 {
+		s.records[i].Refs--
+		return s.save()
+	}
+	if err := s.delete(ctx, zone, name, value); err != nil {
+		return fmt.Errorf("failed to clean up challenge for %s: %w", fqdn, err)
+	}
+	if i >= 0 {
+		s.records = append(s.records[:i], s.records[i+1:]...)
+	}
+	return s.save()
+}
+
+// CleanupStale deletes the challenge records presented more than maxAge
+// ago, regardless of how many challenges still use them, and returns the
+// number of deleted records. Without a StateFile, only records presented
+// by this Solver are known.
+func (s *Solver) CleanupStale(ctx context.Context, maxAge time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return 0, err
+	}
+
+	cutoff := time.Now().Add(-maxAge)
+	deleted := 0
+	kept := s.records[:0]
+	var errs []string
+	for _, record := range s.records {
+		if record.Created.After(cutoff) {
+			kept = append(kept, record)
+			continue
+		}
+		if err := s.delete(ctx, record.Zone, record.Name, record.Value); err != nil {
+			errs = append(errs, fmt.Sprintf("%s in %s: %v", record.Name, record.Zone, err))
+			kept = append(kept, record)
+			continue
+		}
+		deleted++
+	}
+	s.records = kept
+
+	if err := s.save(); err != nil {
+		return deleted, err
+	}
+	if len(errs) > 0 {
+		return deleted, fmt.Errorf("failed to clean up stale challenges: %s", strings.Join(errs, "; "))
+	}
+	return deleted, nil
+}
+
+// Records returns the challenge records the Solver currently tracks.
+func (s *Solver) Records() ([]Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return append([]Record(nil), s.records...), nil
+}
+
+// resolve finds the AutoDNS zone and relative name the challenge record for
+// fqdn belongs in, following CNAME records, and returns the zone's records
+func (s *Solver) resolve(ctx context.Context, fqdn string) (zone, name string, records []libdns.Record, err error) {
+	if s.Provider == nil {
+		return "", "", nil, fmt.Errorf("dns01: Provider is required")
+	}
+
+	zones, err := s.Provider.ListZones(ctx)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	target := strings.ToLower(strings.TrimSuffix(fqdn, "."))
+	seen := make(map[string]bool)
+	for hops := 0; ; hops++ {
+		if seen[target] {
+			return "", "", nil, fmt.Errorf("CNAME loop at %s", target)
+		}
+		if hops > maxCNAMEHops {
+			return "", "", nil, fmt.Errorf("too many CNAME records following %s", fqdn)
+		}
+		seen[target] = true
+
+		zone = longestZone(zones, target)
+		if zone == "" {
+			return "", "", nil, fmt.Errorf("no AutoDNS zone for %s", target)
+		}
+		name = libdns.RelativeName(target+".", zone+".")
+
+		if records, err = s.Provider.GetRecords(ctx, zone); err != nil {
+			return "", "", nil, err
+		}
+		cname := cnameTarget(records, name)
+		if cname == "" {
+			return zone, name, records, nil
+		}
+		target = strings.ToLower(strings.TrimSuffix(cname, "."))
+	}
+}
+
+// delete removes a TXT record with the given value
+func (s *Solver) delete(ctx context.Context, zone, name, value string) error {
+	_, err := s.Provider.DeleteRecords(ctx, zone, []libdns.Record{libdns.TXT{Name: name, Text: value}})
+	return err
+}
+
+// find returns the index of a tracked record, or -1
+func (s *Solver) find(zone, name, value string) int {
+	for i, record := range s.records {
+		if record.Zone == zone && record.Name == name && record.Value == value {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *Solver) ttl() time.Duration {
+	if s.TTL > 0 {
+		return s.TTL
+	}
+	return DefaultTTL
+}
+
+func (s *Solver) timeout() time.Duration {
+	if s.Timeout > 0 {
+		return s.Timeout
+	}
+	return DefaultTimeout
+}
+
+// longestZone returns the most specific zone containing name, or ""
+func longestZone(zones []libdns.Zone, name string) string {
+	best := ""
+	for _, zone := range zones {
+		z := strings.ToLower(strings.TrimSuffix(zone.Name, "."))
+		if (name == z || strings.HasSuffix(name, "."+z)) && len(z) > len(best) {
+			best = z
+		}
+	}
+	return best
+}
+
+// cnameTarget returns the target of a CNAME record named name, or ""
+func cnameTarget(records []libdns.Record, name string) string {
+	for _, record := range records {
+		rr := record.RR()
+		if rr.Type == "CNAME" && strings.EqualFold(rr.Name, name) {
+			return rr.Data
+		}
+	}
+	return ""
+}
+
+// hasTXT reports whether records contain a TXT record with the name and value
+func hasTXT(records []libdns.Record, name, value string) bool {
+	for _, record := range records {
+		rr := record.RR()
+		if rr.Type == "TXT" && strings.EqualFold(rr.Name, name) && rr.Data == value {
+			return true
+		}
+	}
+	return false
+}
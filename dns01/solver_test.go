@@ -0,0 +1,221 @@
+package dns01
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	autodns "github.com/saveenergy/libdns-autodns"
+	"github.com/saveenergy/libdns-autodns/internal/autodnstest"
+)
+
+func testZones() []autodns.Zone {
+	return []autodns.Zone{
+		{
+			Origin: "example.com",
+			SOA:    &autodns.SOA{TTL: 86400, Email: "hostmaster@example.com"},
+			ResourceRecords: []autodns.ResourceRecord{
+				{Name: "www", TTL: 300, Type: "A", Value: "192.0.2.1"},
+				{Name: "_acme-challenge.delegated", TTL: 300, Type: "CNAME", Value: "delegated.acme.example.net"},
+				{Name: "_acme-challenge.loop", TTL: 300, Type: "CNAME", Value: "_acme-challenge.loop.example.com"},
+			},
+		},
+		{
+			Origin: "example.net",
+			SOA:    &autodns.SOA{TTL: 86400, Email: "hostmaster@example.net"},
+		},
+	}
+}
+
+// txtValues returns the values of the TXT records named name
+func txtValues(zone autodns.Zone, name string) []string {
+	var values []string
+	for _, rr := range zone.ResourceRecords {
+		if rr.Type == "TXT" && rr.Name == name {
+			values = append(values, rr.Value)
+		}
+	}
+	slices.Sort(values)
+	return values
+}
+
+func TestPresentCleanUp(t *testing.T) {
+	api := autodnstest.NewServer(t, testZones()...)
+	solver := &Solver{Provider: api.Provider()}
+
+	if err := solver.Present("www.example.com", "token", "key-auth"); err != nil {
+		t.Fatalf("Present failed: %v", err)
+	}
+	_, value := ChallengeRecord("www.example.com", "key-auth")
+	if got := txtValues(api.Zone("example.com"), "_acme-challenge.www"); !slices.Equal(got, []string{value}) {
+		t.Fatalf("Expected TXT %q, got %v", value, got)
+	}
+
+	if err := solver.CleanUp("www.example.com", "token", "key-auth"); err != nil {
+		t.Fatalf("CleanUp failed: %v", err)
+	}
+	if got := txtValues(api.Zone("example.com"), "_acme-challenge.www"); len(got) != 0 {
+		t.Errorf("Expected the TXT record to be removed, got %v", got)
+	}
+	if len(api.Zone("example.com").ResourceRecords) != 3 {
+		t.Errorf("Expected the other records to be kept, got %+v", api.Zone("example.com").ResourceRecords)
+	}
+}
+
+func TestChallengeRecord(t *testing.T) {
+	// Wildcard names validate at the base domain
+	fqdn, value := ChallengeRecord("*.example.org.", "evaGxfADs6pSRb2LAv9IZf17Dt3juxGJ-PCt92wr-oA.Zn5KdQKnHsmMmCFAiEB6YrcW7s5mjNXZTH9tZA6eyZE")
+	if fqdn != "_acme-challenge.example.org." {
+		t.Errorf("Unexpected name %q", fqdn)
+	}
+	if value != "SMriyWV3qmhFJu9aaJmp0YsKEFGru9QF8_OZ00SJAuQ" {
+		t.Errorf("Expected the unpadded base64url SHA-256 digest, got %q", value)
+	}
+}
+
+func TestConcurrentChallenges(t *testing.T) {
+	api := autodnstest.NewServer(t, testZones()...)
+	solver := &Solver{Provider: api.Provider()}
+	ctx := context.Background()
+
+	// A wildcard and a plain certificate validate at the same name, and
+	// the same value can be presented twice by overlapping orders
+	var wg sync.WaitGroup
+	for _, value := range []string{"token-a", "token-b", "token-a"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := solver.PresentRecord(ctx, "_acme-challenge.example.com.", value); err != nil {
+				t.Errorf("PresentRecord(%s) failed: %v", value, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := txtValues(api.Zone("example.com"), "_acme-challenge"); !slices.Equal(got, []string{"token-a", "token-b"}) {
+		t.Fatalf("Expected one record per value, got %v", got)
+	}
+
+	if err := solver.CleanUpRecord(ctx, "_acme-challenge.example.com.", "token-b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := solver.CleanUpRecord(ctx, "_acme-challenge.example.com.", "token-a"); err != nil {
+		t.Fatal(err)
+	}
+	if got := txtValues(api.Zone("example.com"), "_acme-challenge"); !slices.Equal(got, []string{"token-a"}) {
+		t.Fatalf("Expected token-a to stay while it is still used, got %v", got)
+	}
+	if err := solver.CleanUpRecord(ctx, "_acme-challenge.example.com.", "token-a"); err != nil {
+		t.Fatal(err)
+	}
+	if got := txtValues(api.Zone("example.com"), "_acme-challenge"); len(got) != 0 {
+		t.Errorf("Expected all challenge records to be removed, got %v", got)
+	}
+}
+
+func TestCNAMEDelegation(t *testing.T) {
+	api := autodnstest.NewServer(t, testZones()...)
+	solver := &Solver{Provider: api.Provider()}
+	ctx := context.Background()
+
+	if err := solver.PresentRecord(ctx, "_acme-challenge.delegated.example.com.", "token"); err != nil {
+		t.Fatalf("PresentRecord failed: %v", err)
+	}
+	if got := txtValues(api.Zone("example.net"), "delegated.acme"); !slices.Equal(got, []string{"token"}) {
+		t.Errorf("Expected the record in the delegated zone, got %v", got)
+	}
+	if got := txtValues(api.Zone("example.com"), "_acme-challenge.delegated"); len(got) != 0 {
+		t.Errorf("Expected no record next to the CNAME, got %v", got)
+	}
+
+	if err := solver.CleanUpRecord(ctx, "_acme-challenge.delegated.example.com.", "token"); err != nil {
+		t.Fatalf("CleanUpRecord failed: %v", err)
+	}
+	if got := txtValues(api.Zone("example.net"), "delegated.acme"); len(got) != 0 {
+		t.Errorf("Expected the delegated record to be removed, got %v", got)
+	}
+
+	err := solver.PresentRecord(ctx, "_acme-challenge.loop.example.com.", "token")
+	if err == nil || !strings.Contains(err.Error(), "CNAME loop") {
+		t.Errorf("Expected a CNAME loop error, got %v", err)
+	}
+	err = solver.PresentRecord(ctx, "_acme-challenge.example.org.", "token")
+	if err == nil || !strings.Contains(err.Error(), "no AutoDNS zone") {
+		t.Errorf("Expected a missing zone error, got %v", err)
+	}
+}
+
+func TestCleanupStale(t *testing.T) {
+	api := autodnstest.NewServer(t, testZones()...)
+	state := filepath.Join(t.TempDir(), "challenges.json")
+	ctx := context.Background()
+
+	crashed := &Solver{Provider: api.Provider(), StateFile: state}
+	for _, value := range []string{"token-a", "token-b"} {
+		if err := crashed.PresentRecord(ctx, "_acme-challenge.example.com", value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A new process picks up the records from the state file
+	solver := &Solver{Provider: api.Provider(), StateFile: state}
+	if n, err := solver.CleanupStale(ctx, time.Hour); err != nil || n != 0 {
+		t.Fatalf("Expected recent records to be kept, got %d, %v", n, err)
+	}
+	if n, err := solver.CleanupStale(ctx, 0); err != nil || n != 2 {
+		t.Fatalf("Expected 2 stale records to be removed, got %d, %v", n, err)
+	}
+	if got := txtValues(api.Zone("example.com"), "_acme-challenge"); len(got) != 0 {
+		t.Errorf("Expected the stale records to be removed, got %v", got)
+	}
+	if records, err := (&Solver{StateFile: state}).Records(); err != nil || len(records) != 0 {
+		t.Errorf("Expected an empty state, got %v, %v", records, err)
+	}
+}
+
+func TestPresentWaitDoesNotBlock(t *testing.T) {
+	api := autodnstest.NewServer(t, testZones()...)
+
+	// A resolver that never answers keeps the first challenge waiting
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	solver := &Solver{
+		Provider:           api.Provider(),
+		PropagationTimeout: 2 * time.Second,
+		PropagationOptions: autodns.PropagationOptions{
+			Resolvers:    []string{conn.LocalAddr().String()},
+			Interval:     50 * time.Millisecond,
+			QueryTimeout: 50 * time.Millisecond,
+		},
+	}
+	ctx := context.Background()
+
+	waiting := make(chan error, 1)
+	go func() { waiting <- solver.PresentRecord(ctx, "_acme-challenge.example.com.", "token-a") }()
+	for {
+		if got := txtValues(api.Zone("example.com"), "_acme-challenge"); len(got) == 1 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The second solver call finishes while the first one still waits
+	if err := solver.CleanUpRecord(ctx, "_acme-challenge.example.com.", "token-a"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-waiting:
+		t.Fatalf("Expected PresentRecord to still wait, got %v", err)
+	default:
+	}
+	if err := <-waiting; err == nil {
+		t.Error("Expected PresentRecord to time out")
+	}
+}
@@ -0,0 +1,68 @@
+package dns01
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// load reads the StateFile the first time the Solver is used. A missing
+// file is an empty state.
+func (s *Solver) load() error {
+	if s.loaded || s.StateFile == "" {
+		s.loaded = true
+		return nil
+	}
+
+	data, err := os.ReadFile(s.StateFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		s.loaded = true
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read challenge state: %v", err)
+	}
+	if err := json.Unmarshal(data, &s.records); err != nil {
+		return fmt.Errorf("failed to read challenge state %s: %v", s.StateFile, err)
+	}
+	s.loaded = true
+	return nil
+}
+
+// save writes the tracked records to the StateFile, replacing it atomically
+func (s *Solver) save() error {
+	if s.StateFile == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(s.records, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal challenge state: %v", err)
+	}
+
+	dir := filepath.Dir(s.StateFile)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("failed to write challenge state: %v", err)
+	}
+	f, err := os.CreateTemp(dir, filepath.Base(s.StateFile)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to write challenge state: %v", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return fmt.Errorf("failed to write challenge state: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("failed to write challenge state: %v", err)
+	}
+	if err := os.Rename(f.Name(), s.StateFile); err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("failed to write challenge state: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package autodns
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/libdns/libdns"
+)
+
+// Operation identifies a record operation that can be planned.
+type Operation string
+
+// Record operations, matching the libdns methods of the same name.
+const (
+	OperationAppend Operation = "append"
+	OperationSet    Operation = "set"
+	OperationDelete Operation = "delete"
+)
+
+// dryRunContextKey marks a context as a dry run
+type dryRunContextKey struct{}
+
+// dryRun carries the destination for the computed change set
+type dryRun struct {
+	changes *ChangeSet
+}
+
+// WithDryRun returns a context under which AppendRecords, SetRecords and
+// DeleteRecords fetch the zone and compute the changes but do not write the
+// zone. If changes is not nil, it receives the computed change set.
+func WithDryRun(ctx context.Context, changes *ChangeSet) context.Context {
+	return context.WithValue(ctx, dryRunContextKey{}, &dryRun{changes: changes})
+}
+
+// isDryRun reports whether zone writes are skipped for this call, either
+// because the Provider is in dry-run mode or because of WithDryRun
+func (p *Provider) isDryRun(ctx context.Context) bool {
+	_, ok := ctx.Value(dryRunContextKey{}).(*dryRun)
+	return ok || p.DryRun
+}
+
+// reportChanges hands the computed change set to a WithDryRun caller
+func reportChanges(ctx context.Context, changes ChangeSet) {
+	if d, ok := ctx.Value(dryRunContextKey{}).(*dryRun); ok && d.changes != nil {
+		*d.changes = changes
+	}
+}
+
+// Plan computes the changes an operation would make to the zone without
+// writing it. It is equivalent to calling the corresponding libdns method
+// with a WithDryRun context.
+func (p *Provider) Plan(ctx context.Context, zone string, operation Operation, records []libdns.Record) (ChangeSet, error) {
+	var changes ChangeSet
+	ctx = WithDryRun(ctx, &changes)
+
+	var err error
+	switch operation {
+	case OperationAppend:
+		_, err = p.AppendRecords(ctx, zone, records)
+	case OperationSet:
+		_, err = p.SetRecords(ctx, zone, records)
+	case OperationDelete:
+		_, err = p.DeleteRecords(ctx, zone, records)
+	default:
+		return ChangeSet{}, fmt.Errorf("unknown operation %q", operation)
+	}
+	if err != nil {
+		return ChangeSet{}, err
+	}
+	return changes, nil
+}
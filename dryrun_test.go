@@ -0,0 +1,139 @@
+package autodns
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+func TestDiffResourceRecords(t *testing.T) {
+	before := []ResourceRecord{
+		{Name: "www", TTL: 300, Type: "A", Value: "192.0.2.1"},
+		{Name: "", TTL: 300, Type: "MX", Value: "mail.example.com", Pref: 10},
+		{Name: "txt", TTL: 300, Type: "TXT", Value: "old"},
+		{Name: "ttl", TTL: 300, Type: "TXT", Value: "same"},
+		{Name: "gone", TTL: 300, Type: "CNAME", Value: "example.net"},
+	}
+	after := []ResourceRecord{
+		{Name: "www.example.com", TTL: 300, Type: "A", Value: "192.0.2.1"},
+		{Name: "@", TTL: 300, Type: "MX", Value: "mail.example.com", Pref: 10},
+		{Name: "txt", TTL: 300, Type: "TXT", Value: "new"},
+		{Name: "ttl", TTL: 600, Type: "TXT", Value: "same"},
+		{Name: "new", TTL: 300, Type: "AAAA", Value: "2001:db8::1"},
+	}
+
+	changes := diffResourceRecords("example.com", before, after)
+
+	if len(changes.Adds) != 1 || changes.Adds[0].Name != "new" {
+		t.Errorf("Expected one add for 'new', got %+v", changes.Adds)
+	}
+	if len(changes.Removes) != 1 || changes.Removes[0].Name != "gone" {
+		t.Errorf("Expected one removal for 'gone', got %+v", changes.Removes)
+	}
+	if len(changes.Modifications) != 2 {
+		t.Fatalf("Expected 2 modifications, got %+v", changes.Modifications)
+	}
+	for _, mod := range changes.Modifications {
+		switch mod.Before.Name {
+		case "txt":
+			if mod.Before.Value != "old" || mod.After.Value != "new" {
+				t.Errorf("Unexpected TXT modification %+v", mod)
+			}
+		case "ttl":
+			if mod.Before.TTL != 300 || mod.After.TTL != 600 {
+				t.Errorf("Unexpected TTL modification %+v", mod)
+			}
+		default:
+			t.Errorf("Unexpected modification %+v", mod)
+		}
+	}
+	if got := changes.String(); got != "example.com: +1 -1 ~2" {
+		t.Errorf("Unexpected summary %q", got)
+	}
+
+	// Identical record sets produce no changes, duplicates included
+	dup := append(slices.Clone(before), before[0])
+	if changes := diffResourceRecords("example.com", dup, dup); !changes.Empty() {
+		t.Errorf("Expected no changes, got %+v", changes)
+	}
+	if changes := diffResourceRecords("example.com", before, dup); len(changes.Adds) != 1 {
+		t.Errorf("Expected the duplicate to be an add, got %+v", changes)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	ctx := context.Background()
+	modified := libdns.TXT{Name: "_acme-challenge", Text: "new-token", TTL: 60 * time.Second}
+
+	t.Run("Plan", func(t *testing.T) {
+		api := newFakeAPI(t, testZone())
+		provider := api.provider()
+
+		changes, err := provider.Plan(ctx, "example.com", OperationSet, []libdns.Record{modified})
+		if err != nil {
+			t.Fatalf("Plan failed: %v", err)
+		}
+		if len(changes.Modifications) != 1 || changes.Modifications[0].Before.Value != "old-token" || changes.Modifications[0].After.Value != "new-token" {
+			t.Errorf("Expected old-token -> new-token, got %+v", changes)
+		}
+		if log := api.Requests(); !slices.Equal(log, []string{"GET /zone/example.com"}) {
+			t.Errorf("Expected only the zone fetch, got %v", log)
+		}
+
+		if _, err := provider.Plan(ctx, "example.com", Operation("rename"), []libdns.Record{modified}); err == nil {
+			t.Error("Expected error for unknown operation")
+		}
+	})
+
+	t.Run("WithDryRun", func(t *testing.T) {
+		api := newFakeAPI(t, testZone())
+		provider := api.provider()
+
+		var changes ChangeSet
+		_, err := provider.DeleteRecords(WithDryRun(ctx, &changes), "example.com", []libdns.Record{
+			libdns.TXT{Name: "_acme-challenge", Text: "old-token", TTL: 60 * time.Second},
+		})
+		if err != nil {
+			t.Fatalf("DeleteRecords failed: %v", err)
+		}
+		if len(changes.Removes) != 1 || changes.Removes[0].Value != "old-token" {
+			t.Errorf("Expected old-token removal, got %+v", changes)
+		}
+		if len(api.Zone("example.com").ResourceRecords) != 3 {
+			t.Error("Zone was modified during dry run")
+		}
+	})
+
+	t.Run("ProviderDryRun", func(t *testing.T) {
+		api := newFakeAPI(t, testZone())
+		provider := api.provider()
+		provider.DryRun = true
+
+		if _, err := provider.AppendRecords(ctx, "example.com", []libdns.Record{modified}); err != nil {
+			t.Fatalf("AppendRecords failed: %v", err)
+		}
+		for _, req := range api.Requests() {
+			if req != "GET /zone/example.com" {
+				t.Errorf("Unexpected request during dry run: %s", req)
+			}
+		}
+	})
+
+	t.Run("UnchangedZoneIsNotWritten", func(t *testing.T) {
+		api := newFakeAPI(t, testZone())
+		provider := api.provider()
+
+		_, err := provider.SetRecords(ctx, "example.com", []libdns.Record{
+			libdns.TXT{Name: "_acme-challenge", Text: "old-token", TTL: 60 * time.Second},
+		})
+		if err != nil {
+			t.Fatalf("SetRecords failed: %v", err)
+		}
+		if log := api.Requests(); len(log) != 1 {
+			t.Errorf("Expected no zone update, got %v", log)
+		}
+	})
+}
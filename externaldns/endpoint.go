@@ -0,0 +1,140 @@
+package externaldns
+
+import (
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+// Endpoint is a DNS name with its targets, as exchanged with external-dns.
+// It mirrors endpoint.Endpoint of external-dns.
+type Endpoint struct {
+	DNSName          string             `json:"dnsName,omitempty"`
+	Targets          []string           `json:"targets,omitempty"`
+	RecordType       string             `json:"recordType,omitempty"`
+	SetIdentifier    string             `json:"setIdentifier,omitempty"`
+	RecordTTL        int64              `json:"recordTTL,omitempty"`
+	Labels           map[string]string  `json:"labels,omitempty"`
+	ProviderSpecific []ProviderSpecific `json:"providerSpecific,omitempty"`
+}
+
+// ProviderSpecific is a provider-specific property of an Endpoint; AutoDNS
+// has none, so they are ignored.
+type ProviderSpecific struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Changes are the endpoints external-dns wants to create, update and
+// delete. It mirrors plan.Changes of external-dns; older releases send the
+// field names capitalized, which decodes the same.
+type Changes struct {
+	Create    []*Endpoint `json:"create,omitempty"`
+	UpdateOld []*Endpoint `json:"updateOld,omitempty"`
+	UpdateNew []*Endpoint `json:"updateNew,omitempty"`
+	Delete    []*Endpoint `json:"delete,omitempty"`
+}
+
+// DomainFilter is the negotiated set of domains the webhook manages
+type DomainFilter struct {
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+// supportedTypes are the record types mapped to endpoints. These are the
+// types external-dns can manage; the apex name servers are part of the
+// AutoDNS zone settings and never show up as records.
+var supportedTypes = []string{"A", "AAAA", "CNAME", "TXT", "MX", "SRV", "NS", "CAA"}
+
+// endpointName returns the fully qualified name of a record without the
+// trailing dot, as used by external-dns
+func endpointName(name, zone string) string {
+	return strings.ToLower(strings.TrimSuffix(libdns.AbsoluteName(name, zone+"."), "."))
+}
+
+// recordName returns the name of an endpoint relative to the zone, with
+// the empty name AutoDNS uses for the apex
+func recordName(dnsName, zone string) string {
+	name := libdns.RelativeName(canonicalName(dnsName)+".", zone+".")
+	if name == "@" {
+		return ""
+	}
+	return name
+}
+
+// formatTarget returns the endpoint target for record data. TXT targets
+// are quoted the way external-dns' TXT registry writes them.
+func formatTarget(rtype, data string) string {
+	if rtype == "TXT" {
+		return strconv.Quote(data)
+	}
+	return data
+}
+
+// parseTarget returns the record data for an endpoint target
+func parseTarget(rtype, target string) string {
+	if rtype == "TXT" {
+		if text, err := strconv.Unquote(target); err == nil && strings.HasPrefix(target, `"`) {
+			return text
+		}
+		return target
+	}
+	// AutoDNS keeps host names without the trailing dot
+	return strings.TrimSuffix(strings.TrimSpace(target), ".")
+}
+
+// endpointRecord converts one target of an endpoint to a record of zone
+func endpointRecord(ep *Endpoint, zone, target string, ttl time.Duration) (libdns.Record, error) {
+	if ep.RecordTTL > 0 {
+		ttl = time.Duration(ep.RecordTTL) * time.Second
+	}
+	return libdns.RR{
+		Name: recordName(ep.DNSName, zone),
+		TTL:  ttl,
+		Type: strings.ToUpper(ep.RecordType),
+		Data: parseTarget(strings.ToUpper(ep.RecordType), target),
+	}.Parse()
+}
+
+// recordKey identifies a record by name, type and data, ignoring the TTL
+// and the spelling of addresses and host names
+func recordKey(rr libdns.RR) string {
+	rtype := strings.ToUpper(rr.Type)
+	data := rr.Data
+	switch rtype {
+	case "A", "AAAA":
+		if addr, err := netip.ParseAddr(data); err == nil {
+			data = addr.Unmap().String()
+		}
+	case "CNAME", "NS", "MX", "SRV":
+		data = strings.ToLower(strings.TrimSuffix(data, "."))
+	}
+	name := rr.Name
+	if name == "@" {
+		name = ""
+	}
+	return strings.ToLower(name) + " " + rtype + " " + data
+}
+
+// rrsetKey identifies the record set of a record by name and type
+func rrsetKey(rr libdns.RR) string {
+	name := rr.Name
+	if name == "@" {
+		name = ""
+	}
+	return strings.ToLower(name) + " " + strings.ToUpper(rr.Type)
+}
+
+// canonicalName lowercases a name and drops the trailing dot
+func canonicalName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
+
+// isSupported reports whether records of the type are managed
+func isSupported(rtype string) bool {
+	return slices.Contains(supportedTypes, strings.ToUpper(rtype))
+}
@@ -0,0 +1,379 @@
+// Package externaldns implements the webhook provider protocol of
+// Kubernetes external-dns, so that external-dns can manage AutoDNS records
+// for ingresses and services.
+//
+//	webhook := &externaldns.Webhook{
+//		Provider: provider,
+//		Zones:    []string{"example.com"},
+//	}
+//	err := http.ListenAndServe("localhost:8888", webhook)
+//
+// external-dns runs with --provider=webhook and talks to the webhook over
+// localhost, typically from a sidecar container. Ownership is tracked by
+// external-dns' TXT registry, whose TXT records are stored like any other
+// record.
+package externaldns
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libdns/libdns"
+	autodns "github.com/saveenergy/libdns-autodns"
+)
+
+// MediaType is the content type of the external-dns webhook protocol
+const MediaType = "application/external.dns.webhook+json;version=1"
+
+// DefaultTTL is the TTL of endpoints that do not configure one
+const DefaultTTL = 5 * time.Minute
+
+// maxBodySize limits the size of request bodies
+const maxBodySize = 10 << 20
+
+// Webhook serves the external-dns webhook protocol backed by a Provider.
+// Changes are applied with targeted record calls, so records changed by
+// others in the meantime are kept.
+type Webhook struct {
+	// Provider reads and writes the zones
+	Provider *autodns.Provider
+	// Zones are the zones managed through the webhook; empty manages every
+	// zone of the account (optional)
+	Zones []string
+	// DefaultTTL of endpoints without a TTL; defaults to DefaultTTL
+	DefaultTTL time.Duration
+	// Logger receives diagnostics; nil discards them (optional)
+	Logger *slog.Logger
+
+	once sync.Once
+	mux  *http.ServeMux
+}
+
+// ServeHTTP implements http.Handler. It serves:
+//
+//	GET  /                 negotiate the domain filter
+//	GET  /records          list the endpoints
+//	POST /records          apply changes
+//	POST /adjustendpoints  normalize desired endpoints
+//	GET  /healthz          health check
+func (h *Webhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.once.Do(func() {
+		h.mux = http.NewServeMux()
+		h.mux.HandleFunc("GET /{$}", h.negotiate)
+		h.mux.HandleFunc("GET /records", h.records)
+		h.mux.HandleFunc("POST /records", h.applyChanges)
+		h.mux.HandleFunc("POST /adjustendpoints", h.adjustEndpoints)
+		h.mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("ok"))
+		})
+	})
+	h.mux.ServeHTTP(w, r)
+}
+
+// Records returns the endpoints of the managed zones. Records of the same
+// name and type are one endpoint with several targets; its TTL is the
+// lowest of the records.
+func (h *Webhook) Records(ctx context.Context) ([]*Endpoint, error) {
+	zones, err := h.zones(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoints := []*Endpoint{}
+	for _, zone := range zones {
+		records, err := h.Provider.GetRecords(ctx, zone)
+		if err != nil {
+			return nil, err
+		}
+
+		index := make(map[string]*Endpoint)
+		for _, record := range records {
+			rr := record.RR()
+			rtype := strings.ToUpper(rr.Type)
+			if !isSupported(rtype) {
+				continue
+			}
+			name := endpointName(rr.Name, zone)
+			ttl := int64(rr.TTL / time.Second)
+
+			ep, ok := index[name+" "+rtype]
+			if !ok {
+				ep = &Endpoint{DNSName: name, RecordType: rtype, RecordTTL: ttl}
+				index[name+" "+rtype] = ep
+				endpoints = append(endpoints, ep)
+			}
+			ep.Targets = append(ep.Targets, formatTarget(rtype, rr.Data))
+			ep.RecordTTL = min(ep.RecordTTL, ttl)
+		}
+	}
+	return endpoints, nil
+}
+
+// ApplyChanges deletes the records of changes.Delete and changes.UpdateOld
+// and adds those of changes.Create and changes.UpdateNew. Records that are
+// already gone or present are skipped, so changes can be retried.
+func (h *Webhook) ApplyChanges(ctx context.Context, changes *Changes) error {
+	zones, err := h.zones(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Group the changes by zone, keeping the order of the zones
+	type zoneChanges struct {
+		deletes, creates []*Endpoint
+	}
+	var order []string
+	byZone := make(map[string]*zoneChanges)
+	group := func(endpoints []*Endpoint, create bool) {
+		for _, ep := range endpoints {
+			zone, ok := zoneOf(ep.DNSName, zones)
+			if !ok {
+				h.logger().WarnContext(ctx, "endpoint outside the managed zones", "name", ep.DNSName, "type", ep.RecordType)
+				continue
+			}
+			if byZone[zone] == nil {
+				byZone[zone] = &zoneChanges{}
+				order = append(order, zone)
+			}
+			if create {
+				byZone[zone].creates = append(byZone[zone].creates, ep)
+			} else {
+				byZone[zone].deletes = append(byZone[zone].deletes, ep)
+			}
+		}
+	}
+	group(changes.Delete, false)
+	group(changes.UpdateOld, false)
+	group(changes.Create, true)
+	group(changes.UpdateNew, true)
+
+	var errs []error
+	for _, zone := range order {
+		if err := h.applyZone(ctx, zone, byZone[zone].deletes, byZone[zone].creates); err != nil {
+			errs = append(errs, fmt.Errorf("failed to apply changes to %s: %w", zone, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// applyZone applies the changes of one zone. The deletes and creates are
+// applied with targeted record calls, so records changed meanwhile by others
+// are left alone. The creates replace the records of their name and type,
+// which makes the deletes of an update redundant.
+func (h *Webhook) applyZone(ctx context.Context, zone string, deletes, creates []*Endpoint) error {
+	// Convert every target before touching the zone
+	var created []libdns.Record
+	replaced := make(map[string]bool)
+	for _, ep := range creates {
+		for _, target := range ep.Targets {
+			record, err := endpointRecord(ep, zone, target, h.defaultTTL())
+			if err != nil {
+				return fmt.Errorf("invalid %s target %q of %s: %v", ep.RecordType, target, ep.DNSName, err)
+			}
+			created = append(created, record)
+			replaced[rrsetKey(record.RR())] = true
+		}
+	}
+	var deleted []libdns.Record
+	for _, ep := range deletes {
+		for _, target := range ep.Targets {
+			record, err := endpointRecord(ep, zone, target, 0)
+			if err != nil {
+				return fmt.Errorf("invalid %s target %q of %s: %v", ep.RecordType, target, ep.DNSName, err)
+			}
+			if !replaced[rrsetKey(record.RR())] {
+				deleted = append(deleted, record)
+			}
+		}
+	}
+
+	if len(deleted) > 0 {
+		if _, err := h.Provider.DeleteRecords(ctx, zone, deleted); err != nil {
+			return err
+		}
+	}
+	if len(created) > 0 {
+		if _, err := h.Provider.SetRecords(ctx, zone, created); err != nil {
+			return err
+		}
+	}
+	h.logger().InfoContext(ctx, "applied external-dns changes", "zone", zone, "deleted", len(deleted), "created", len(created))
+	return nil
+}
+
+// AdjustEndpoints normalizes the desired endpoints so that they compare
+// equal to the endpoints returned by Records. Endpoints AutoDNS cannot
+// represent, with unsupported record types or routing policies (set
+// identifiers), are dropped.
+func (h *Webhook) AdjustEndpoints(endpoints []*Endpoint) []*Endpoint {
+	adjusted := []*Endpoint{}
+	for _, ep := range endpoints {
+		rtype := strings.ToUpper(ep.RecordType)
+		if !isSupported(rtype) || ep.SetIdentifier != "" {
+			h.logger().Warn("endpoint not supported by AutoDNS", "name", ep.DNSName, "type", ep.RecordType, "set_identifier", ep.SetIdentifier)
+			continue
+		}
+
+		out := *ep
+		out.DNSName = canonicalName(ep.DNSName)
+		out.RecordType = rtype
+		if out.RecordTTL <= 0 {
+			out.RecordTTL = int64(h.defaultTTL() / time.Second)
+		}
+		out.Targets = make([]string, len(ep.Targets))
+		for i, target := range ep.Targets {
+			out.Targets[i] = formatTarget(rtype, parseTarget(rtype, target))
+		}
+		adjusted = append(adjusted, &out)
+	}
+	return adjusted
+}
+
+// negotiate returns the domain filter
+func (h *Webhook) negotiate(w http.ResponseWriter, r *http.Request) {
+	if !acceptsMediaType(r) {
+		http.Error(w, "client must accept "+MediaType, http.StatusNotAcceptable)
+		return
+	}
+	zones, err := h.zones(r.Context())
+	if err != nil {
+		h.fail(w, r, "failed to list zones", err)
+		return
+	}
+	h.writeJSON(w, r, DomainFilter{Include: zones})
+}
+
+func (h *Webhook) records(w http.ResponseWriter, r *http.Request) {
+	if !acceptsMediaType(r) {
+		http.Error(w, "client must accept "+MediaType, http.StatusNotAcceptable)
+		return
+	}
+	endpoints, err := h.Records(r.Context())
+	if err != nil {
+		h.fail(w, r, "failed to get records", err)
+		return
+	}
+	h.writeJSON(w, r, endpoints)
+}
+
+func (h *Webhook) applyChanges(w http.ResponseWriter, r *http.Request) {
+	var changes Changes
+	if !h.readJSON(w, r, &changes) {
+		return
+	}
+	ctx := autodns.WithActor(r.Context(), map[string]string{"webhook": "external-dns", "client": r.RemoteAddr})
+	if err := h.ApplyChanges(ctx, &changes); err != nil {
+		h.fail(w, r, "failed to apply changes", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Webhook) adjustEndpoints(w http.ResponseWriter, r *http.Request) {
+	var endpoints []*Endpoint
+	if !h.readJSON(w, r, &endpoints) {
+		return
+	}
+	h.writeJSON(w, r, h.AdjustEndpoints(endpoints))
+}
+
+// zones returns the managed zones without trailing dots
+func (h *Webhook) zones(ctx context.Context) ([]string, error) {
+	var zones []string
+	if len(h.Zones) > 0 {
+		for _, zone := range h.Zones {
+			zones = append(zones, canonicalName(zone))
+		}
+		return zones, nil
+	}
+
+	list, err := h.Provider.ListZones(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, zone := range list {
+		zones = append(zones, canonicalName(zone.Name))
+	}
+	return zones, nil
+}
+
+// zoneOf returns the most specific zone holding name
+func zoneOf(name string, zones []string) (string, bool) {
+	name = canonicalName(name)
+	best := ""
+	for _, zone := range zones {
+		if (name == zone || strings.HasSuffix(name, "."+zone)) && len(zone) > len(best) {
+			best = zone
+		}
+	}
+	return best, best != ""
+}
+
+// acceptsMediaType reports whether the client accepts the protocol's
+// media type; clients that do not say are assumed to
+func acceptsMediaType(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return true
+	}
+	for part := range strings.SplitSeq(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err == nil && (mediaType == "application/external.dns.webhook+json" || mediaType == "application/json" || mediaType == "*/*") {
+			return true
+		}
+	}
+	return false
+}
+
+// readJSON decodes the request body into v, answering the request on
+// failure
+func (h *Webhook) readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil || (mediaType != "application/external.dns.webhook+json" && mediaType != "application/json") {
+			http.Error(w, "content type must be "+MediaType, http.StatusUnsupportedMediaType)
+			return false
+		}
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(v); err != nil {
+		h.logger().WarnContext(r.Context(), "invalid webhook request", "path", r.URL.Path, "error", err)
+		http.Error(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func (h *Webhook) writeJSON(w http.ResponseWriter, r *http.Request, v any) {
+	w.Header().Set("Content-Type", MediaType)
+	w.Header().Set("Vary", "Content-Type")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		h.logger().WarnContext(r.Context(), "failed to write webhook response", "path", r.URL.Path, "error", err)
+	}
+}
+
+func (h *Webhook) fail(w http.ResponseWriter, r *http.Request, msg string, err error) {
+	h.logger().ErrorContext(r.Context(), msg, "path", r.URL.Path, "error", err)
+	http.Error(w, msg+": "+err.Error(), http.StatusInternalServerError)
+}
+
+func (h *Webhook) defaultTTL() time.Duration {
+	if h.DefaultTTL > 0 {
+		return h.DefaultTTL
+	}
+	return DefaultTTL
+}
+
+func (h *Webhook) logger() *slog.Logger {
+	if h.Logger != nil {
+		return h.Logger
+	}
+	return slog.New(slog.DiscardHandler)
+}
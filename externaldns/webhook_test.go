@@ -0,0 +1,302 @@
+package externaldns
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	autodns "github.com/saveenergy/libdns-autodns"
+	"github.com/saveenergy/libdns-autodns/internal/autodnstest"
+)
+
+// registryTXT is an ownership record as written by external-dns' TXT
+// registry
+const registryTXT = `"heritage=external-dns,external-dns/owner=default,external-dns/resource=ingress/default/web"`
+
+func newTestWebhook(t *testing.T) (*Webhook, *autodnstest.Server) {
+	api := autodnstest.NewServer(t,
+		autodns.Zone{
+			Origin: "example.com",
+			SOA:    &autodns.SOA{TTL: 86400, Email: "hostmaster@example.com"},
+			ResourceRecords: []autodns.ResourceRecord{
+				{Name: "", Type: "A", Value: "192.0.2.1", TTL: 3600},
+				{Name: "www", Type: "A", Value: "192.0.2.1", TTL: 300},
+				{Name: "www", Type: "A", Value: "192.0.2.2", TTL: 300},
+				{Name: "", Type: "MX", Value: "mail.example.com", Pref: 10, TTL: 3600},
+				{Name: "", Type: "ALIAS", Value: "lb.example.net", TTL: 3600},
+			},
+		},
+		autodns.Zone{Origin: "example.org", SOA: &autodns.SOA{TTL: 86400}},
+	)
+	return &Webhook{Provider: api.Provider(), Zones: []string{"example.com"}}, api
+}
+
+// request sends a webhook request and returns the status and body
+func request(t *testing.T, h http.Handler, method, path, body string) (int, string) {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Accept", MediaType)
+	if body != "" {
+		req.Header.Set("Content-Type", MediaType)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec.Code, rec.Body.String()
+}
+
+// records returns the zone records as "name type value ttl"
+func records(api *autodnstest.Server, zone string) []string {
+	var values []string
+	for _, record := range api.Zone(zone).ResourceRecords {
+		values = append(values, fmt.Sprintf("%s %s %s %d", record.Name, record.Type, record.Value, record.TTL))
+	}
+	slices.Sort(values)
+	return values
+}
+
+func TestNegotiate(t *testing.T) {
+	h, _ := newTestWebhook(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept", MediaType)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != MediaType {
+		t.Fatalf("Expected %s, got %d %s", MediaType, rec.Code, rec.Header().Get("Content-Type"))
+	}
+	var filter DomainFilter
+	if err := json.Unmarshal(rec.Body.Bytes(), &filter); err != nil || !slices.Equal(filter.Include, []string{"example.com"}) {
+		t.Errorf("Expected example.com, got %s", rec.Body.String())
+	}
+
+	// Without configured zones, every zone of the account is managed
+	h.Zones = nil
+	if _, body := request(t, h, http.MethodGet, "/", ""); !strings.Contains(body, `"example.com"`) || !strings.Contains(body, `"example.org"`) {
+		t.Errorf("Expected all zones, got %s", body)
+	}
+
+	req.Header.Set("Accept", "text/html")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotAcceptable {
+		t.Errorf("Expected 406, got %d", rec.Code)
+	}
+}
+
+func TestRecords(t *testing.T) {
+	h, _ := newTestWebhook(t)
+
+	code, body := request(t, h, http.MethodGet, "/records", "")
+	if code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d %s", code, body)
+	}
+	var endpoints []Endpoint
+	if err := json.Unmarshal([]byte(body), &endpoints); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, ep := range endpoints {
+		got = append(got, fmt.Sprintf("%s %s %v %d", ep.DNSName, ep.RecordType, ep.Targets, ep.RecordTTL))
+	}
+	want := []string{
+		"example.com A [192.0.2.1] 3600",
+		"www.example.com A [192.0.2.1 192.0.2.2] 300",
+		"example.com MX [10 mail.example.com] 3600",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestApplyChanges(t *testing.T) {
+	h, api := newTestWebhook(t)
+
+	// An ingress is created, with its ownership record
+	code, body := request(t, h, http.MethodPost, "/records", `{
+		"create": [
+			{"dnsName": "app.example.com", "targets": ["198.51.100.7", "198.51.100.8"], "recordType": "A", "recordTTL": 60},
+			{"dnsName": "a-app.example.com", "targets": [`+jsonString(registryTXT)+`], "recordType": "TXT"},
+			{"dnsName": "app.example.net", "targets": ["198.51.100.7"], "recordType": "A"}
+		]
+	}`)
+	if code != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d %s", code, body)
+	}
+	want := []string{
+		" A 192.0.2.1 3600",
+		" ALIAS lb.example.net 3600",
+		" MX mail.example.com 3600",
+		"a-app TXT " + strings.Trim(registryTXT, `"`) + " 300",
+		"app A 198.51.100.7 60",
+		"app A 198.51.100.8 60",
+		"www A 192.0.2.1 300",
+		"www A 192.0.2.2 300",
+	}
+	if got := records(api, "example.com"); !slices.Equal(got, want) {
+		t.Fatalf("Expected %v, got %v", want, got)
+	}
+
+	// The ownership record reads back as written, so the registry finds it
+	endpoints, err := h.Records(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.ContainsFunc(endpoints, func(ep *Endpoint) bool {
+		return ep.DNSName == "a-app.example.com" && slices.Equal(ep.Targets, []string{registryTXT})
+	}) {
+		t.Errorf("Expected the registry record, got %v", endpoints)
+	}
+
+	// The ingress moves to one address and is then deleted; the capitalized
+	// field names of older external-dns releases work as well
+	code, body = request(t, h, http.MethodPost, "/records", `{
+		"UpdateOld": [{"dnsName": "app.example.com", "targets": ["198.51.100.7", "198.51.100.8"], "recordType": "A", "recordTTL": 60}],
+		"UpdateNew": [{"dnsName": "app.example.com", "targets": ["198.51.100.9"], "recordType": "A", "recordTTL": 120}],
+		"Delete": [{"dnsName": "www.example.com", "targets": ["192.0.2.2"], "recordType": "A"}]
+	}`)
+	if code != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d %s", code, body)
+	}
+	want = []string{
+		" A 192.0.2.1 3600",
+		" ALIAS lb.example.net 3600",
+		" MX mail.example.com 3600",
+		"a-app TXT " + strings.Trim(registryTXT, `"`) + " 300",
+		"app A 198.51.100.9 120",
+		"www A 192.0.2.1 300",
+	}
+	if got := records(api, "example.com"); !slices.Equal(got, want) {
+		t.Fatalf("Expected %v, got %v", want, got)
+	}
+
+	// Retrying a delete changes nothing
+	before := len(api.Requests())
+	code, _ = request(t, h, http.MethodPost, "/records", `{"delete": [{"dnsName": "www.example.com", "targets": ["192.0.2.2"], "recordType": "A"}]}`)
+	if code != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d", code)
+	}
+	for _, req := range api.Requests()[before:] {
+		if strings.HasPrefix(req, "PUT") {
+			t.Errorf("Expected no zone update, got %v", api.Requests()[before:])
+		}
+	}
+}
+
+func TestApplyChangesApex(t *testing.T) {
+	api := autodnstest.NewServer(t, autodns.Zone{
+		Origin: "example.com",
+		SOA:    &autodns.SOA{TTL: 86400},
+		ResourceRecords: []autodns.ResourceRecord{
+			{Name: "", Type: "A", Value: "192.0.2.1", TTL: 3600},
+			{Name: "_sip._tcp", Type: "SRV", Value: "5 5060 sip.example.com", Pref: 10, TTL: 3600},
+		},
+	})
+	h := &Webhook{Provider: api.Provider(), Zones: []string{"example.com"}}
+
+	// The apex address moves and an apex service is added
+	code, body := request(t, h, http.MethodPost, "/records", `{
+		"updateOld": [{"dnsName": "example.com", "targets": ["192.0.2.1"], "recordType": "A", "recordTTL": 3600}],
+		"updateNew": [{"dnsName": "example.com", "targets": ["192.0.2.9"], "recordType": "A", "recordTTL": 3600}],
+		"create": [{"dnsName": "_xmpp._tcp.example.com", "targets": ["10 5 5222 xmpp.example.com"], "recordType": "SRV"}]
+	}`)
+	if code != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d %s", code, body)
+	}
+	want := []string{
+		" A 192.0.2.9 3600",
+		"_sip._tcp SRV 5 5060 sip.example.com 3600",
+		"_xmpp._tcp SRV 5 5222 xmpp.example.com 300",
+	}
+	if got := records(api, "example.com"); !slices.Equal(got, want) {
+		t.Fatalf("Expected %v, got %v", want, got)
+	}
+
+	// Deleting the added service leaves the existing one alone
+	code, body = request(t, h, http.MethodPost, "/records", `{
+		"delete": [{"dnsName": "_xmpp._tcp.example.com", "targets": ["10 5 5222 xmpp.example.com"], "recordType": "SRV"}]
+	}`)
+	if code != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d %s", code, body)
+	}
+	want = []string{
+		" A 192.0.2.9 3600",
+		"_sip._tcp SRV 5 5060 sip.example.com 3600",
+	}
+	if got := records(api, "example.com"); !slices.Equal(got, want) {
+		t.Fatalf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestApplyChangesErrors(t *testing.T) {
+	h, _ := newTestWebhook(t)
+
+	for _, tt := range []struct {
+		body string
+		code int
+	}{
+		{`{"create": [`, http.StatusBadRequest},
+		{`{"create": [{"dnsName": "app.example.com", "targets": ["not an address"], "recordType": "A"}]}`, http.StatusInternalServerError},
+	} {
+		if code, body := request(t, h, http.MethodPost, "/records", tt.body); code != tt.code {
+			t.Errorf("%s: expected %d, got %d %s", tt.body, tt.code, code, body)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/records", strings.NewReader(`{}`))
+	req.Header.Set("Content-Type", "text/plain")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected 415, got %d", rec.Code)
+	}
+}
+
+func TestAdjustEndpoints(t *testing.T) {
+	h, _ := newTestWebhook(t)
+
+	code, body := request(t, h, http.MethodPost, "/adjustendpoints", `[
+		{"dnsName": "App.Example.com.", "targets": ["lb.example.net."], "recordType": "cname"},
+		{"dnsName": "a-app.example.com", "targets": ["heritage=external-dns"], "recordType": "TXT", "recordTTL": 60},
+		{"dnsName": "geo.example.com", "targets": ["198.51.100.7"], "recordType": "A", "setIdentifier": "eu"},
+		{"dnsName": "ptr.example.com", "targets": ["host.example.com"], "recordType": "PTR"}
+	]`)
+	if code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d %s", code, body)
+	}
+	var endpoints []Endpoint
+	if err := json.Unmarshal([]byte(body), &endpoints); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, ep := range endpoints {
+		got = append(got, fmt.Sprintf("%s %s %v %d", ep.DNSName, ep.RecordType, ep.Targets, ep.RecordTTL))
+	}
+	want := []string{
+		"app.example.com CNAME [lb.example.net] 300",
+		`a-app.example.com TXT ["heritage=external-dns"] 60`,
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestHealthz(t *testing.T) {
+	h, _ := newTestWebhook(t)
+	if code, body := request(t, h, http.MethodGet, "/healthz", ""); code != http.StatusOK || body != "ok" {
+		t.Errorf("Expected ok, got %d %q", code, body)
+	}
+	if code, _ := request(t, h, http.MethodDelete, "/records", ""); code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405, got %d", code)
+	}
+}
+
+func jsonString(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
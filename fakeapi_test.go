@@ -0,0 +1,51 @@
+package autodns
+
+import (
+	"testing"
+
+	"github.com/saveenergy/libdns-autodns/internal/fakeapi"
+)
+
+// fakeAPI is an in-memory stand-in for the AutoDNS zone API
+type fakeAPI struct {
+	*fakeapi.Server[Zone]
+}
+
+// newFakeAPI starts a fake AutoDNS API serving the given zones
+func newFakeAPI(t *testing.T, zones ...Zone) *fakeAPI {
+	t.Helper()
+	return &fakeAPI{fakeapi.NewServer(t, zones...)}
+}
+
+// provider returns a Provider configured against the fake API
+func (f *fakeAPI) provider() *Provider {
+	return &Provider{
+		Username: fakeapi.Username,
+		Password: fakeapi.Password,
+		Context:  "4",
+		Endpoint: f.URL,
+	}
+}
+
+// testZone returns a small zone used across tests
+func testZone() Zone {
+	return Zone{
+		Origin: "example.com",
+		SOA: &SOA{
+			Refresh: 43200,
+			Retry:   7200,
+			Expire:  1209600,
+			TTL:     86400,
+			Email:   "hostmaster@example.com",
+		},
+		NameServers: []NameServer{
+			{Name: "a.ns14.net"},
+			{Name: "b.ns14.net"},
+		},
+		ResourceRecords: []ResourceRecord{
+			{Name: "www", TTL: 300, Type: "A", Value: "192.0.2.1"},
+			{Name: "", TTL: 300, Type: "MX", Value: "mail.example.com", Pref: 10},
+			{Name: "_acme-challenge", TTL: 60, Type: "TXT", Value: "old-token"},
+		},
+	}
+}
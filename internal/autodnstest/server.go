@@ -0,0 +1,51 @@
+// Package autodnstest provides an in-memory AutoDNS zone API for the tests
+// of packages built on top of the provider.
+package autodnstest
+
+import (
+	"testing"
+
+	autodns "github.com/saveenergy/libdns-autodns"
+	"github.com/saveenergy/libdns-autodns/internal/fakeapi"
+)
+
+// Credentials accepted by the fake API
+const (
+	Username = fakeapi.Username
+	Password = fakeapi.Password
+)
+
+// Server is a fake AutoDNS API serving zones from memory. See
+// fakeapi.Server for the requests it supports.
+type Server struct {
+	*fakeapi.Server[autodns.Zone]
+}
+
+// NewServer starts a fake AutoDNS API serving the given zones. It is closed
+// when the test ends.
+func NewServer(t testing.TB, zones ...autodns.Zone) *Server {
+	t.Helper()
+	return &Server{fakeapi.NewServer(t, zones...)}
+}
+
+// SetEnv starts a fake AutoDNS API serving the given zones and points the
+// AUTODNS_* credential and endpoint variables at it for the rest of the
+// test.
+func SetEnv(t testing.TB, zones ...autodns.Zone) *Server {
+	t.Helper()
+	s := NewServer(t, zones...)
+	t.Setenv(autodns.EnvUsername, Username)
+	t.Setenv(autodns.EnvPassword, Password)
+	t.Setenv(autodns.EnvEndpoint, s.URL)
+	return s
+}
+
+// Provider returns a Provider configured against the server.
+func (s *Server) Provider() *autodns.Provider {
+	return &autodns.Provider{
+		Username: Username,
+		Password: Password,
+		Context:  "4",
+		Endpoint: s.URL,
+	}
+}
@@ -0,0 +1,197 @@
+// Package fakeapi provides an in-memory AutoDNS zone API for tests. It does
+// not import the provider, so the provider's own tests can use it; the
+// tests of other packages use autodnstest, which wraps it.
+package fakeapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Credentials accepted by the fake API
+const (
+	Username = "user"
+	Password = "secret"
+)
+
+// Server is a fake AutoDNS API serving zones of type Z from memory. Z is
+// the provider's Zone type. The server supports the zone search, GET and
+// PUT requests used by the provider.
+type Server[Z any] struct {
+	// URL is the API endpoint of the server
+	URL string
+
+	t        testing.TB
+	mu       sync.Mutex
+	zones    map[string]Z
+	requests []string
+	contexts []string
+	stid     int
+	// rateLimited is the number of following requests answered with
+	// 429 Too Many Requests
+	rateLimited int
+}
+
+// zoneSummary holds the zone fields returned by a zone search
+type zoneSummary struct {
+	Origin            string `json:"origin,omitempty"`
+	VirtualNameServer string `json:"virtualNameServer,omitempty"`
+}
+
+// NewServer starts a fake AutoDNS API serving the given zones. It is closed
+// when the test ends.
+func NewServer[Z any](t testing.TB, zones ...Z) *Server[Z] {
+	t.Helper()
+
+	s := &Server[Z]{t: t, zones: make(map[string]Z)}
+	for _, zone := range zones {
+		s.zones[summarize(t, zone).Origin] = zone
+	}
+	server := httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	t.Cleanup(server.Close)
+	s.URL = server.URL
+	return s
+}
+
+// Zone returns the current server-side state of a zone.
+func (s *Server[Z]) Zone(name string) Z {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.zones[name]
+}
+
+// SetZone replaces the server-side state of a zone, e.g. to simulate a
+// change made outside the provider.
+func (s *Server[Z]) SetZone(zone Z) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.zones[summarize(s.t, zone).Origin] = zone
+}
+
+// Requests returns "METHOD /path" for every request received so far.
+func (s *Server[Z]) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.requests)
+}
+
+// Contexts returns the X-Domainrobot-Context header of every request
+// received so far.
+func (s *Server[Z]) Contexts() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.contexts)
+}
+
+// RateLimit makes the server answer the next n requests with 429 Too Many
+// Requests and a Retry-After of zero.
+func (s *Server[Z]) RateLimit(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rateLimited = n
+}
+
+func (s *Server[Z]) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+	s.contexts = append(s.contexts, r.Header.Get("X-Domainrobot-Context"))
+	s.stid++
+	stid := fmt.Sprintf("20261018-stid-%d", s.stid)
+
+	if s.rateLimited > 0 {
+		s.rateLimited--
+		w.Header().Set("Retry-After", "0")
+		s.respond(w, http.StatusTooManyRequests, stid, "EF429", nil)
+		return
+	}
+
+	if username, password, ok := r.BasicAuth(); !ok || username != Username || password != Password {
+		s.respond(w, http.StatusUnauthorized, stid, "EF01", nil)
+		return
+	}
+
+	if r.Method == http.MethodPost && r.URL.Path == "/zone/_search" {
+		var query struct {
+			View struct {
+				Limit  int `json:"limit"`
+				Offset int `json:"offset"`
+			} `json:"view"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&query); err != nil {
+			s.respond(w, http.StatusBadRequest, stid, "EF03", nil)
+			return
+		}
+		var zones []zoneSummary
+		for _, name := range slices.Sorted(maps.Keys(s.zones)) {
+			zones = append(zones, summarize(s.t, s.zones[name]))
+		}
+		zones = zones[min(query.View.Offset, len(zones)):]
+		zones = zones[:min(query.View.Limit, len(zones))]
+		s.respond(w, http.StatusOK, stid, "", zones)
+		return
+	}
+
+	name, ok := strings.CutPrefix(r.URL.Path, "/zone/")
+	if !ok {
+		s.respond(w, http.StatusNotFound, stid, "EF02", nil)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		zone, ok := s.zones[name]
+		if !ok {
+			s.respond(w, http.StatusNotFound, stid, "EF02", nil)
+			return
+		}
+		s.respond(w, http.StatusOK, stid, "", []Z{zone})
+	case http.MethodPut:
+		var zone Z
+		if err := json.NewDecoder(r.Body).Decode(&zone); err != nil {
+			s.respond(w, http.StatusBadRequest, stid, "EF03", nil)
+			return
+		}
+		s.zones[name] = zone
+		s.respond(w, http.StatusOK, stid, "", []Z{zone})
+	default:
+		s.respond(w, http.StatusMethodNotAllowed, stid, "EF04", nil)
+	}
+}
+
+func (s *Server[Z]) respond(w http.ResponseWriter, status int, stid, errorCode string, data any) {
+	resp := map[string]any{"stid": stid}
+	if errorCode != "" {
+		resp["status"] = map[string]string{"code": errorCode, "text": http.StatusText(status), "type": "ERROR"}
+	} else {
+		resp["status"] = map[string]string{"code": "S0205", "text": "Zone information", "type": "SUCCESS"}
+		resp["data"] = data
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		s.t.Errorf("fake API: failed to encode response: %v", err)
+	}
+}
+
+// summarize returns the origin and virtual name server of a zone
+func summarize[Z any](t testing.TB, zone Z) zoneSummary {
+	var summary zoneSummary
+	data, err := json.Marshal(zone)
+	if err == nil {
+		err = json.Unmarshal(data, &summary)
+	}
+	if err != nil {
+		t.Errorf("fake API: failed to read zone: %v", err)
+	}
+	return summary
+}
@@ -0,0 +1,54 @@
+package autodns
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// LogValue implements slog.LogValuer so a Provider can be logged without
+// leaking its password.
+func (p *Provider) LogValue() slog.Value {
+	password := ""
+	if p.Password != "" {
+		password = "REDACTED"
+	}
+	return slog.GroupValue(
+		slog.String("username", p.Username),
+		slog.String("password", password),
+		slog.String("context", p.Context),
+		slog.String("endpoint", p.Endpoint),
+	)
+}
+
+// logAPIRequest emits one event per AutoDNS API call. Only the method and
+// URL path are logged; headers (and with them the Authorization header)
+// never are.
+func (p *Provider) logAPIRequest(req *http.Request, status int, stid string, duration time.Duration, err error) {
+	attrs := []slog.Attr{
+		slog.String("method", req.Method),
+		slog.String("path", req.URL.Path),
+		slog.Int("status", status),
+		slog.Duration("duration", duration),
+		slog.String("stid", stid),
+	}
+
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+		p.logger().LogAttrs(req.Context(), slog.LevelWarn, "api request failed", attrs...)
+		return
+	}
+	p.logger().LogAttrs(req.Context(), slog.LevelDebug, "api request", attrs...)
+}
+
+// logAPIRetry emits an event before a rate limited or unavailable request
+// is retried.
+func (p *Provider) logAPIRetry(req *http.Request, status, attempt int, wait time.Duration) {
+	p.logger().LogAttrs(req.Context(), slog.LevelWarn, "api request retried",
+		slog.String("method", req.Method),
+		slog.String("path", req.URL.Path),
+		slog.Int("status", status),
+		slog.Int("attempt", attempt),
+		slog.Duration("wait", wait),
+	)
+}
@@ -0,0 +1,73 @@
+package autodns
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/saveenergy/libdns-autodns/internal/fakeapi"
+)
+
+func TestStructuredLogging(t *testing.T) {
+	api := newFakeAPI(t, testZone())
+
+	var logs bytes.Buffer
+	provider := api.provider()
+	provider.Logger = slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	ctx := context.Background()
+	if _, err := provider.GetRecords(ctx, "example.com"); err != nil {
+		t.Fatalf("GetRecords failed: %v", err)
+	}
+	if _, err := provider.AppendRecords(ctx, "example.com", []libdns.Record{
+		libdns.TXT{Name: "test", Text: "value", TTL: 300 * time.Second},
+	}); err != nil {
+		t.Fatalf("AppendRecords failed: %v", err)
+	}
+
+	output := logs.String()
+	for _, want := range []string{
+		`"msg":"api request"`,
+		`"method":"GET"`,
+		`"method":"PUT"`,
+		`"path":"/zone/example.com"`,
+		`"status":200`,
+		`"stid":"20261018-stid-1"`,
+		`"msg":"zone cache miss"`,
+		`"msg":"zone cache hit"`,
+		`"msg":"zone updated"`,
+		`"records":4`,
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected log output to contain %s", want)
+		}
+	}
+
+	// Credentials must never show up in the logs
+	basic := base64.StdEncoding.EncodeToString([]byte(fakeapi.Username + ":" + fakeapi.Password))
+	for _, secret := range []string{fakeapi.Password, basic, "Authorization"} {
+		if strings.Contains(output, secret) {
+			t.Errorf("Log output leaks %q", secret)
+		}
+	}
+}
+
+func TestProviderLogValueRedactsPassword(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+
+	provider := &Provider{Username: "user", Password: "secret", Context: "4"}
+	logger.Info("configured", "provider", provider)
+
+	if strings.Contains(logs.String(), "secret") {
+		t.Errorf("Password leaked into log output: %s", logs.String())
+	}
+	if !strings.Contains(logs.String(), "provider.username=user") {
+		t.Errorf("Expected username in log output, got: %s", logs.String())
+	}
+}
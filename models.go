@@ -2,6 +2,7 @@ package autodns
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/netip"
 	"strconv"
@@ -11,17 +12,26 @@ import (
 	"github.com/libdns/libdns"
 )
 
+// ErrUnsupportedRecord is returned when a record cannot be represented in an
+// AutoDNS zone, either because its Go type is unknown or because AutoDNS does
+// not support its record type.
+var ErrUnsupportedRecord = errors.New("unsupported record")
+
 // AutoDNSTime handles AutoDNS time formats like "2023-12-18T15:25:18.000+0100" and RFC3339
 // It implements json.Unmarshaler
 type AutoDNSTime struct {
 	time.Time
 }
 
+// autoDNSTimeLayout is the time format used by the AutoDNS API
+const autoDNSTimeLayout = "2006-01-02T15:04:05.000-0700"
+
 func (t AutoDNSTime) MarshalJSON() ([]byte, error) {
 	if t.Time.IsZero() {
 		return []byte(`null`), nil
 	}
-	return json.Marshal(t.Time)
+	// Use the AutoDNS format so values round-trip through UnmarshalJSON
+	return json.Marshal(t.Time.Format(autoDNSTimeLayout))
 }
 
 func (t *AutoDNSTime) UnmarshalJSON(b []byte) error {
@@ -32,9 +42,7 @@ func (t *AutoDNSTime) UnmarshalJSON(b []byte) error {
 	}
 
 	// AutoDNS uses format: "2023-12-18T15:25:18.000+0100"
-	layout := "2006-01-02T15:04:05.000-0700"
-
-	parsed, err := time.Parse(layout, s)
+	parsed, err := time.Parse(autoDNSTimeLayout, s)
 	if err != nil {
 		return fmt.Errorf("AutoDNSTime: could not parse time %q: %v", s, err)
 	}
@@ -59,28 +67,28 @@ type Zone struct {
 
 // SOA represents the SOA record structure
 type SOA struct {
-	Refresh int64  `json:"refresh,omitempty"`
-	Retry   int64  `json:"retry,omitempty"`
-	Expire  int64  `json:"expire,omitempty"`
-	TTL     int64  `json:"ttl,omitempty"`
-	Email   string `json:"email,omitempty"`
+	Refresh int64  `json:"refresh,omitempty" yaml:"refresh,omitempty"`
+	Retry   int64  `json:"retry,omitempty" yaml:"retry,omitempty"`
+	Expire  int64  `json:"expire,omitempty" yaml:"expire,omitempty"`
+	TTL     int64  `json:"ttl,omitempty" yaml:"ttl,omitempty"`
+	Email   string `json:"email,omitempty" yaml:"email,omitempty"`
 }
 
 // NameServer represents a nameserver structure
 type NameServer struct {
-	Name        string   `json:"name,omitempty"`
-	TTL         int64    `json:"ttl,omitempty"`
-	IPAddresses []string `json:"ipAddresses,omitempty"`
+	Name        string   `json:"name,omitempty" yaml:"name,omitempty"`
+	TTL         int64    `json:"ttl,omitempty" yaml:"ttl,omitempty"`
+	IPAddresses []string `json:"ipAddresses,omitempty" yaml:"ipAddresses,omitempty"`
 }
 
 // ResourceRecord represents a DNS resource record
 type ResourceRecord struct {
-	Name  string `json:"name,omitempty"`
-	TTL   int64  `json:"ttl,omitempty"`
-	Type  string `json:"type,omitempty"`
-	Value string `json:"value,omitempty"`
-	Pref  int32  `json:"pref,omitempty"`
-	Raw   string `json:"raw,omitempty"`
+	Name  string `json:"name,omitempty" yaml:"name,omitempty"`
+	TTL   int64  `json:"ttl,omitempty" yaml:"ttl,omitempty"`
+	Type  string `json:"type,omitempty" yaml:"type,omitempty"`
+	Value string `json:"value,omitempty" yaml:"value,omitempty"`
+	Pref  int32  `json:"pref,omitempty" yaml:"pref,omitempty"`
+	Raw   string `json:"raw,omitempty" yaml:"raw,omitempty"`
 }
 
 // Convert ResourceRecord to libdns.Record
@@ -191,6 +199,7 @@ func (r ResourceRecord) libdnsRecord(zone string) (libdns.Record, error) {
 			Data: r.Value,
 		}.Parse()
 	default:
+		// Types without a libdns struct (TLSA, PTR, ...) are returned as-is
 		return libdns.RR{
 			Name: name,
 			TTL:  ttl,
@@ -200,8 +209,9 @@ func (r ResourceRecord) libdnsRecord(zone string) (libdns.Record, error) {
 	}
 }
 
-// Convert libdns.Record to ResourceRecord
-func libdnsRecordToResourceRecord(record libdns.Record, zone string) ResourceRecord {
+// Convert libdns.Record to ResourceRecord. Records AutoDNS cannot store are
+// rejected with an error wrapping ErrUnsupportedRecord.
+func libdnsRecordToResourceRecord(record libdns.Record, zone string) (ResourceRecord, error) {
 	var rr ResourceRecord
 
 	switch r := record.(type) {
@@ -246,8 +256,13 @@ func libdnsRecordToResourceRecord(record libdns.Record, zone string) ResourceRec
 			Value: r.Target,
 		}
 	case libdns.SRV:
+		// At the apex, the owner name is only the service and transport
+		name := fmt.Sprintf("_%s._%s", r.Service, r.Transport)
+		if base := libdns.RelativeName(r.Name, zone); base != "@" && base != "" {
+			name += "." + base
+		}
 		rr = ResourceRecord{
-			Name:  fmt.Sprintf("_%s._%s.%s", r.Service, r.Transport, libdns.RelativeName(r.Name, zone)),
+			Name:  name,
 			TTL:   int64(r.TTL / time.Second),
 			Type:  "SRV",
 			Value: fmt.Sprintf("%d %d %s", r.Weight, r.Port, r.Target),
@@ -282,64 +297,40 @@ func libdnsRecordToResourceRecord(record libdns.Record, zone string) ResourceRec
 			Value: value,
 		}
 	case libdns.RR:
-		switch r.Type {
-		case "TXT":
+		switch {
+		case r.Type == "TXT":
 			rr = ResourceRecord{
 				Name:  libdns.RelativeName(r.Name, zone),
 				TTL:   int64(r.TTL / time.Second),
 				Type:  "TXT",
 				Value: r.Data,
 			}
-		case "A", "AAAA":
-			if addr, err := netip.ParseAddr(r.Data); err == nil {
-				rr = ResourceRecord{
-					Name:  libdns.RelativeName(r.Name, zone),
-					TTL:   int64(r.TTL / time.Second),
-					Type:  r.Type,
-					Value: addr.String(),
-				}
-			} else {
-				rr = ResourceRecord{
-					Name:  libdns.RelativeName(r.Name, zone),
-					TTL:   int64(r.TTL / time.Second),
-					Type:  r.Type,
-					Value: r.Data,
-				}
-			}
-		case "CNAME", "MX", "NS", "SRV", "CAA":
+		case isExtendedRecordType(r.Type):
+			// Extended types (TLSA, PTR, ...) are sent verbatim and
+			// checked by validateResourceRecord before the zone is updated
 			rr = ResourceRecord{
 				Name:  libdns.RelativeName(r.Name, zone),
 				TTL:   int64(r.TTL / time.Second),
 				Type:  r.Type,
-				Value: r.Data,
+				Value: strings.TrimSpace(r.Data),
 			}
 		default:
-			fmt.Printf("Warning: Unknown record type %s in libdns.RR - creating generic record\n", r.Type)
-			rr = ResourceRecord{
-				Name:  libdns.RelativeName(r.Name, zone),
-				TTL:   int64(r.TTL / time.Second),
-				Type:  r.Type,
-				Value: r.Data,
+			// Parse into the typed record so MX/SRV preferences end up in
+			// the pref field instead of the value
+			parsed, err := r.Parse()
+			if err != nil {
+				return ResourceRecord{}, fmt.Errorf("invalid %s record %q: %v", r.Type, r.Name, err)
+			}
+			if _, isRR := parsed.(libdns.RR); isRR {
+				return ResourceRecord{}, fmt.Errorf("%w: record type %q", ErrUnsupportedRecord, r.Type)
 			}
+			return libdnsRecordToResourceRecord(parsed, zone)
 		}
 	default:
-		recordName := "unknown"
-		recordType := "UNKNOWN"
-		recordValue := "unknown"
-		recordTTL := int64(0)
-
-		fmt.Printf("Warning: Unknown record type %T - this may indicate a missing record type handler\n", record)
-		fmt.Printf("Record details: %+v\n", record)
-
-		rr = ResourceRecord{
-			Name:  recordName,
-			TTL:   recordTTL,
-			Type:  recordType,
-			Value: recordValue,
-		}
+		return ResourceRecord{}, fmt.Errorf("%w: Go type %T", ErrUnsupportedRecord, record)
 	}
 
-	return rr
+	return rr, nil
 }
 
 // Standard AutoDNS API response structure
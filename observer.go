@@ -0,0 +1,126 @@
+package autodns
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Observer receives provider activity, for example to export metrics.
+// Implementations must be safe for concurrent use and should return quickly,
+// as they are called inline with API requests.
+type Observer interface {
+	// ObserveRequest is called after every AutoDNS API call.
+	ObserveRequest(RequestEvent)
+	// ObserveZoneCache is called for every zone lookup with whether the
+	// zone was served from the cache.
+	ObserveZoneCache(zone string, hit bool)
+	// ObserveZoneUpdate is called after a zone was written successfully.
+	ObserveZoneUpdate(zone string, at time.Time)
+	// ObserveRetry is called before a rate limited or unavailable API call
+	// is retried.
+	ObserveRetry(RetryEvent)
+	// ObserveRateLimitWait is called with the time spent waiting after a
+	// 429 Too Many Requests response before the call was retried.
+	ObserveRateLimitWait(endpoint string, wait time.Duration)
+}
+
+// RequestEvent describes a completed AutoDNS API call.
+type RequestEvent struct {
+	// Method is the HTTP method, e.g. GET or PUT
+	Method string
+	// Endpoint is the API path with zone names replaced by {name}, e.g. /zone/{name}
+	Endpoint string
+	// Status is the HTTP status code, or 0 if no response was received
+	Status int
+	// Duration is the time from sending the request to reading the response
+	Duration time.Duration
+	// STID is the AutoDNS transaction id, if the response carried one
+	STID string
+	// Err is the error returned to the caller, if any
+	Err error
+}
+
+// RetryEvent describes an AutoDNS API call that is about to be retried.
+type RetryEvent struct {
+	// Method is the HTTP method, e.g. GET or PUT
+	Method string
+	// Endpoint is the API path with zone names replaced by {name}
+	Endpoint string
+	// Status is the HTTP status code that caused the retry, 429 or 503
+	Status int
+	// Attempt is the number of the retry, starting at 1
+	Attempt int
+	// Wait is the delay before the retry is sent
+	Wait time.Duration
+}
+
+// observeRequest forwards a completed API call to the Observer
+func (p *Provider) observeRequest(req *http.Request, status int, stid string, duration time.Duration, err error) {
+	if p.Observer == nil {
+		return
+	}
+	p.Observer.ObserveRequest(RequestEvent{
+		Method:   req.Method,
+		Endpoint: endpointTemplate(req.URL.Path),
+		Status:   status,
+		Duration: duration,
+		STID:     stid,
+		Err:      err,
+	})
+}
+
+// observeRetry forwards a retry of an API call to the Observer
+func (p *Provider) observeRetry(req *http.Request, status, attempt int, wait time.Duration) {
+	if p.Observer == nil {
+		return
+	}
+	p.Observer.ObserveRetry(RetryEvent{
+		Method:   req.Method,
+		Endpoint: endpointTemplate(req.URL.Path),
+		Status:   status,
+		Attempt:  attempt,
+		Wait:     wait,
+	})
+}
+
+// observeRateLimitWait forwards the time spent waiting for a rate limit to
+// the Observer
+func (p *Provider) observeRateLimitWait(req *http.Request, wait time.Duration) {
+	if p.Observer == nil {
+		return
+	}
+	p.Observer.ObserveRateLimitWait(endpointTemplate(req.URL.Path), wait)
+}
+
+// endpointTemplate reduces an API path to a low-cardinality template by
+// dropping the endpoint prefix and replacing zone names with {name}.
+// Actions such as /zone/_search are kept verbatim.
+func endpointTemplate(path string) string {
+	i := strings.Index(path, "/zone/")
+	if i < 0 {
+		return path
+	}
+	rest := path[i+len("/zone/"):]
+	if strings.HasPrefix(rest, "_") {
+		return "/zone/" + rest
+	}
+	if _, action, ok := strings.Cut(rest, "/"); ok {
+		return "/zone/{name}/" + action
+	}
+	return "/zone/{name}"
+}
+
+// zoneFromPath returns the zone name of a /zone/{name} API path, or "" for
+// other paths and for actions such as /zone/_search
+func zoneFromPath(path string) string {
+	i := strings.Index(path, "/zone/")
+	if i < 0 {
+		return ""
+	}
+	name, _, _ := strings.Cut(path[i+len("/zone/"):], "/")
+	if strings.HasPrefix(name, "_") {
+		return ""
+	}
+	return name
+}
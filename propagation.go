@@ -0,0 +1,176 @@
+package autodns
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+)
+
+// PropagationOptions configures WaitForPropagation.
+type PropagationOptions struct {
+	// Resolvers overrides the servers that are queried, as host:port. By
+	// default the zone's name servers are queried on port 53.
+	Resolvers []string
+	// Interval is the pause between polling rounds; defaults to 5 seconds
+	Interval time.Duration
+	// QueryTimeout limits each DNS query; defaults to 5 seconds
+	QueryTimeout time.Duration
+}
+
+// Propagation polling defaults
+const (
+	defaultPropagationInterval = 5 * time.Second
+	defaultQueryTimeout        = 5 * time.Second
+)
+
+// WaitForPropagation blocks until every authoritative name server of the
+// zone answers with all of the given records, or until ctx is done. The
+// name servers are queried directly, without recursion, so caches do not
+// matter. TTLs are not compared.
+//
+// Callers should set a deadline on ctx; without one, WaitForPropagation
+// polls until the records appear.
+func (p *Provider) WaitForPropagation(ctx context.Context, zone string, records []libdns.Record, opts PropagationOptions) (err error) {
+	ctx, end := p.startOperation(ctx, "WaitForPropagation", zone, len(records))
+	defer func() { end(err) }()
+
+	if err := p.ensureInitialized(); err != nil {
+		return err
+	}
+
+	if zone == "" {
+		return fmt.Errorf("zone name is required")
+	}
+	if len(records) == 0 {
+		return fmt.Errorf("at least one record is required")
+	}
+
+	expected, err := expectedAnswers(zone, records)
+	if err != nil {
+		return err
+	}
+
+	servers := opts.Resolvers
+	if len(servers) == 0 {
+		zoneData, err := p.getZone(ctx, zone)
+		if err != nil {
+			return err
+		}
+		for _, ns := range zoneData.NameServers {
+			servers = append(servers, net.JoinHostPort(strings.TrimSuffix(ns.Name, "."), "53"))
+		}
+		if len(servers) == 0 {
+			return fmt.Errorf("zone %s has no name servers", zone)
+		}
+	}
+
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = defaultPropagationInterval
+	}
+	client := &dns.Client{Timeout: opts.QueryTimeout}
+	if client.Timeout <= 0 {
+		client.Timeout = defaultQueryTimeout
+	}
+
+	// pending maps each server to the reason it is not done yet
+	pending := make(map[string]string, len(servers))
+	for _, server := range servers {
+		pending[server] = "not queried"
+	}
+
+	start := time.Now()
+	for round := 1; ; round++ {
+		for _, server := range slices.Sorted(maps.Keys(pending)) {
+			reason := checkServer(ctx, client, server, expected)
+			if reason == "" {
+				delete(pending, server)
+				continue
+			}
+			pending[server] = reason
+		}
+
+		if len(pending) == 0 {
+			p.logger().InfoContext(ctx, "records propagated", "zone", zone, "records", len(records),
+				"servers", len(servers), "rounds", round, "duration", time.Since(start))
+			return nil
+		}
+		p.logger().DebugContext(ctx, "waiting for propagation", "zone", zone, "pending", len(pending), "round", round)
+
+		select {
+		case <-ctx.Done():
+			var details []string
+			for _, server := range slices.Sorted(maps.Keys(pending)) {
+				details = append(details, fmt.Sprintf("%s: %s", server, pending[server]))
+			}
+			return fmt.Errorf("records not propagated in zone %s (%s): %w", zone, strings.Join(details, "; "), ctx.Err())
+		case <-time.After(interval):
+		}
+	}
+}
+
+// expectedAnswers converts the records to the DNS resource records the
+// name servers should serve
+func expectedAnswers(zone string, records []libdns.Record) ([]dns.RR, error) {
+	origin := dns.Fqdn(zone)
+
+	var answers []dns.RR
+	for _, record := range records {
+		rr, err := libdnsRecordToResourceRecord(record, zone)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := dns.StringToType[rr.Type]; !ok {
+			return nil, fmt.Errorf("cannot check propagation of %s records", rr.Type)
+		}
+
+		name := origin
+		if n := normalizeRecordName(rr.Name, zone); n != "@" {
+			name = n + "." + origin
+		}
+		answer, err := dns.NewRR(fmt.Sprintf("%s 0 IN %s %s", name, rr.Type, zoneFileRData(rr, origin)))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s record %q: %v", rr.Type, rr.Name, err)
+		}
+		answers = append(answers, answer)
+	}
+	return answers, nil
+}
+
+// checkServer queries server for every expected record. It returns an empty
+// string if all are served and otherwise the reason they are not.
+func checkServer(ctx context.Context, client *dns.Client, server string, expected []dns.RR) string {
+	for _, want := range expected {
+		msg := new(dns.Msg)
+		msg.SetQuestion(want.Header().Name, want.Header().Rrtype)
+		msg.RecursionDesired = false
+
+		resp, _, err := client.ExchangeContext(ctx, msg, server)
+		if err == nil && resp.Truncated {
+			tcp := *client
+			tcp.Net = "tcp"
+			resp, _, err = tcp.ExchangeContext(ctx, msg, server)
+		}
+		if err != nil {
+			return err.Error()
+		}
+		if resp.Rcode != dns.RcodeSuccess {
+			return fmt.Sprintf("%s %s: %s", want.Header().Name, dns.TypeToString[want.Header().Rrtype], dns.RcodeToString[resp.Rcode])
+		}
+
+		found := slices.ContainsFunc(resp.Answer, func(got dns.RR) bool {
+			return dns.IsDuplicate(want, got)
+		})
+		if !found {
+			return fmt.Sprintf("%s %s not served yet", want.Header().Name, dns.TypeToString[want.Header().Rrtype])
+		}
+	}
+	return ""
+}
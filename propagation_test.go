@@ -0,0 +1,146 @@
+package autodns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+)
+
+// testDNSServer is an authoritative DNS server on localhost whose records
+// can be changed while it runs
+type testDNSServer struct {
+	addr string
+
+	mu      sync.Mutex
+	records []dns.RR
+	queries int
+}
+
+func newTestDNSServer(t *testing.T) *testDNSServer {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testDNSServer{addr: conn.LocalAddr().String()}
+	server := &dns.Server{PacketConn: conn, Handler: dns.HandlerFunc(s.serveDNS)}
+	go server.ActivateAndServe()
+	t.Cleanup(func() { server.Shutdown() })
+	return s
+}
+
+func (s *testDNSServer) serveDNS(w dns.ResponseWriter, req *dns.Msg) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queries++
+
+	resp := new(dns.Msg)
+	resp.SetReply(req)
+	resp.Authoritative = true
+	q := req.Question[0]
+	for _, rr := range s.records {
+		if strings.EqualFold(rr.Header().Name, q.Name) && rr.Header().Rrtype == q.Qtype {
+			resp.Answer = append(resp.Answer, rr)
+		}
+	}
+	w.WriteMsg(resp)
+}
+
+func (s *testDNSServer) serve(t *testing.T, records ...string) {
+	t.Helper()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, record := range records {
+		rr, err := dns.NewRR(record)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		s.records = append(s.records, rr)
+	}
+}
+
+func TestWaitForPropagation(t *testing.T) {
+	first, second := newTestDNSServer(t), newTestDNSServer(t)
+	first.serve(t, `_acme-challenge.example.com. 60 IN TXT "token"`, "www.example.com. 300 IN A 192.0.2.1")
+
+	provider := &Provider{Username: "user", Password: "secret"}
+	records := []libdns.Record{
+		libdns.TXT{Name: "_acme-challenge", Text: "token", TTL: time.Minute},
+		libdns.CNAME{Name: "app", Target: "www.example.com.", TTL: time.Minute},
+	}
+	opts := PropagationOptions{Resolvers: []string{first.addr, second.addr}, Interval: 10 * time.Millisecond}
+
+	// Both servers pick up the rest of the change a little later
+	time.AfterFunc(50*time.Millisecond, func() {
+		first.serve(t, "app.example.com. 60 IN CNAME www.example.com.")
+		second.serve(t, `_acme-challenge.example.com. 60 IN TXT "token"`, "APP.example.com. 300 IN CNAME www.example.com.")
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := provider.WaitForPropagation(ctx, "example.com", records, opts); err != nil {
+		t.Fatalf("WaitForPropagation failed: %v", err)
+	}
+	first.mu.Lock()
+	defer first.mu.Unlock()
+	if first.queries < 2 {
+		t.Errorf("Expected repeated queries, got %d", first.queries)
+	}
+}
+
+func TestWaitForPropagationTimeout(t *testing.T) {
+	server := newTestDNSServer(t)
+	server.serve(t, `_acme-challenge.example.com. 60 IN TXT "old-token"`)
+
+	provider := &Provider{Username: "user", Password: "secret"}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	err := provider.WaitForPropagation(ctx, "example.com", []libdns.Record{
+		libdns.TXT{Name: "_acme-challenge", Text: "new-token"},
+	}, PropagationOptions{Resolvers: []string{server.addr}, Interval: 10 * time.Millisecond})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected a deadline error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), server.addr+": _acme-challenge.example.com. TXT not served yet") {
+		t.Errorf("Expected the pending server in the error, got %v", err)
+	}
+}
+
+func TestWaitForPropagationZoneNameServers(t *testing.T) {
+	zone := testZone()
+	zone.NameServers = []NameServer{{Name: "127.0.0.1."}}
+	api := newFakeAPI(t, zone)
+
+	// Without Resolvers the zone's name servers are queried on port 53,
+	// which the test cannot serve; the timeout error shows which servers
+	// were tried
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	err := api.provider().WaitForPropagation(ctx, zone.Origin, []libdns.Record{
+		libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.1")},
+	}, PropagationOptions{Interval: 10 * time.Millisecond, QueryTimeout: 50 * time.Millisecond})
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "127.0.0.1:53") {
+		t.Errorf("Expected the zone's name server on port 53 in the error, got %v", err)
+	}
+}
+
+func TestWaitForPropagationUnsupportedType(t *testing.T) {
+	provider := &Provider{Username: "user", Password: "secret"}
+	err := provider.WaitForPropagation(context.Background(), "example.com", []libdns.Record{
+		libdns.RR{Name: "@", Type: "ALIAS", Data: "target.example.net."},
+	}, PropagationOptions{Resolvers: []string{"127.0.0.1:53"}})
+	if err == nil || !strings.Contains(err.Error(), "ALIAS") {
+		t.Errorf("Expected ALIAS records to be rejected, got %v", err)
+	}
+}
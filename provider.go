@@ -5,9 +5,16 @@ package autodns
 import (
 	"context"
 	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/libdns/libdns"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Provider facilitates DNS record manipulation with AutoDNS.
@@ -16,15 +23,48 @@ type Provider struct {
 	Username string `json:"username,omitempty"`
 	// Password for Basic Authentication
 	Password string `json:"password,omitempty"`
-	// Context number: 1 = demo, 4 = live
+	// Context number: 1 = demo, 4 = live, or a reseller or sub-account context
 	Context string `json:"context,omitempty"`
 	// Endpoint overrides the default API endpoint (optional)
 	Endpoint string `json:"endpoint,omitempty"`
+	// CredentialSource supplies the credentials for each request instead of
+	// Username and Password (optional)
+	CredentialSource CredentialSource `json:"-"`
+	// MaxRetries limits the retries of rate limited (429) and unavailable
+	// (503) requests; 0 uses the default of 3, a negative value disables
+	// retries (optional)
+	MaxRetries int `json:"max_retries,omitempty"`
+	// DryRun computes changes without writing zones (optional)
+	DryRun bool `json:"dry_run,omitempty"`
+	// Logger receives diagnostics; nil discards them (optional)
+	Logger *slog.Logger `json:"-"`
+	// DebugWriter receives redacted dumps of every API request and response (optional)
+	DebugWriter io.Writer `json:"-"`
+	// TracerProvider enables OpenTelemetry spans; nil disables tracing (optional)
+	TracerProvider trace.TracerProvider `json:"-"`
+	// MeterProvider enables OpenTelemetry metrics; nil disables metrics (optional)
+	MeterProvider metric.MeterProvider `json:"-"`
+	// Observer receives request, cache and zone update events (optional)
+	Observer Observer `json:"-"`
+	// BackupStore receives the previous state of a zone before every update (optional)
+	BackupStore BackupStore `json:"-"`
+	// AuditSink receives an entry for every successful zone update (optional)
+	AuditSink AuditSink `json:"-"`
 
 	// Zones is a cache of the zones in the account.
-	zones       map[string]Zone
-	zonesMutex  sync.Mutex
+	zones      map[string]cachedZone
+	zonesMutex sync.Mutex
+	debugMutex sync.Mutex
+
+	initMutex   sync.Mutex
 	initialized bool
+
+	// zoneLocks serializes the read-modify-write cycle of updates per zone
+	zoneLocks      map[string]*sync.Mutex
+	zoneLocksMutex sync.Mutex
+
+	telemetryOnce sync.Once
+	telemetry     *telemetry
 }
 
 // Endpoint URL and default context for the autodns API.
@@ -33,12 +73,34 @@ const (
 	defaultContext  string = "4"
 )
 
-// ensureInitialized sets default values and validates required fields
+// ensureInitialized sets default values and validates required fields. It
+// is safe to call from concurrent first uses of the Provider.
 func (p *Provider) ensureInitialized() error {
+	p.initMutex.Lock()
+	defer p.initMutex.Unlock()
+
 	if p.initialized {
 		return nil
 	}
 
+	if err := p.validate(); err != nil {
+		return err
+	}
+
+	p.initialized = true
+	return nil
+}
+
+// Validate sets default values and checks the configuration without
+// making a request. The record methods validate on first use, so calling it
+// is only needed to report configuration errors early.
+func (p *Provider) Validate() error {
+	return p.ensureInitialized()
+}
+
+// validate sets default values and checks the configuration. It is shared
+// by ensureInitialized and the constructors in config.go.
+func (p *Provider) validate() error {
 	// Set defaults
 	if p.Endpoint == "" {
 		p.Endpoint = defaultEndpoint
@@ -47,20 +109,46 @@ func (p *Provider) ensureInitialized() error {
 		p.Context = defaultContext
 	}
 
+	endpoint, err := url.Parse(p.Endpoint)
+	if err != nil || (endpoint.Scheme != "https" && endpoint.Scheme != "http") || endpoint.Host == "" {
+		return fmt.Errorf("invalid endpoint %q: expected an http or https URL such as %s", p.Endpoint, defaultEndpoint)
+	}
+	if endpoint.RawQuery != "" || endpoint.Fragment != "" {
+		return fmt.Errorf("invalid endpoint %q: query and fragment are not allowed", p.Endpoint)
+	}
+	p.Endpoint = strings.TrimSuffix(p.Endpoint, "/")
+
+	// 1 is demo and 4 live; resellers and sub-accounts use other contexts
+	if context, err := strconv.ParseUint(p.Context, 10, 32); err != nil || context == 0 {
+		return fmt.Errorf("invalid context %q: expected a positive number such as 1 for demo or 4 for live", p.Context)
+	}
+
 	// Validate required fields
+	if p.CredentialSource != nil {
+		return nil
+	}
 	if p.Username == "" {
 		return fmt.Errorf("username is required")
 	}
 	if p.Password == "" {
 		return fmt.Errorf("password is required")
 	}
-
-	p.initialized = true
 	return nil
 }
 
+// logger returns the configured logger or one that discards everything
+func (p *Provider) logger() *slog.Logger {
+	if p.Logger != nil {
+		return p.Logger
+	}
+	return slog.New(slog.DiscardHandler)
+}
+
 // GetRecords lists all the records in the zone.
-func (p *Provider) GetRecords(ctx context.Context, zone string) ([]libdns.Record, error) {
+func (p *Provider) GetRecords(ctx context.Context, zone string) (_ []libdns.Record, err error) {
+	ctx, end := p.startOperation(ctx, "GetRecords", zone, 0)
+	defer func() { end(err) }()
+
 	if err := p.ensureInitialized(); err != nil {
 		return nil, err
 	}
@@ -87,7 +175,10 @@ func (p *Provider) GetRecords(ctx context.Context, zone string) ([]libdns.Record
 }
 
 // AppendRecords adds records to the zone. It returns the records that were added.
-func (p *Provider) AppendRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+func (p *Provider) AppendRecords(ctx context.Context, zone string, records []libdns.Record) (_ []libdns.Record, err error) {
+	ctx, end := p.startOperation(ctx, "AppendRecords", zone, len(records))
+	defer func() { end(err) }()
+
 	if err := p.ensureInitialized(); err != nil {
 		return nil, err
 	}
@@ -100,9 +191,9 @@ func (p *Provider) AppendRecords(ctx context.Context, zone string, records []lib
 		return nil, fmt.Errorf("at least one record is required")
 	}
 
-	err := p.addRecords(ctx, zone, records)
+	err = p.addRecords(ctx, zone, records)
 	if err != nil {
-		return nil, fmt.Errorf("failed to add records to zone %s: %v", zone, err)
+		return nil, fmt.Errorf("failed to add records to zone %s: %w", zone, err)
 	}
 
 	return records, nil
@@ -110,7 +201,10 @@ func (p *Provider) AppendRecords(ctx context.Context, zone string, records []lib
 
 // SetRecords sets the records in the zone, either by updating existing records or creating new ones.
 // It returns the updated records.
-func (p *Provider) SetRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+func (p *Provider) SetRecords(ctx context.Context, zone string, records []libdns.Record) (_ []libdns.Record, err error) {
+	ctx, end := p.startOperation(ctx, "SetRecords", zone, len(records))
+	defer func() { end(err) }()
+
 	if err := p.ensureInitialized(); err != nil {
 		return nil, err
 	}
@@ -123,16 +217,19 @@ func (p *Provider) SetRecords(ctx context.Context, zone string, records []libdns
 		return nil, fmt.Errorf("at least one record is required")
 	}
 
-	err := p.setRecords(ctx, zone, records)
+	err = p.setRecords(ctx, zone, records)
 	if err != nil {
-		return nil, fmt.Errorf("failed to set records in zone %s: %v", zone, err)
+		return nil, fmt.Errorf("failed to set records in zone %s: %w", zone, err)
 	}
 
 	return records, nil
 }
 
 // DeleteRecords deletes the specified records from the zone. It returns the records that were deleted.
-func (p *Provider) DeleteRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+func (p *Provider) DeleteRecords(ctx context.Context, zone string, records []libdns.Record) (_ []libdns.Record, err error) {
+	ctx, end := p.startOperation(ctx, "DeleteRecords", zone, len(records))
+	defer func() { end(err) }()
+
 	if err := p.ensureInitialized(); err != nil {
 		return nil, err
 	}
@@ -145,18 +242,40 @@ func (p *Provider) DeleteRecords(ctx context.Context, zone string, records []lib
 		return nil, fmt.Errorf("at least one record is required")
 	}
 
-	err := p.deleteRecords(ctx, zone, records)
+	err = p.deleteRecords(ctx, zone, records)
 	if err != nil {
-		return nil, fmt.Errorf("failed to delete records from zone %s: %v", zone, err)
+		return nil, fmt.Errorf("failed to delete records from zone %s: %w", zone, err)
 	}
 
 	return records, nil
 }
 
+// ListZones lists the zones in the account.
+func (p *Provider) ListZones(ctx context.Context) (_ []libdns.Zone, err error) {
+	ctx, end := p.startOperation(ctx, "ListZones", "", 0)
+	defer func() { end(err) }()
+
+	if err := p.ensureInitialized(); err != nil {
+		return nil, err
+	}
+
+	zones, err := p.listZones(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list zones: %w", err)
+	}
+
+	result := make([]libdns.Zone, 0, len(zones))
+	for _, zone := range zones {
+		result = append(result, libdns.Zone{Name: zone.Origin})
+	}
+	return result, nil
+}
+
 // Interface guards
 var (
 	_ libdns.RecordGetter   = (*Provider)(nil)
 	_ libdns.RecordAppender = (*Provider)(nil)
 	_ libdns.RecordSetter   = (*Provider)(nil)
 	_ libdns.RecordDeleter  = (*Provider)(nil)
+	_ libdns.ZoneLister     = (*Provider)(nil)
 )
@@ -1,7 +1,12 @@
 package autodns
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
 	"net/netip"
 	"os"
 	"strings"
@@ -300,7 +305,10 @@ func TestServiceBindingSupport(t *testing.T) {
 	}
 
 	// Convert to ResourceRecord
-	rr := libdnsRecordToResourceRecord(svcBinding, zone)
+	rr, err := libdnsRecordToResourceRecord(svcBinding, zone)
+	if err != nil {
+		t.Fatalf("Conversion failed: %v", err)
+	}
 
 	// Verify the conversion
 	if rr.Type != "HTTPS" {
@@ -330,7 +338,10 @@ func TestRRRecordSupport(t *testing.T) {
 	}
 
 	// Convert to ResourceRecord
-	rr := libdnsRecordToResourceRecord(txtRR, zone)
+	rr, err := libdnsRecordToResourceRecord(txtRR, zone)
+	if err != nil {
+		t.Fatalf("Conversion failed: %v", err)
+	}
 
 	// Verify the conversion
 	if rr.Type != "TXT" {
@@ -354,7 +365,10 @@ func TestRRRecordSupport(t *testing.T) {
 		Data: "192.168.1.1",
 	}
 
-	rr = libdnsRecordToResourceRecord(aRR, zone)
+	rr, err = libdnsRecordToResourceRecord(aRR, zone)
+	if err != nil {
+		t.Fatalf("Conversion failed: %v", err)
+	}
 
 	// Verify the conversion
 	if rr.Type != "A" {
@@ -381,7 +395,10 @@ func TestDNS01ChallengeSupport(t *testing.T) {
 	}
 
 	// Convert to ResourceRecord
-	rr := libdnsRecordToResourceRecord(txtRR, zone)
+	rr, err := libdnsRecordToResourceRecord(txtRR, zone)
+	if err != nil {
+		t.Fatalf("Conversion failed: %v", err)
+	}
 
 	// Verify the conversion - should extract just the subdomain part
 	if rr.Type != "TXT" {
@@ -405,7 +422,10 @@ func TestDNS01ChallengeSupport(t *testing.T) {
 		Data: "another-challenge-token",
 	}
 
-	rr = libdnsRecordToResourceRecord(txtRR2, zone)
+	rr, err = libdnsRecordToResourceRecord(txtRR2, zone)
+	if err != nil {
+		t.Fatalf("Conversion failed: %v", err)
+	}
 
 	// Verify the conversion
 	if rr.Name != "_acme-challenge.config" {
@@ -503,4 +523,321 @@ func TestProvider_Validation(t *testing.T) {
 		provider.SetRecords(ctx, "example.com", nil)
 		provider.DeleteRecords(ctx, "example.com", nil)
 	})
+
+	t.Run("Configuration", func(t *testing.T) {
+		tests := []struct {
+			endpoint, context, err string
+		}{
+			{"api.autodns.com/v1", "4", "invalid endpoint"},
+			{"ftp://api.autodns.com", "4", "invalid endpoint"},
+			{"https://api.autodns.com/v1?x=1", "4", "query and fragment are not allowed"},
+			{"https://api.autodns.com/v1", "live", `invalid context "live"`},
+			{"https://api.autodns.com/v1", "0", `invalid context "0"`},
+			{"https://api.autodns.com/v1", "-4", `invalid context "-4"`},
+		}
+		for _, tt := range tests {
+			p := &Provider{Username: "test", Password: "test", Endpoint: tt.endpoint, Context: tt.context}
+			_, err := p.GetRecords(ctx, "example.com")
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Endpoint %q, context %q: expected error containing %q, got %v", tt.endpoint, tt.context, tt.err, err)
+			}
+		}
+
+		// Reseller and sub-account contexts are accepted
+		for _, context := range []string{"1", "4", "10", "2081"} {
+			p := &Provider{Username: "test", Password: "test", Context: context}
+			if err := p.Validate(); err != nil {
+				t.Errorf("Context %q: unexpected error %v", context, err)
+			}
+		}
+
+		// A trailing slash is dropped so request paths stay clean
+		p := &Provider{Username: "test", Password: "test", Endpoint: "https://api.autodns.com/v1/"}
+		if err := p.Validate(); err != nil || p.Endpoint != "https://api.autodns.com/v1" {
+			t.Errorf("Expected the trailing slash to be removed, got %q, %v", p.Endpoint, err)
+		}
+	})
+}
+
+func TestExtendedRecordTypeSupport(t *testing.T) {
+	zone := "example.com"
+
+	// Valid records of each extended type should convert verbatim and validate
+	valid := []libdns.RR{
+		{Name: "_443._tcp.www", TTL: 300 * time.Second, Type: "TLSA", Data: "3 1 1 " + strings.Repeat("ab", 32)},
+		{Name: "host", TTL: 300 * time.Second, Type: "SSHFP", Data: "4 2 " + strings.Repeat("0f", 32)},
+		{Name: "sub", TTL: 300 * time.Second, Type: "DS", Data: "12345 13 2 " + strings.Repeat("AB", 32)},
+		{Name: "@", TTL: 300 * time.Second, Type: "NAPTR", Data: `100 10 "S" "SIP+D2U" "" _sip._udp.example.com.`},
+		{Name: "10", TTL: 300 * time.Second, Type: "PTR", Data: "host.example.com."},
+		{Name: "@", TTL: 300 * time.Second, Type: "LOC", Data: "52 22 23.000 N 4 53 32.000 E -2.00m 0.00m 10000m 10m"},
+		{Name: "host", TTL: 300 * time.Second, Type: "HINFO", Data: `"INTEL-386" "Linux"`},
+		{Name: "@", TTL: 300 * time.Second, Type: "ALIAS", Data: "lb.example.net"},
+	}
+	for _, record := range valid {
+		rr, err := libdnsRecordToResourceRecord(record, zone)
+		if err != nil {
+			t.Fatalf("Conversion failed: %v", err)
+		}
+		if rr.Type != record.Type || rr.Value != record.Data {
+			t.Errorf("%s: expected %s %q, got %s %q", record.Type, record.Type, record.Data, rr.Type, rr.Value)
+		}
+		if err := validateResourceRecord(rr); err != nil {
+			t.Errorf("%s: unexpected validation error: %v", record.Type, err)
+		}
+
+		// Converting back should yield a generic RR with the same data
+		back, err := rr.libdnsRecord(zone)
+		if err != nil {
+			t.Errorf("%s: failed to convert back: %v", record.Type, err)
+		} else if back.RR().Data != record.Data {
+			t.Errorf("%s: expected data %q after round trip, got %q", record.Type, record.Data, back.RR().Data)
+		}
+	}
+
+	invalid := []libdns.RR{
+		{Name: "_443._tcp.www", Type: "TLSA", Data: "3 1 1 abcd"},
+		{Name: "_443._tcp.www", Type: "TLSA", Data: "4 1 1 " + strings.Repeat("ab", 32)},
+		{Name: "host", Type: "SSHFP", Data: "4 2 not-hex"},
+		{Name: "sub", Type: "DS", Data: "12345 13 9 abcd"},
+		{Name: "@", Type: "NAPTR", Data: `100 10 "S" "SIP+D2U" "!^.*$!sip:info@example.com!" _sip._udp.example.com.`},
+		{Name: "10", Type: "PTR", Data: ""},
+		{Name: "@", Type: "LOC", Data: "52 22 23.000 X 4 53 32.000 E -2.00m"},
+		{Name: "host", Type: "HINFO", Data: `"INTEL-386"`},
+		{Name: "@", Type: "ALIAS", Data: "bad target.example.net"},
+	}
+	for _, record := range invalid {
+		rr, err := libdnsRecordToResourceRecord(record, zone)
+		if err != nil {
+			t.Fatalf("Conversion failed: %v", err)
+		}
+		if err := validateResourceRecord(rr); err == nil {
+			t.Errorf("%s: expected validation error for %q, got nil", record.Type, record.Data)
+		}
+	}
+
+	// Invalid records must be rejected before any API call is made
+	provider := &Provider{
+		Username: "test",
+		Password: "test",
+		Endpoint: "http://127.0.0.1:0",
+	}
+	_, err := provider.AppendRecords(context.Background(), zone, []libdns.Record{invalid[0]})
+	if err == nil || !strings.Contains(err.Error(), "invalid TLSA record") {
+		t.Errorf("Expected 'invalid TLSA record' error, got: %v", err)
+	}
+
+	// MX via libdns.RR should carry the preference in the pref field
+	rr, err := libdnsRecordToResourceRecord(libdns.RR{Name: "@", Type: "MX", Data: "10 mail.example.com"}, zone)
+	if err != nil {
+		t.Fatalf("Conversion failed: %v", err)
+	}
+	if rr.Pref != 10 || rr.Value != "mail.example.com" {
+		t.Errorf("Expected MX pref 10 and value mail.example.com, got %d %q", rr.Pref, rr.Value)
+	}
+}
+
+func TestMalformedExistingRecords(t *testing.T) {
+	ctx := context.Background()
+	zone := testZone()
+	malformed := ResourceRecord{Name: "_443._tcp.www", TTL: 300, Type: "TLSA", Value: "3 1 1 abcd"}
+	zone.ResourceRecords = append(zone.ResourceRecords, malformed)
+
+	// A malformed record served by AutoDNS survives a GetRecords/SyncZone
+	// round trip, while new malformed records are still rejected
+	api := newFakeAPI(t, zone)
+	provider := api.provider()
+	records, err := provider.GetRecords(ctx, "example.com")
+	if err != nil {
+		t.Fatalf("GetRecords failed: %v", err)
+	}
+	changes, err := provider.SyncZone(ctx, "example.com", records, SyncOptions{})
+	if err != nil {
+		t.Fatalf("SyncZone of the zone's own records failed: %v", err)
+	}
+	if !changes.Empty() {
+		t.Errorf("Expected no changes, got %s", changes)
+	}
+	invalid := libdns.RR{Name: "_25._tcp.mail", TTL: 300 * time.Second, Type: "TLSA", Data: "3 1 1 abcd"}
+	if _, err := provider.SyncZone(ctx, "example.com", append(records, invalid), SyncOptions{}); err == nil {
+		t.Error("Expected SyncZone to reject a new malformed record")
+	}
+
+	// Deleting matches by name, type and value without validating
+	deleted := libdns.RR{Name: malformed.Name, TTL: 300 * time.Second, Type: malformed.Type, Data: malformed.Value}
+	if _, err := provider.DeleteRecords(ctx, "example.com", []libdns.Record{deleted}); err != nil {
+		t.Fatalf("DeleteRecords failed: %v", err)
+	}
+	for _, rr := range api.Zone("example.com").ResourceRecords {
+		if rr.Type == "TLSA" {
+			t.Errorf("Expected the malformed TLSA record to be deleted, got %+v", rr)
+		}
+	}
+}
+
+// customRecord is a libdns.Record implementation the provider does not know
+type customRecord struct{}
+
+func (customRecord) RR() libdns.RR {
+	return libdns.RR{Name: "custom", Type: "CUSTOM", Data: "value"}
+}
+
+func TestUnsupportedRecordRejection(t *testing.T) {
+	zone := "example.com"
+
+	// Unknown Go types are rejected instead of becoming "UNKNOWN" records
+	_, err := libdnsRecordToResourceRecord(customRecord{}, zone)
+	if !errors.Is(err, ErrUnsupportedRecord) {
+		t.Errorf("Expected ErrUnsupportedRecord for unknown Go type, got: %v", err)
+	}
+
+	// Unknown record types in libdns.RR are rejected as well
+	_, err = libdnsRecordToResourceRecord(libdns.RR{Name: "x", Type: "WKS", Data: "value"}, zone)
+	if !errors.Is(err, ErrUnsupportedRecord) {
+		t.Errorf("Expected ErrUnsupportedRecord for unknown RR type, got: %v", err)
+	}
+
+	// Malformed data for known types is an error too
+	_, err = libdnsRecordToResourceRecord(libdns.RR{Name: "x", Type: "A", Data: "not-an-ip"}, zone)
+	if err == nil {
+		t.Error("Expected error for malformed A record, got nil")
+	}
+
+	// The whole batch is rejected before any API call, and the diagnostic
+	// goes to the configured logger instead of stdout
+	var logs bytes.Buffer
+	provider := &Provider{
+		Username: "test",
+		Password: "test",
+		Endpoint: "http://127.0.0.1:0",
+		Logger:   slog.New(slog.NewTextHandler(&logs, nil)),
+	}
+	valid := libdns.TXT{Name: "ok", Text: "ok"}
+	ctx := context.Background()
+
+	_, err = provider.AppendRecords(ctx, zone, []libdns.Record{valid, customRecord{}})
+	if !errors.Is(err, ErrUnsupportedRecord) {
+		t.Errorf("AppendRecords: expected ErrUnsupportedRecord, got: %v", err)
+	}
+	_, err = provider.SetRecords(ctx, zone, []libdns.Record{valid, customRecord{}})
+	if !errors.Is(err, ErrUnsupportedRecord) {
+		t.Errorf("SetRecords: expected ErrUnsupportedRecord, got: %v", err)
+	}
+	_, err = provider.DeleteRecords(ctx, zone, []libdns.Record{valid, customRecord{}})
+	if !errors.Is(err, ErrUnsupportedRecord) {
+		t.Errorf("DeleteRecords: expected ErrUnsupportedRecord, got: %v", err)
+	}
+
+	if !strings.Contains(logs.String(), "rejecting record batch") {
+		t.Errorf("Expected rejection to be logged, got: %q", logs.String())
+	}
+}
+
+func TestRetryRateLimited(t *testing.T) {
+	ctx := context.Background()
+	record := libdns.TXT{Name: "retry", Text: "value", TTL: 300 * time.Second}
+
+	// The PUT is rate limited twice and then succeeds with the same body
+	api := newFakeAPI(t, testZone())
+	provider := api.provider()
+	if _, err := provider.GetRecords(ctx, "example.com"); err != nil {
+		t.Fatalf("GetRecords failed: %v", err)
+	}
+	api.RateLimit(2)
+	if _, err := provider.AppendRecords(ctx, "example.com", []libdns.Record{record}); err != nil {
+		t.Fatalf("AppendRecords failed: %v", err)
+	}
+	if got := len(api.Zone("example.com").ResourceRecords); got != 4 {
+		t.Errorf("Expected 4 records after the retried update, got %d", got)
+	}
+	if got := api.Requests(); len(got) != 4 {
+		t.Errorf("Expected GET and three PUT attempts, got %v", got)
+	}
+
+	// Without retries the rate limit error is returned right away
+	api = newFakeAPI(t, testZone())
+	provider = api.provider()
+	provider.MaxRetries = -1
+	api.RateLimit(1)
+	if _, err := provider.GetRecords(ctx, "example.com"); err == nil || !strings.Contains(err.Error(), "429") {
+		t.Errorf("Expected a 429 error, got: %v", err)
+	}
+
+	// Once the retries are used up the last error is returned
+	api = newFakeAPI(t, testZone())
+	provider = api.provider()
+	provider.MaxRetries = 1
+	api.RateLimit(2)
+	if _, err := provider.GetRecords(ctx, "example.com"); err == nil {
+		t.Error("Expected an error after the retries were used up")
+	}
+	if got := len(api.Requests()); got != 2 {
+		t.Errorf("Expected 2 attempts, got %d", got)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		retryAfter string
+		attempt    int
+		want       time.Duration
+	}{
+		{"", 1, time.Second},
+		{"", 3, 4 * time.Second},
+		{"", 10, maxRetryDelay},
+		{"5", 1, 5 * time.Second},
+		{"0", 2, 0},
+		{"3600", 1, maxRetryDelay},
+		{time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 1, 0},
+		{"soon", 2, 2 * time.Second},
+	}
+	for _, test := range tests {
+		header := http.Header{}
+		if test.retryAfter != "" {
+			header.Set("Retry-After", test.retryAfter)
+		}
+		if got := retryDelay(header, test.attempt); got != test.want {
+			t.Errorf("retryDelay(%q, %d) = %v, expected %v", test.retryAfter, test.attempt, got, test.want)
+		}
+	}
+}
+
+func TestListZones(t *testing.T) {
+	var zones []Zone
+	for i := range zoneSearchPageSize + 2 {
+		zone := testZone()
+		zone.Origin = fmt.Sprintf("zone%04d.example", i)
+		zones = append(zones, zone)
+	}
+	api := newFakeAPI(t, zones...)
+
+	listed, err := api.provider().ListZones(context.Background())
+	if err != nil {
+		t.Fatalf("ListZones failed: %v", err)
+	}
+	if len(listed) != len(zones) {
+		t.Fatalf("Expected %d zones, got %d", len(zones), len(listed))
+	}
+	if listed[0].Name != "zone0000.example" || listed[len(listed)-1].Name != zones[len(zones)-1].Origin {
+		t.Errorf("Unexpected zones %v ... %v", listed[0], listed[len(listed)-1])
+	}
+	if log := api.Requests(); len(log) != 2 || log[0] != "POST /zone/_search" {
+		t.Errorf("Expected two search pages, got %v", log)
+	}
+}
+
+func TestSRVNames(t *testing.T) {
+	for _, name := range []string{"_sip._tcp", "_sip._tcp.office"} {
+		rr := ResourceRecord{Name: name, TTL: 300, Type: "SRV", Value: "5 5060 sip.example.com", Pref: 10}
+		record, err := rr.libdnsRecord("example.com")
+		if err != nil {
+			t.Fatalf("%s: conversion failed: %v", name, err)
+		}
+		back, err := libdnsRecordToResourceRecord(record, "example.com")
+		if err != nil {
+			t.Fatalf("%s: conversion failed: %v", name, err)
+		}
+		if back != rr {
+			t.Errorf("Expected %+v after a round trip, got %+v", rr, back)
+		}
+	}
 }
@@ -0,0 +1,110 @@
+package rfc2136
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/miekg/dns"
+	"gopkg.in/yaml.v3"
+)
+
+// Policy limits what a TSIG key may change, like a grant of BIND's
+// update-policy.
+type Policy struct {
+	// Zones the key may update, within Server.Zones; empty allows every
+	// zone the server accepts
+	Zones []string `yaml:"zones" json:"zones"`
+	// Names the key may add and delete records at, as absolute names. A
+	// name starting with "*." matches every name below it, e.g.
+	// "*.dhcp.example.com". Empty allows every name in the zones.
+	Names []string `yaml:"names" json:"names"`
+}
+
+// allowsZone reports whether the policy lets the key update zone
+func (p *Policy) allowsZone(zone string) bool {
+	return len(p.Zones) == 0 || containsZone(p.Zones, zone)
+}
+
+// allowsName reports whether the policy lets the key change records at name
+func (p *Policy) allowsName(name string) bool {
+	if len(p.Names) == 0 {
+		return true
+	}
+	name = dns.CanonicalName(name)
+	return slices.ContainsFunc(p.Names, func(pattern string) bool {
+		pattern = dns.CanonicalName(pattern)
+		if parent, ok := strings.CutPrefix(pattern, "*."); ok {
+			return strings.HasSuffix(name, "."+parent)
+		}
+		return name == pattern
+	})
+}
+
+// keyEntry is a key of a keys file: either the secret alone or the secret
+// with a policy
+type keyEntry struct {
+	Secret string `yaml:"secret"`
+	Policy `yaml:",inline"`
+	// restricted is set when the entry has a policy
+	restricted bool
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (e *keyEntry) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		return value.Decode(&e.Secret)
+	}
+	type plain keyEntry
+	var entry plain
+	if err := value.Decode(&entry); err != nil {
+		return err
+	}
+	*e = keyEntry(entry)
+	e.restricted = len(e.Zones) > 0 || len(e.Names) > 0
+	return nil
+}
+
+// LoadKeyFile reads TSIG keys and their policies from a YAML or JSON file.
+// Each key maps to its base64 encoded secret, or to the secret and the
+// zones and names it may update:
+//
+//	certbot.: "bWFrZSBtZSBhIHNlY3JldA=="
+//	dhcp.:
+//	  secret: "YW5vdGhlciBzZWNyZXQ="
+//	  zones: [example.com]
+//	  names: ["*.dhcp.example.com"]
+//
+// The returned policies hold the keys that have one.
+func LoadKeyFile(path string) (map[string]string, map[string]Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var entries map[string]keyEntry
+	if err := yaml.Unmarshal(data, &entries); err != nil {
+		return nil, nil, fmt.Errorf("keys %s: %v", path, err)
+	}
+	if len(entries) == 0 {
+		return nil, nil, fmt.Errorf("keys %s: no keys", path)
+	}
+
+	keys := make(map[string]string, len(entries))
+	policies := make(map[string]Policy)
+	for name, entry := range entries {
+		keys[name] = entry.Secret
+		if entry.restricted {
+			policies[name] = entry.Policy
+		}
+	}
+	return keys, policies, nil
+}
+
+// containsZone reports whether zones contain zone, ignoring case and a
+// trailing dot
+func containsZone(zones []string, zone string) bool {
+	return slices.ContainsFunc(zones, func(z string) bool {
+		return strings.EqualFold(strings.TrimSuffix(z, "."), zone)
+	})
+}
@@ -0,0 +1,313 @@
+// Package rfc2136 accepts DNS UPDATE messages (RFC 2136) authenticated
+// with TSIG (RFC 8945) and applies them to AutoDNS zones, so tools such as
+// certbot's dns-rfc2136 plugin, external-dns and ISC DHCP can manage
+// AutoDNS records unchanged.
+//
+//	server := &rfc2136.Server{
+//		Provider: provider,
+//		Keys:     map[string]string{"certbot.": "base64 secret"},
+//	}
+//	err := server.ListenAndServe(ctx, ":53")
+//
+// Every key may update every zone in Zones, or every zone of the account
+// when Zones is empty. Policies limits individual keys to zones and names:
+//
+//	server.Policies = map[string]rfc2136.Policy{
+//		"dhcp.": {Zones: []string{"example.com"}, Names: []string{"*.dhcp.example.com"}},
+//	}
+//
+// The server only answers UPDATE requests; it is not a name server.
+package rfc2136
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+	autodns "github.com/saveenergy/libdns-autodns"
+)
+
+// updateTimeout limits the AutoDNS requests of one UPDATE message
+const updateTimeout = 30 * time.Second
+
+// Server applies TSIG-signed DNS UPDATE messages to AutoDNS zones. Updates
+// are applied one at a time, and each message is written with a single
+// zone update, so it succeeds or fails as a whole.
+type Server struct {
+	// Provider reads and writes the zones
+	Provider *autodns.Provider
+	// Keys maps TSIG key names to their base64 encoded secrets; requests
+	// must be signed with one of them
+	Keys map[string]string
+	// Zones limits the zones that can be updated; empty allows every zone
+	// of the account (optional)
+	Zones []string
+	// Policies limits the zones and names each key may update, by key
+	// name; keys without a policy may update every zone in Zones (optional)
+	Policies map[string]Policy
+	// Logger receives diagnostics; nil discards them (optional)
+	Logger *slog.Logger
+
+	mu sync.Mutex
+}
+
+// LoadKeys reads TSIG keys from a YAML or JSON file mapping key names to
+// their base64 encoded secrets:
+//
+//	certbot.: "bWFrZSBtZSBhIHNlY3JldA=="
+//	dhcp.:    "YW5vdGhlciBzZWNyZXQ="
+//
+// Files with policies are rejected, so that no limit is lost; read them
+// with LoadKeyFile.
+func LoadKeys(path string) (map[string]string, error) {
+	keys, policies, err := LoadKeyFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(policies) > 0 {
+		return nil, fmt.Errorf("keys %s: the file has policies, which LoadKeys ignores; use LoadKeyFile", path)
+	}
+	return keys, nil
+}
+
+// ListenAndServe serves UPDATE requests over UDP and TCP on addr until ctx
+// is done.
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	return s.Serve(ctx, conn, listener)
+}
+
+// Serve serves UPDATE requests on conn (UDP) and listener (TCP) until ctx
+// is done. Either may be nil.
+func (s *Server) Serve(ctx context.Context, conn net.PacketConn, listener net.Listener) error {
+	secrets, err := s.tsigSecrets()
+	if err != nil {
+		return err
+	}
+
+	var servers []*dns.Server
+	if conn != nil {
+		servers = append(servers, &dns.Server{PacketConn: conn, Handler: s, TsigSecret: secrets, MsgAcceptFunc: acceptUpdate})
+	}
+	if listener != nil {
+		servers = append(servers, &dns.Server{Listener: listener, Handler: s, TsigSecret: secrets, MsgAcceptFunc: acceptUpdate})
+	}
+	if len(servers) == 0 {
+		return fmt.Errorf("rfc2136: nothing to serve")
+	}
+
+	var running []*dns.Server
+	shutdown := func() {
+		for _, server := range running {
+			server.Shutdown()
+		}
+	}
+	errc := make(chan error, len(servers))
+	for _, server := range servers {
+		started := make(chan struct{})
+		server.NotifyStartedFunc = func() { close(started) }
+		go func() { errc <- server.ActivateAndServe() }()
+		select {
+		case <-started:
+			running = append(running, server)
+		case err := <-errc:
+			shutdown()
+			return err
+		}
+	}
+	for name := range secrets {
+		if len(s.Zones) == 0 && len(s.policy(name).Zones) == 0 {
+			s.logger().Warn("TSIG key may update every zone of the account", "key", name)
+		}
+	}
+	s.logger().Info("rfc2136 server started", "zones", s.Zones, "keys", len(secrets))
+
+	select {
+	case err := <-errc:
+		shutdown()
+		return err
+	case <-ctx.Done():
+		shutdown()
+		return ctx.Err()
+	}
+}
+
+// tsigSecrets returns Keys with canonical key names, as expected by
+// dns.Server
+func (s *Server) tsigSecrets() (map[string]string, error) {
+	if len(s.Keys) == 0 {
+		return nil, fmt.Errorf("rfc2136: at least one TSIG key is required")
+	}
+	secrets := make(map[string]string, len(s.Keys))
+	for name, secret := range s.Keys {
+		if _, err := base64.StdEncoding.DecodeString(secret); err != nil || secret == "" {
+			return nil, fmt.Errorf("rfc2136: TSIG key %s: secret must be base64 encoded", name)
+		}
+		secrets[dns.CanonicalName(name)] = secret
+	}
+	for name := range s.Policies {
+		if _, ok := secrets[dns.CanonicalName(name)]; !ok {
+			return nil, fmt.Errorf("rfc2136: policy for unknown TSIG key %s", name)
+		}
+	}
+	return secrets, nil
+}
+
+// acceptUpdate lets UPDATE requests through, which the default accept
+// function of the dns package rejects; other opcodes are answered with
+// NOTIMP by the handler
+func acceptUpdate(dh dns.Header) dns.MsgAcceptAction {
+	const qr = 1 << 15
+	if dh.Bits&qr != 0 {
+		return dns.MsgIgnore
+	}
+	if dh.Qdcount != 1 {
+		return dns.MsgReject
+	}
+	return dns.MsgAccept
+}
+
+// ServeDNS implements dns.Handler.
+func (s *Server) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	resp := new(dns.Msg)
+	resp.SetRcode(req, s.handle(w, req))
+
+	// Sign the response with the key of a correctly signed request
+	if tsig := req.IsTsig(); tsig != nil && w.TsigStatus() == nil {
+		resp.SetTsig(tsig.Hdr.Name, tsig.Algorithm, 300, time.Now().Unix())
+	}
+	if err := w.WriteMsg(resp); err != nil {
+		s.logger().Warn("failed to write response", "client", w.RemoteAddr(), "error", err)
+	}
+}
+
+// handle checks and applies a request and returns the response code
+func (s *Server) handle(w dns.ResponseWriter, req *dns.Msg) int {
+	client := w.RemoteAddr().String()
+	if req.Opcode != dns.OpcodeUpdate {
+		return dns.RcodeNotImplemented
+	}
+	tsig := req.IsTsig()
+	if tsig == nil {
+		s.logger().Warn("unsigned update refused", "client", client)
+		return dns.RcodeRefused
+	}
+	if err := w.TsigStatus(); err != nil {
+		s.logger().Warn("update with invalid signature", "client", client, "key", tsig.Hdr.Name, "error", err)
+		return dns.RcodeNotAuth
+	}
+
+	if len(req.Question) != 1 || req.Question[0].Qtype != dns.TypeSOA || req.Question[0].Qclass != dns.ClassINET {
+		return dns.RcodeFormatError
+	}
+	zone := strings.TrimSuffix(dns.CanonicalName(req.Question[0].Name), ".")
+	if len(s.Zones) > 0 && !containsZone(s.Zones, zone) {
+		s.logger().Warn("update for unknown zone", "client", client, "key", tsig.Hdr.Name, "zone", zone)
+		return dns.RcodeNotAuth
+	}
+	policy := s.policy(tsig.Hdr.Name)
+	if !policy.allowsZone(zone) {
+		s.logger().Warn("update for zone not allowed for key", "client", client, "key", tsig.Hdr.Name, "zone", zone)
+		return dns.RcodeNotAuth
+	}
+	for _, rr := range req.Ns {
+		if !policy.allowsName(rr.Header().Name) {
+			s.logger().Warn("update for name not allowed for key", "client", client, "key", tsig.Hdr.Name, "zone", zone, "name", rr.Header().Name)
+			return dns.RcodeRefused
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), updateTimeout)
+	defer cancel()
+	ctx = autodns.WithActor(ctx, map[string]string{"tsig_key": tsig.Hdr.Name, "client": client})
+
+	rcode, err := s.update(ctx, zone, req)
+	if err != nil {
+		s.logger().Error("update failed", "client", client, "key", tsig.Hdr.Name, "zone", zone, "error", err)
+	} else {
+		s.logger().Info("update", "client", client, "key", tsig.Hdr.Name, "zone", zone, "rcode", dns.RcodeToString[rcode])
+	}
+	return rcode
+}
+
+// update checks the prerequisites of req against the zone and applies its
+// update section. The zone is read and written with Provider.UpdateZone, so
+// the records are kept as AutoDNS stores them and changes made through the
+// Provider meanwhile are not lost.
+func (s *Server) update(ctx context.Context, zone string, req *dns.Msg) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rcode := dns.RcodeSuccess
+	_, err := s.Provider.UpdateZone(ctx, zone, func(records []autodns.ResourceRecord) ([]autodns.ResourceRecord, error) {
+		z := newZoneRecords(zone, records)
+		if rcode = z.checkPrerequisites(req.Answer); rcode != dns.RcodeSuccess {
+			return records, nil
+		}
+		if rcode = z.checkUpdates(req.Ns); rcode != dns.RcodeSuccess {
+			return records, nil
+		}
+		if err := z.apply(req.Ns); err != nil {
+			rcode = dns.RcodeRefused
+			return nil, err
+		}
+		return z.resourceRecords(), nil
+	})
+	switch {
+	case err == nil:
+		return rcode, nil
+	case rcode != dns.RcodeSuccess:
+		return rcode, err
+	case errors.Is(err, autodns.ErrEmptySync):
+		return dns.RcodeRefused, err
+	case !s.zoneExists(ctx, zone):
+		return dns.RcodeNotAuth, err
+	default:
+		return dns.RcodeServerFailure, err
+	}
+}
+
+// policy returns the policy of a key; keys without one are not limited
+func (s *Server) policy(key string) *Policy {
+	for name, policy := range s.Policies {
+		if dns.CanonicalName(name) == dns.CanonicalName(key) {
+			return &policy
+		}
+	}
+	return &Policy{}
+}
+
+// zoneExists reports whether the account has the zone
+func (s *Server) zoneExists(ctx context.Context, zone string) bool {
+	zones, err := s.Provider.ListZones(ctx)
+	if err != nil {
+		return true
+	}
+	return slices.ContainsFunc(zones, func(z libdns.Zone) bool {
+		return strings.EqualFold(strings.TrimSuffix(z.Name, "."), zone)
+	})
+}
+
+func (s *Server) logger() *slog.Logger {
+	if s.Logger != nil {
+		return s.Logger
+	}
+	return slog.New(slog.DiscardHandler)
+}
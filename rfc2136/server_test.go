@@ -0,0 +1,462 @@
+package rfc2136
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	autodns "github.com/saveenergy/libdns-autodns"
+	"github.com/saveenergy/libdns-autodns/internal/autodnstest"
+)
+
+const (
+	testKey    = "certbot."
+	testSecret = "c2VjcmV0IHNoYXJlZCB3aXRoIHRoZSBjbGllbnQ="
+)
+
+// startServer serves a fake example.com zone over UDP and TCP and returns
+// the server address
+func startServer(t *testing.T, zones ...string) (string, *autodnstest.Server) {
+	t.Helper()
+	return startPolicyServer(t, zones, nil)
+}
+
+// startPolicyServer is startServer with policies for the test key
+func startPolicyServer(t *testing.T, zones []string, policies map[string]Policy) (string, *autodnstest.Server) {
+	t.Helper()
+	api := autodnstest.NewServer(t,
+		autodns.Zone{
+			Origin: "example.com",
+			SOA:    &autodns.SOA{TTL: 86400, Email: "hostmaster@example.com"},
+			ResourceRecords: []autodns.ResourceRecord{
+				{Name: "", Type: "A", Value: "192.0.2.1", TTL: 3600},
+				{Name: "www", Type: "A", Value: "192.0.2.1", TTL: 3600},
+				{Name: "", Type: "MX", Value: "mail.example.com", Pref: 10, TTL: 3600},
+			},
+		},
+		autodns.Zone{Origin: "example.org", SOA: &autodns.SOA{TTL: 86400}},
+	)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", conn.LocalAddr().String())
+	if err != nil {
+		conn.Close()
+		t.Fatal(err)
+	}
+
+	server := &Server{Provider: api.Provider(), Keys: map[string]string{testKey: testSecret}, Zones: zones, Policies: policies}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- server.Serve(ctx, conn, listener) }()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	// Wait until the server answers
+	for range 50 {
+		c, err := net.Dial("tcp", listener.Addr().String())
+		if err == nil {
+			c.Close()
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return conn.LocalAddr().String(), api
+}
+
+// newUpdate returns an UPDATE message for zone
+func newUpdate(zone string) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetUpdate(dns.Fqdn(zone))
+	return m
+}
+
+// exchange signs m with secret, unless it is empty, and sends it over net
+func exchange(t *testing.T, addr, net string, m *dns.Msg, secret string) *dns.Msg {
+	t.Helper()
+	c := &dns.Client{Net: net, Timeout: 5 * time.Second}
+	if secret != "" {
+		c.TsigSecret = map[string]string{testKey: secret}
+		m.SetTsig(testKey, dns.HmacSHA256, 300, time.Now().Unix())
+	}
+	resp, _, err := c.Exchange(m, addr)
+	if err != nil {
+		t.Fatalf("Exchange failed: %v", err)
+	}
+	return resp
+}
+
+func mustRR(t *testing.T, s string) dns.RR {
+	t.Helper()
+	rr, err := dns.NewRR(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rr
+}
+
+// records returns the zone records as "name type value"
+func records(api *autodnstest.Server, zone string) []string {
+	var values []string
+	for _, record := range api.Zone(zone).ResourceRecords {
+		values = append(values, fmt.Sprintf("%s %s %s", record.Name, record.Type, record.Value))
+	}
+	slices.Sort(values)
+	return values
+}
+
+func TestUpdateChallenge(t *testing.T) {
+	addr, api := startServer(t)
+
+	// certbot's dns-rfc2136 plugin adds the challenge record ...
+	m := newUpdate("example.com")
+	m.Insert([]dns.RR{mustRR(t, `_acme-challenge.example.com. 60 IN TXT "token"`)})
+	resp := exchange(t, addr, "udp", m, testSecret)
+	if resp.Rcode != dns.RcodeSuccess {
+		t.Fatalf("Expected NOERROR, got %s", dns.RcodeToString[resp.Rcode])
+	}
+	if resp.IsTsig() == nil {
+		t.Errorf("Expected a signed response")
+	}
+	want := []string{" A 192.0.2.1", " MX mail.example.com", "_acme-challenge TXT token", "www A 192.0.2.1"}
+	if got := records(api, "example.com"); !slices.Equal(got, want) {
+		t.Fatalf("Expected %v, got %v", want, got)
+	}
+
+	// ... and removes it again
+	m = newUpdate("example.com")
+	m.Remove([]dns.RR{mustRR(t, `_acme-challenge.example.com. 0 IN TXT "token"`)})
+	if resp := exchange(t, addr, "tcp", m, testSecret); resp.Rcode != dns.RcodeSuccess {
+		t.Fatalf("Expected NOERROR, got %s", dns.RcodeToString[resp.Rcode])
+	}
+	want = []string{" A 192.0.2.1", " MX mail.example.com", "www A 192.0.2.1"}
+	if got := records(api, "example.com"); !slices.Equal(got, want) {
+		t.Fatalf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestUpdateKeepsOtherRecords(t *testing.T) {
+	addr, api := startServer(t)
+
+	// An apex SRV record and a malformed record must survive updates of
+	// other names unchanged
+	zone := api.Zone("example.com")
+	zone.ResourceRecords = append(zone.ResourceRecords,
+		autodns.ResourceRecord{Name: "_sip._tcp", TTL: 3600, Type: "SRV", Value: "5 5060 sip.example.com", Pref: 10},
+		autodns.ResourceRecord{Name: "broken", TTL: 3600, Type: "SRV", Value: "not an srv value"},
+	)
+	api.SetZone(zone)
+	before := api.Zone("example.com").ResourceRecords
+
+	m := newUpdate("example.com")
+	m.Insert([]dns.RR{mustRR(t, "_sip._udp.example.com. 3600 IN SRV 10 5 5060 sip.example.com.")})
+	if resp := exchange(t, addr, "tcp", m, testSecret); resp.Rcode != dns.RcodeSuccess {
+		t.Fatalf("Expected NOERROR, got %s", dns.RcodeToString[resp.Rcode])
+	}
+
+	after := api.Zone("example.com").ResourceRecords
+	for _, rr := range before {
+		if !slices.Contains(after, rr) {
+			t.Errorf("Expected %+v to be kept, got %+v", rr, after)
+		}
+	}
+	added := autodns.ResourceRecord{Name: "_sip._udp", TTL: 3600, Type: "SRV", Value: "5 5060 sip.example.com", Pref: 10}
+	if len(after) != len(before)+1 || !slices.Contains(after, added) {
+		t.Errorf("Expected %+v to be added, got %+v", added, after)
+	}
+}
+
+func TestUpdateReplace(t *testing.T) {
+	addr, api := startServer(t)
+
+	// nsupdate's "update delete www A" followed by "update add"
+	m := newUpdate("example.com")
+	m.RRsetUsed([]dns.RR{mustRR(t, "www.example.com. 0 IN A 0.0.0.0")})
+	m.RemoveRRset([]dns.RR{mustRR(t, "www.example.com. 0 IN A 0.0.0.0")})
+	m.Insert([]dns.RR{
+		mustRR(t, "www.example.com. 300 IN A 198.51.100.7"),
+		mustRR(t, "www.example.com. 300 IN A 198.51.100.8"),
+	})
+	if resp := exchange(t, addr, "udp", m, testSecret); resp.Rcode != dns.RcodeSuccess {
+		t.Fatalf("Expected NOERROR, got %s", dns.RcodeToString[resp.Rcode])
+	}
+	want := []string{" A 192.0.2.1", " MX mail.example.com", "www A 198.51.100.7", "www A 198.51.100.8"}
+	if got := records(api, "example.com"); !slices.Equal(got, want) {
+		t.Fatalf("Expected %v, got %v", want, got)
+	}
+
+	// Deleting a name keeps the others
+	m = newUpdate("example.com")
+	m.RemoveName([]dns.RR{mustRR(t, "www.example.com. 0 IN A 0.0.0.0")})
+	if resp := exchange(t, addr, "udp", m, testSecret); resp.Rcode != dns.RcodeSuccess {
+		t.Fatalf("Expected NOERROR, got %s", dns.RcodeToString[resp.Rcode])
+	}
+	want = []string{" A 192.0.2.1", " MX mail.example.com"}
+	if got := records(api, "example.com"); !slices.Equal(got, want) {
+		t.Fatalf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestUpdatePrerequisites(t *testing.T) {
+	addr, api := startServer(t)
+	before := len(api.Requests())
+
+	tests := []struct {
+		name    string
+		prereqs func(m *dns.Msg)
+		rcode   int
+	}{
+		{"name not used", func(m *dns.Msg) { m.NameNotUsed([]dns.RR{mustRR(t, "www.example.com. 0 IN A 0.0.0.0")}) }, dns.RcodeYXDomain},
+		{"name used", func(m *dns.Msg) { m.NameUsed([]dns.RR{mustRR(t, "new.example.com. 0 IN A 0.0.0.0")}) }, dns.RcodeNameError},
+		{"rrset used", func(m *dns.Msg) { m.RRsetUsed([]dns.RR{mustRR(t, "www.example.com. 0 IN AAAA ::")}) }, dns.RcodeNXRrset},
+		{"rrset not used", func(m *dns.Msg) { m.RRsetNotUsed([]dns.RR{mustRR(t, "www.example.com. 0 IN A 0.0.0.0")}) }, dns.RcodeYXRrset},
+		{"rrset value", func(m *dns.Msg) { m.Used([]dns.RR{mustRR(t, "www.example.com. 0 IN A 192.0.2.2")}) }, dns.RcodeNXRrset},
+		{"outside zone", func(m *dns.Msg) { m.NameUsed([]dns.RR{mustRR(t, "www.example.net. 0 IN A 0.0.0.0")}) }, dns.RcodeNotZone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newUpdate("example.com")
+			tt.prereqs(m)
+			m.Insert([]dns.RR{mustRR(t, "new.example.com. 300 IN A 198.51.100.7")})
+			if resp := exchange(t, addr, "udp", m, testSecret); resp.Rcode != tt.rcode {
+				t.Errorf("Expected %s, got %s", dns.RcodeToString[tt.rcode], dns.RcodeToString[resp.Rcode])
+			}
+		})
+	}
+
+	// Satisfied prerequisites, including the exact RRset value
+	m := newUpdate("example.com")
+	m.Used([]dns.RR{mustRR(t, "www.example.com. 0 IN A 192.0.2.1"), mustRR(t, "example.com. 0 IN MX 10 mail.example.com.")})
+	m.NameNotUsed([]dns.RR{mustRR(t, "new.example.com. 0 IN A 0.0.0.0")})
+	m.Insert([]dns.RR{mustRR(t, "new.example.com. 300 IN A 198.51.100.7")})
+	if resp := exchange(t, addr, "udp", m, testSecret); resp.Rcode != dns.RcodeSuccess {
+		t.Fatalf("Expected NOERROR, got %s", dns.RcodeToString[resp.Rcode])
+	}
+
+	for _, request := range api.Requests()[before:] {
+		if request[:3] == "PUT" {
+			return
+		}
+	}
+	t.Errorf("Expected the zone to be written, got %v", api.Requests()[before:])
+}
+
+func TestUpdateRefused(t *testing.T) {
+	addr, api := startServer(t, "example.com")
+
+	tests := []struct {
+		name   string
+		msg    func() *dns.Msg
+		secret string
+		rcode  int
+	}{
+		{"unsigned", func() *dns.Msg { return newUpdate("example.com") }, "", dns.RcodeRefused},
+		{"wrong secret", func() *dns.Msg { return newUpdate("example.com") }, "d3Jvbmc=", dns.RcodeNotAuth},
+		{"zone not allowed", func() *dns.Msg { return newUpdate("example.org") }, testSecret, dns.RcodeNotAuth},
+		{"query", func() *dns.Msg { return new(dns.Msg).SetQuestion("example.com.", dns.TypeA) }, testSecret, dns.RcodeNotImplemented},
+		{"update outside zone", func() *dns.Msg {
+			m := newUpdate("example.com")
+			m.Insert([]dns.RR{mustRR(t, "www.example.net. 300 IN A 198.51.100.7")})
+			return m
+		}, testSecret, dns.RcodeNotZone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := tt.msg()
+			m.Insert([]dns.RR{mustRR(t, "new.example.com. 300 IN A 198.51.100.7")})
+			c := &dns.Client{Net: "tcp", Timeout: 5 * time.Second}
+			if tt.secret != "" {
+				c.TsigSecret = map[string]string{testKey: tt.secret}
+				m.SetTsig(testKey, dns.HmacSHA256, 300, time.Now().Unix())
+			}
+			// The client rejects the unsigned response to a bad signature,
+			// but still returns it
+			resp, _, err := c.Exchange(m, addr)
+			if resp == nil {
+				t.Fatalf("Exchange failed: %v", err)
+			}
+			if resp.Rcode != tt.rcode {
+				t.Errorf("Expected %s, got %s", dns.RcodeToString[tt.rcode], dns.RcodeToString[resp.Rcode])
+			}
+		})
+	}
+
+	if got := records(api, "example.com"); slices.Contains(got, "new A 198.51.100.7") {
+		t.Errorf("Expected no change, got %v", got)
+	}
+}
+
+func TestUpdateRefusesEmptyingZone(t *testing.T) {
+	addr, api := startServer(t)
+	before := records(api, "example.com")
+
+	m := newUpdate("example.com")
+	m.RemoveName([]dns.RR{
+		mustRR(t, "example.com. 0 IN A 0.0.0.0"),
+		mustRR(t, "www.example.com. 0 IN A 0.0.0.0"),
+	})
+	resp := exchange(t, addr, "tcp", m, testSecret)
+	if resp.Rcode != dns.RcodeRefused {
+		t.Errorf("Expected REFUSED, got %s", dns.RcodeToString[resp.Rcode])
+	}
+	if got := records(api, "example.com"); !slices.Equal(got, before) {
+		t.Errorf("Expected no change, got %v", got)
+	}
+}
+
+func TestUpdatePolicy(t *testing.T) {
+	addr, api := startPolicyServer(t, nil, map[string]Policy{
+		"Certbot": {Zones: []string{"example.com."}, Names: []string{"_acme-challenge.example.com", "*._acme-challenge.example.com"}},
+	})
+
+	tests := []struct {
+		name  string
+		zone  string
+		rr    string
+		rcode int
+	}{
+		{"allowed name", "example.com", `_acme-challenge.example.com. 60 IN TXT "token"`, dns.RcodeSuccess},
+		{"allowed wildcard", "example.com", `x._acme-challenge.example.com. 60 IN TXT "token"`, dns.RcodeSuccess},
+		{"name not allowed", "example.com", "www.example.com. 300 IN A 198.51.100.7", dns.RcodeRefused},
+		{"zone not allowed", "example.org", `_acme-challenge.example.org. 60 IN TXT "token"`, dns.RcodeNotAuth},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newUpdate(tt.zone)
+			m.Insert([]dns.RR{mustRR(t, tt.rr)})
+			m.SetTsig(testKey, dns.HmacSHA256, 300, time.Now().Unix())
+			c := &dns.Client{Net: "tcp", Timeout: 5 * time.Second, TsigSecret: map[string]string{testKey: testSecret}}
+			// The client reports NOTAUTH as an error, but still returns
+			// the response
+			resp, _, err := c.Exchange(m, addr)
+			if resp == nil {
+				t.Fatalf("Exchange failed: %v", err)
+			}
+			if resp.Rcode != tt.rcode {
+				t.Errorf("Expected %s, got %s", dns.RcodeToString[tt.rcode], dns.RcodeToString[resp.Rcode])
+			}
+		})
+	}
+
+	want := []string{" A 192.0.2.1", " MX mail.example.com", "_acme-challenge TXT token", "www A 192.0.2.1", "x._acme-challenge TXT token"}
+	if got := records(api, "example.com"); !slices.Equal(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestServeRequiresKeys(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	for _, keys := range []map[string]string{nil, {"certbot.": "not base64!"}} {
+		server := &Server{Keys: keys}
+		if err := server.Serve(context.Background(), conn, nil); err == nil {
+			t.Errorf("Expected an error for keys %v", keys)
+		}
+	}
+}
+
+func TestLoadKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.yaml")
+	if err := os.WriteFile(path, []byte("certbot.: "+testSecret+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := LoadKeys(path)
+	if err != nil {
+		t.Fatalf("LoadKeys failed: %v", err)
+	}
+	if keys[testKey] != testSecret {
+		t.Errorf("Expected the certbot key, got %v", keys)
+	}
+
+	if err := os.WriteFile(path, []byte("{}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadKeys(path); err == nil {
+		t.Errorf("Expected an error for an empty file")
+	}
+}
+
+func TestLoadKeyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.yaml")
+	data := "certbot.: " + testSecret + "\n" +
+		"dhcp.:\n  secret: " + testSecret + "\n  zones: [example.com]\n  names: [\"*.dhcp.example.com\"]\n"
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, policies, err := LoadKeyFile(path)
+	if err != nil {
+		t.Fatalf("LoadKeyFile failed: %v", err)
+	}
+	if keys["certbot."] != testSecret || keys["dhcp."] != testSecret {
+		t.Errorf("Expected both keys, got %v", keys)
+	}
+	if _, ok := policies["certbot."]; ok || len(policies) != 1 {
+		t.Errorf("Expected a policy for dhcp. only, got %v", policies)
+	}
+	if policy := policies["dhcp."]; !slices.Equal(policy.Zones, []string{"example.com"}) || !slices.Equal(policy.Names, []string{"*.dhcp.example.com"}) {
+		t.Errorf("Unexpected policy %+v", policy)
+	}
+
+	// LoadKeys would drop the policy
+	if _, err := LoadKeys(path); err == nil {
+		t.Error("Expected LoadKeys to reject a file with policies")
+	}
+}
+
+func TestServeWarnsAboutUnlimitedKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		zones    []string
+		policies map[string]Policy
+		warn     bool
+	}{
+		{"no limits", nil, nil, true},
+		{"server zones", []string{"example.com"}, nil, false},
+		{"key zones", nil, map[string]Policy{testKey: {Zones: []string{"example.com"}}}, false},
+		{"key names only", nil, map[string]Policy{testKey: {Names: []string{"*.example.com"}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var logs bytes.Buffer
+			server := &Server{
+				Keys:     map[string]string{testKey: testSecret},
+				Zones:    tt.zones,
+				Policies: tt.policies,
+				Logger:   slog.New(slog.NewTextHandler(&logs, nil)),
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			server.Serve(ctx, conn, nil)
+			if got := strings.Contains(logs.String(), "may update every zone"); got != tt.warn {
+				t.Errorf("Expected warning %v, got logs:\n%s", tt.warn, logs.String())
+			}
+		})
+	}
+
+	server := &Server{Keys: map[string]string{testKey: testSecret}, Policies: map[string]Policy{"other.": {}}}
+	if err := server.Serve(context.Background(), nil, nil); err == nil || !strings.Contains(err.Error(), "unknown TSIG key") {
+		t.Errorf("Expected an error for a policy of an unknown key, got %v", err)
+	}
+}
@@ -0,0 +1,346 @@
+package rfc2136
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+	autodns "github.com/saveenergy/libdns-autodns"
+)
+
+// entry is a record of the zone. rr is nil for records the dns package
+// cannot represent, such as ALIAS or malformed values; they are only
+// matched by name and type and are otherwise kept as they are.
+type entry struct {
+	record autodns.ResourceRecord
+	rr     dns.RR
+	name   string // canonical owner name
+	rtype  string
+}
+
+// zoneRecords is the state of a zone while an update is checked and applied
+type zoneRecords struct {
+	origin  string
+	entries []entry
+}
+
+func newZoneRecords(zone string, records []autodns.ResourceRecord) *zoneRecords {
+	z := &zoneRecords{origin: dns.CanonicalName(zone)}
+	for _, record := range records {
+		z.entries = append(z.entries, z.newEntry(record))
+	}
+	return z
+}
+
+// newEntry converts a zone record to an entry
+func (z *zoneRecords) newEntry(record autodns.ResourceRecord) entry {
+	e := entry{
+		record: record,
+		name:   dns.CanonicalName(libdns.AbsoluteName(record.Name, z.origin)),
+		rtype:  strings.ToUpper(record.Type),
+	}
+	ttl := uint32(record.TTL)
+
+	if e.rtype == "TXT" {
+		e.rr = &dns.TXT{
+			Hdr: dns.RR_Header{Name: e.name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: ttl},
+			Txt: splitTXT(record.Value),
+		}
+		return e
+	}
+	if _, ok := dns.StringToType[e.rtype]; ok {
+		data := record.Value
+		if e.rtype == "MX" || e.rtype == "SRV" {
+			// AutoDNS keeps the preference or priority in its own field
+			data = fmt.Sprintf("%d %s", record.Pref, data)
+		}
+		// AutoDNS keeps targets fully qualified without the trailing dot,
+		// which parses correctly relative to the root
+		parsed, err := dns.NewRR(fmt.Sprintf("%s %d IN %s %s", e.name, ttl, e.rtype, data))
+		if err == nil && parsed != nil {
+			e.rr = parsed
+		}
+	}
+	return e
+}
+
+// fromRR converts an update RR to an entry. Targets are stored without the
+// trailing dot, as AutoDNS keeps them.
+func (z *zoneRecords) fromRR(rr dns.RR) (entry, error) {
+	hdr := rr.Header()
+	name := libdns.RelativeName(dns.CanonicalName(hdr.Name), z.origin)
+	if name == "@" {
+		// AutoDNS names the apex with the empty name
+		name = ""
+	}
+	record := autodns.ResourceRecord{
+		Name: name,
+		TTL:  int64(hdr.Ttl),
+		Type: dns.TypeToString[hdr.Rrtype],
+	}
+
+	switch rr := rr.(type) {
+	case *dns.TXT:
+		record.Value = strings.Join(rr.Txt, "")
+	case *dns.MX:
+		record.Pref = int32(rr.Preference)
+		record.Value = strings.TrimSuffix(rr.Mx, ".")
+	case *dns.SRV:
+		record.Pref = int32(rr.Priority)
+		record.Value = fmt.Sprintf("%d %d %s", rr.Weight, rr.Port, strings.TrimSuffix(rr.Target, "."))
+	case *dns.CNAME:
+		record.Value = strings.TrimSuffix(rr.Target, ".")
+	case *dns.NS:
+		record.Value = strings.TrimSuffix(rr.Ns, ".")
+	case *dns.PTR:
+		record.Value = strings.TrimSuffix(rr.Ptr, ".")
+	default:
+		record.Value = strings.TrimSpace(strings.TrimPrefix(rr.String(), hdr.String()))
+	}
+	if record.Value == "" {
+		return entry{}, fmt.Errorf("invalid %s record %s: no data", record.Type, hdr.Name)
+	}
+	return entry{record: record, rr: rr, name: dns.CanonicalName(hdr.Name), rtype: record.Type}, nil
+}
+
+// inZone reports whether name is the zone apex or below it
+func (z *zoneRecords) inZone(name string) bool {
+	return dns.IsSubDomain(z.origin, dns.CanonicalName(name))
+}
+
+// nameInUse reports whether any record has the name
+func (z *zoneRecords) nameInUse(name string) bool {
+	name = dns.CanonicalName(name)
+	for _, e := range z.entries {
+		if e.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// rrset returns the entries with the name and type
+func (z *zoneRecords) rrset(name string, rtype uint16) []entry {
+	name = dns.CanonicalName(name)
+	var set []entry
+	for _, e := range z.entries {
+		if e.name == name && e.rtype == dns.TypeToString[rtype] {
+			set = append(set, e)
+		}
+	}
+	return set
+}
+
+// checkPrerequisites evaluates the prerequisite section as described in
+// RFC 2136, section 3.2
+func (z *zoneRecords) checkPrerequisites(prereqs []dns.RR) int {
+	// Value-dependent prerequisites are compared per RRset at the end
+	type setKey struct {
+		name  string
+		rtype uint16
+	}
+	var keys []setKey
+	wanted := make(map[setKey][]dns.RR)
+
+	for _, rr := range prereqs {
+		hdr := rr.Header()
+		if hdr.Ttl != 0 {
+			return dns.RcodeFormatError
+		}
+		if !z.inZone(hdr.Name) {
+			return dns.RcodeNotZone
+		}
+
+		switch hdr.Class {
+		case dns.ClassANY:
+			if hdr.Rdlength != 0 {
+				return dns.RcodeFormatError
+			}
+			if hdr.Rrtype == dns.TypeANY {
+				if !z.nameInUse(hdr.Name) {
+					return dns.RcodeNameError
+				}
+			} else if len(z.rrset(hdr.Name, hdr.Rrtype)) == 0 {
+				return dns.RcodeNXRrset
+			}
+		case dns.ClassNONE:
+			if hdr.Rdlength != 0 {
+				return dns.RcodeFormatError
+			}
+			if hdr.Rrtype == dns.TypeANY {
+				if z.nameInUse(hdr.Name) {
+					return dns.RcodeYXDomain
+				}
+			} else if len(z.rrset(hdr.Name, hdr.Rrtype)) > 0 {
+				return dns.RcodeYXRrset
+			}
+		case dns.ClassINET:
+			key := setKey{dns.CanonicalName(hdr.Name), hdr.Rrtype}
+			if _, ok := wanted[key]; !ok {
+				keys = append(keys, key)
+			}
+			wanted[key] = append(wanted[key], rr)
+		default:
+			return dns.RcodeFormatError
+		}
+	}
+
+	for _, key := range keys {
+		set := z.rrset(key.name, key.rtype)
+		if len(set) != len(wanted[key]) {
+			return dns.RcodeNXRrset
+		}
+		for _, rr := range wanted[key] {
+			if !containsRR(set, rr) {
+				return dns.RcodeNXRrset
+			}
+		}
+	}
+	return dns.RcodeSuccess
+}
+
+// checkUpdates prescans the update section as described in RFC 2136,
+// section 3.4.1
+func (z *zoneRecords) checkUpdates(updates []dns.RR) int {
+	for _, rr := range updates {
+		hdr := rr.Header()
+		if !z.inZone(hdr.Name) {
+			return dns.RcodeNotZone
+		}
+		switch hdr.Class {
+		case dns.ClassINET:
+			if isMetaType(hdr.Rrtype) || hdr.Rrtype == dns.TypeANY {
+				return dns.RcodeFormatError
+			}
+		case dns.ClassANY:
+			if hdr.Ttl != 0 || hdr.Rdlength != 0 || isMetaType(hdr.Rrtype) {
+				return dns.RcodeFormatError
+			}
+		case dns.ClassNONE:
+			if hdr.Ttl != 0 || isMetaType(hdr.Rrtype) || hdr.Rrtype == dns.TypeANY {
+				return dns.RcodeFormatError
+			}
+		default:
+			return dns.RcodeFormatError
+		}
+	}
+	return dns.RcodeSuccess
+}
+
+// apply processes the update section as described in RFC 2136, section
+// 3.4.2. The SOA and the name servers of the apex are managed by AutoDNS
+// and left alone.
+func (z *zoneRecords) apply(updates []dns.RR) error {
+	for _, rr := range updates {
+		hdr := rr.Header()
+		name := dns.CanonicalName(hdr.Name)
+		rtype := dns.TypeToString[hdr.Rrtype]
+		protected := func(e entry) bool {
+			return e.name == z.origin && (e.rtype == "SOA" || e.rtype == "NS")
+		}
+
+		switch hdr.Class {
+		case dns.ClassINET:
+			if hdr.Rrtype == dns.TypeSOA || (name == z.origin && hdr.Rrtype == dns.TypeNS) {
+				continue
+			}
+			// A CNAME cannot share its name with other records
+			hasCNAME := len(z.rrset(name, dns.TypeCNAME)) > 0
+			if hdr.Rrtype == dns.TypeCNAME && z.nameInUse(name) && !hasCNAME {
+				continue
+			}
+			if hdr.Rrtype != dns.TypeCNAME && hasCNAME {
+				continue
+			}
+
+			added, err := z.fromRR(rr)
+			if err != nil {
+				return err
+			}
+			z.remove(func(e entry) bool {
+				if hdr.Rrtype == dns.TypeCNAME {
+					return e.name == name && e.rtype == "CNAME"
+				}
+				return e.rr != nil && sameRR(e.rr, rr)
+			})
+			z.entries = append(z.entries, added)
+		case dns.ClassANY:
+			z.remove(func(e entry) bool {
+				return e.name == name && (hdr.Rrtype == dns.TypeANY || e.rtype == rtype) && !protected(e)
+			})
+		case dns.ClassNONE:
+			z.remove(func(e entry) bool {
+				return e.rr != nil && sameRR(e.rr, rr) && !protected(e)
+			})
+		}
+	}
+	return nil
+}
+
+// remove drops the entries matching fn
+func (z *zoneRecords) remove(fn func(entry) bool) {
+	kept := z.entries[:0]
+	for _, e := range z.entries {
+		if !fn(e) {
+			kept = append(kept, e)
+		}
+	}
+	z.entries = kept
+}
+
+// resourceRecords returns the records of the zone
+func (z *zoneRecords) resourceRecords() []autodns.ResourceRecord {
+	records := make([]autodns.ResourceRecord, len(z.entries))
+	for i, e := range z.entries {
+		records[i] = e.record
+	}
+	return records
+}
+
+// containsRR reports whether the set has a record with the same data as rr
+func containsRR(set []entry, rr dns.RR) bool {
+	for _, e := range set {
+		if e.rr != nil && sameRR(e.rr, rr) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameRR compares owner, type and data, ignoring the TTL and class. TXT
+// records are compared by their text, however it is split into strings.
+func sameRR(a, b dns.RR) bool {
+	if a.Header().Rrtype != b.Header().Rrtype || !strings.EqualFold(a.Header().Name, b.Header().Name) {
+		return false
+	}
+	if ta, ok := a.(*dns.TXT); ok {
+		tb, ok := b.(*dns.TXT)
+		return ok && strings.Join(ta.Txt, "") == strings.Join(tb.Txt, "")
+	}
+
+	// IsDuplicate requires the same class
+	a, b = dns.Copy(a), dns.Copy(b)
+	a.Header().Class, b.Header().Class = dns.ClassINET, dns.ClassINET
+	return dns.IsDuplicate(a, b)
+}
+
+// isMetaType reports whether t is a query or transfer type that cannot be
+// stored in a zone; ANY is handled by the callers
+func isMetaType(t uint16) bool {
+	switch t {
+	case dns.TypeAXFR, dns.TypeIXFR, dns.TypeMAILA, dns.TypeMAILB, dns.TypeOPT, dns.TypeTSIG:
+		return true
+	}
+	return false
+}
+
+// splitTXT splits text into character-strings of at most 255 bytes
+func splitTXT(text string) []string {
+	parts := []string{}
+	for len(text) > 255 {
+		parts = append(parts, text[:255])
+		text = text[255:]
+	}
+	return append(parts, text)
+}
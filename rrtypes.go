@@ -0,0 +1,333 @@
+package autodns
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// extendedRecordTypes holds the record types AutoDNS accepts that have no
+// dedicated libdns struct. They are exchanged as libdns.RR, and the value
+// is checked by the registered validator before a zone update is sent.
+var extendedRecordTypes = map[string]func(value string) error{
+	"ALIAS": validateTarget,
+	"DS":    validateDS,
+	"HINFO": validateHINFO,
+	"LOC":   validateLOC,
+	"NAPTR": validateNAPTR,
+	"PTR":   validateTarget,
+	"SSHFP": validateSSHFP,
+	"TLSA":  validateTLSA,
+}
+
+// isExtendedRecordType reports whether recordType is handled through
+// extendedRecordTypes rather than a libdns record struct.
+func isExtendedRecordType(recordType string) bool {
+	_, ok := extendedRecordTypes[recordType]
+	return ok
+}
+
+// validateResourceRecord checks the value of a record before it is sent to
+// AutoDNS. Types without a registered validator are passed through.
+func validateResourceRecord(rr ResourceRecord) error {
+	validate, ok := extendedRecordTypes[rr.Type]
+	if !ok {
+		return nil
+	}
+	if err := validate(rr.Value); err != nil {
+		return fmt.Errorf("invalid %s record %q: %v", rr.Type, rr.Name, err)
+	}
+	return nil
+}
+
+// validateTLSA checks 'usage selector matching-type certificate-data'
+func validateTLSA(value string) error {
+	fields := strings.Fields(value)
+	if len(fields) < 4 {
+		return fmt.Errorf("malformed TLSA value; expected the form 'usage selector matching-type data'")
+	}
+
+	if _, err := parseUint8Field("usage", fields[0], 3); err != nil {
+		return err
+	}
+	if _, err := parseUint8Field("selector", fields[1], 1); err != nil {
+		return err
+	}
+	matchingType, err := parseUint8Field("matching type", fields[2], 2)
+	if err != nil {
+		return err
+	}
+
+	// Matching types 1 and 2 are SHA-256 and SHA-512 digests
+	digestLengths := map[uint8]int{1: 32, 2: 64}
+	return validateHexData("certificate data", strings.Join(fields[3:], ""), digestLengths[matchingType])
+}
+
+// validateSSHFP checks 'algorithm fingerprint-type fingerprint'
+func validateSSHFP(value string) error {
+	fields := strings.Fields(value)
+	if len(fields) < 3 {
+		return fmt.Errorf("malformed SSHFP value; expected the form 'algorithm type fingerprint'")
+	}
+
+	algorithm, err := parseUint8Field("algorithm", fields[0], 255)
+	if err != nil {
+		return err
+	}
+	switch algorithm {
+	case 1, 2, 3, 4, 6: // RSA, DSA, ECDSA, Ed25519, Ed448
+	default:
+		return fmt.Errorf("unknown SSHFP algorithm %d", algorithm)
+	}
+
+	fpType, err := parseUint8Field("fingerprint type", fields[1], 2)
+	if err != nil {
+		return err
+	}
+	// Fingerprint types 1 and 2 are SHA-1 and SHA-256
+	fpLengths := map[uint8]int{1: 20, 2: 32}
+	if _, ok := fpLengths[fpType]; !ok {
+		return fmt.Errorf("unknown SSHFP fingerprint type %d", fpType)
+	}
+
+	return validateHexData("fingerprint", strings.Join(fields[2:], ""), fpLengths[fpType])
+}
+
+// validateDS checks 'key-tag algorithm digest-type digest'
+func validateDS(value string) error {
+	fields := strings.Fields(value)
+	if len(fields) < 4 {
+		return fmt.Errorf("malformed DS value; expected the form 'key-tag algorithm digest-type digest'")
+	}
+
+	if _, err := strconv.ParseUint(fields[0], 10, 16); err != nil {
+		return fmt.Errorf("invalid key tag %s: %v", fields[0], err)
+	}
+	if _, err := parseUint8Field("algorithm", fields[1], 255); err != nil {
+		return err
+	}
+	digestType, err := parseUint8Field("digest type", fields[2], 255)
+	if err != nil {
+		return err
+	}
+
+	// Digest types 1, 2, 3 and 4 are SHA-1, SHA-256, GOST and SHA-384
+	digestLengths := map[uint8]int{1: 20, 2: 32, 3: 32, 4: 48}
+	if _, ok := digestLengths[digestType]; !ok {
+		return fmt.Errorf("unknown DS digest type %d", digestType)
+	}
+
+	return validateHexData("digest", strings.Join(fields[3:], ""), digestLengths[digestType])
+}
+
+// validateNAPTR checks 'order preference "flags" "service" "regexp" replacement'
+func validateNAPTR(value string) error {
+	fields, err := splitRecordFields(value)
+	if err != nil {
+		return err
+	}
+	if len(fields) != 6 {
+		return fmt.Errorf(`malformed NAPTR value; expected 6 fields in the form 'order preference "flags" "service" "regexp" replacement'`)
+	}
+
+	if _, err := strconv.ParseUint(fields[0], 10, 16); err != nil {
+		return fmt.Errorf("invalid order %s: %v", fields[0], err)
+	}
+	if _, err := strconv.ParseUint(fields[1], 10, 16); err != nil {
+		return fmt.Errorf("invalid preference %s: %v", fields[1], err)
+	}
+	for _, c := range fields[2] {
+		if !(c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9') {
+			return fmt.Errorf("invalid flags %q: only alphanumeric characters are allowed", fields[2])
+		}
+	}
+
+	// RFC 3403: regexp and replacement are mutually exclusive
+	replacement := fields[5]
+	if fields[4] != "" && replacement != "." {
+		return fmt.Errorf("regexp and replacement are mutually exclusive; set replacement to '.'")
+	}
+	if replacement != "." {
+		return validateTarget(replacement)
+	}
+	return nil
+}
+
+// validateHINFO checks '"cpu" "os"'
+func validateHINFO(value string) error {
+	fields, err := splitRecordFields(value)
+	if err != nil {
+		return err
+	}
+	if len(fields) != 2 {
+		return fmt.Errorf(`malformed HINFO value; expected 2 fields in the form '"cpu" "os"'`)
+	}
+	return nil
+}
+
+// validateLOC checks the RFC 1876 presentation format:
+// 'd1 [m1 [s1]] N|S d2 [m2 [s2]] E|W alt[m] [size[m] [hp[m] [vp[m]]]]'
+func validateLOC(value string) error {
+	fields := strings.Fields(value)
+
+	rest, err := parseLOCCoordinate(fields, "latitude", 90, "N", "S")
+	if err != nil {
+		return err
+	}
+	rest, err = parseLOCCoordinate(rest, "longitude", 180, "E", "W")
+	if err != nil {
+		return err
+	}
+	if len(rest) == 0 {
+		return fmt.Errorf("malformed LOC value; missing altitude")
+	}
+	if len(rest) > 4 {
+		return fmt.Errorf("malformed LOC value; too many fields")
+	}
+
+	altitude, err := strconv.ParseFloat(strings.TrimSuffix(rest[0], "m"), 64)
+	if err != nil || altitude < -100000 || altitude > 42849672.95 {
+		return fmt.Errorf("invalid altitude %s", rest[0])
+	}
+	for i, name := range []string{"size", "horizontal precision", "vertical precision"} {
+		if len(rest) <= i+1 {
+			break
+		}
+		size, err := strconv.ParseFloat(strings.TrimSuffix(rest[i+1], "m"), 64)
+		if err != nil || size < 0 || size > 90000000 {
+			return fmt.Errorf("invalid %s %s", name, rest[i+1])
+		}
+	}
+	return nil
+}
+
+// parseLOCCoordinate consumes 'degrees [minutes [seconds]] hemisphere' from
+// fields and returns the remaining fields.
+func parseLOCCoordinate(fields []string, name string, maxDegrees uint64, hemispheres ...string) ([]string, error) {
+	for i, field := range fields {
+		if i > 3 {
+			break
+		}
+		if field != hemispheres[0] && field != hemispheres[1] {
+			continue
+		}
+		if i == 0 {
+			return nil, fmt.Errorf("malformed LOC value; missing %s degrees", name)
+		}
+
+		degrees, err := strconv.ParseUint(fields[0], 10, 8)
+		if err != nil || degrees > maxDegrees {
+			return nil, fmt.Errorf("invalid %s degrees %s", name, fields[0])
+		}
+		if i > 1 {
+			minutes, err := strconv.ParseUint(fields[1], 10, 8)
+			if err != nil || minutes > 59 {
+				return nil, fmt.Errorf("invalid %s minutes %s", name, fields[1])
+			}
+		}
+		if i > 2 {
+			seconds, err := strconv.ParseFloat(fields[2], 64)
+			if err != nil || seconds < 0 || seconds >= 60 {
+				return nil, fmt.Errorf("invalid %s seconds %s", name, fields[2])
+			}
+		}
+		return fields[i+1:], nil
+	}
+	return nil, fmt.Errorf("malformed LOC value; expected %s followed by %s or %s", name, hemispheres[0], hemispheres[1])
+}
+
+// validateTarget checks a domain name used as record data (PTR, ALIAS and
+// NAPTR replacement)
+func validateTarget(value string) error {
+	name := strings.TrimSuffix(strings.TrimSpace(value), ".")
+	if name == "" {
+		return fmt.Errorf("target is required")
+	}
+	if len(name) > 253 {
+		return fmt.Errorf("target %q is longer than 253 characters", value)
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 {
+			return fmt.Errorf("target %q contains an empty or overlong label", value)
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				return fmt.Errorf("target %q contains invalid character %q", value, c)
+			}
+		}
+	}
+	return nil
+}
+
+// parseUint8Field parses a numeric record field and checks its upper bound
+func parseUint8Field(name, field string, limit uint8) (uint8, error) {
+	n, err := strconv.ParseUint(field, 10, 8)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %s: %v", name, field, err)
+	}
+	if uint8(n) > limit {
+		return 0, fmt.Errorf("invalid %s %d; must be at most %d", name, n, limit)
+	}
+	return uint8(n), nil
+}
+
+// validateHexData checks that data is hex encoded and, if wantBytes is not
+// zero, that it decodes to exactly wantBytes bytes
+func validateHexData(name, data string, wantBytes int) error {
+	decoded, err := hex.DecodeString(data)
+	if err != nil {
+		return fmt.Errorf("invalid %s: not hex encoded: %v", name, err)
+	}
+	if len(decoded) == 0 {
+		return fmt.Errorf("%s is required", name)
+	}
+	if wantBytes != 0 && len(decoded) != wantBytes {
+		return fmt.Errorf("invalid %s length: got %d bytes, expected %d", name, len(decoded), wantBytes)
+	}
+	return nil
+}
+
+// splitRecordFields splits a record value into fields, honoring double
+// quoted character-strings. Quotes are removed and backslash escapes are
+// resolved.
+func splitRecordFields(value string) ([]string, error) {
+	var fields []string
+	var field strings.Builder
+	inQuotes, inField, escaped := false, false, false
+
+	for _, c := range value {
+		switch {
+		case escaped:
+			field.WriteRune(c)
+			escaped = false
+		case c == '\\':
+			escaped = true
+			inField = true
+		case c == '"':
+			if inQuotes {
+				fields = append(fields, field.String())
+				field.Reset()
+				inField = false
+			}
+			inQuotes = !inQuotes
+		case !inQuotes && (c == ' ' || c == '\t'):
+			if inField {
+				fields = append(fields, field.String())
+				field.Reset()
+				inField = false
+			}
+		default:
+			field.WriteRune(c)
+			inField = true
+		}
+	}
+
+	if inQuotes || escaped {
+		return nil, fmt.Errorf("unterminated quoted string in %q", value)
+	}
+	if inField {
+		fields = append(fields, field.String())
+	}
+	return fields, nil
+}
@@ -0,0 +1,314 @@
+package autodns
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// OperationRestore identifies Restore in change logs.
+const OperationRestore Operation = "restore"
+
+// SnapshotVersion is the version of the snapshot document format written by
+// this package.
+const SnapshotVersion = 1
+
+// SnapshotFormat selects the encoding of a snapshot document.
+type SnapshotFormat string
+
+// Supported snapshot encodings.
+const (
+	SnapshotJSON SnapshotFormat = "json"
+	SnapshotYAML SnapshotFormat = "yaml"
+)
+
+// ZoneSnapshot is a versioned copy of the complete state of a zone: SOA,
+// name servers, zone settings and resource records.
+type ZoneSnapshot struct {
+	Version           int              `json:"version" yaml:"version"`
+	Zone              string           `json:"zone" yaml:"zone"`
+	TakenAt           time.Time        `json:"takenAt" yaml:"takenAt"`
+	SOA               *SOA             `json:"soa,omitempty" yaml:"soa,omitempty"`
+	NameServers       []NameServer     `json:"nameServers,omitempty" yaml:"nameServers,omitempty"`
+	WWWInclude        bool             `json:"wwwInclude" yaml:"wwwInclude"`
+	VirtualNameServer string           `json:"virtualNameServer,omitempty" yaml:"virtualNameServer,omitempty"`
+	ResourceRecords   []ResourceRecord `json:"resourceRecords" yaml:"resourceRecords"`
+}
+
+// RestorePlan describes what restoring a snapshot changes in a zone.
+type RestorePlan struct {
+	// Records holds the resource record changes
+	Records ChangeSet `json:"records"`
+	// SOA, NameServers, WWWInclude and VirtualNameServer report whether the
+	// corresponding zone setting differs from the snapshot
+	SOA               bool `json:"soa"`
+	NameServers       bool `json:"nameServers"`
+	WWWInclude        bool `json:"wwwInclude"`
+	VirtualNameServer bool `json:"virtualNameServer"`
+}
+
+// Empty reports whether restoring would not change the zone.
+func (r RestorePlan) Empty() bool {
+	return r.Records.Empty() && !r.SOA && !r.NameServers && !r.WWWInclude && !r.VirtualNameServer
+}
+
+// String summarizes the plan, e.g. "example.com: +1 -0 ~2 soa nameServers".
+func (r RestorePlan) String() string {
+	return strings.Join(append([]string{r.Records.String()}, r.settings()...), " ")
+}
+
+// settings lists the names of the changed zone settings
+func (r RestorePlan) settings() []string {
+	var names []string
+	for _, setting := range []struct {
+		name    string
+		changed bool
+	}{
+		{"soa", r.SOA},
+		{"nameServers", r.NameServers},
+		{"wwwInclude", r.WWWInclude},
+		{"virtualNameServer", r.VirtualNameServer},
+	} {
+		if setting.changed {
+			names = append(names, setting.name)
+		}
+	}
+	return names
+}
+
+// Snapshot captures the current state of the zone.
+func (p *Provider) Snapshot(ctx context.Context, zone string) (_ *ZoneSnapshot, err error) {
+	ctx, end := p.startOperation(ctx, "Snapshot", zone, 0)
+	defer func() { end(err) }()
+
+	if err := p.ensureInitialized(); err != nil {
+		return nil, err
+	}
+
+	if zone == "" {
+		return nil, fmt.Errorf("zone name is required")
+	}
+
+	zoneData, err := p.getZone(ctx, zone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get zone %s: %v", zone, err)
+	}
+
+	return newZoneSnapshot(zone, zoneData), nil
+}
+
+// CompareSnapshot reports what restoring the snapshot would change, without
+// writing the zone.
+func (p *Provider) CompareSnapshot(ctx context.Context, snapshot *ZoneSnapshot) (_ RestorePlan, err error) {
+	ctx, end := p.startOperation(ctx, "CompareSnapshot", snapshotZone(snapshot), snapshotRecords(snapshot))
+	defer func() { end(err) }()
+
+	current, err := p.snapshotTarget(ctx, snapshot)
+	if err != nil {
+		return RestorePlan{}, err
+	}
+	return planRestore(snapshot.Zone, current, snapshot.apply(current)), nil
+}
+
+// Restore writes the snapshot back to its zone in a single update,
+// replacing the SOA, name servers, zone settings and all resource records.
+// It honors dry-run mode and returns the plan it applied.
+//
+// A snapshot without resource records would remove every record of the
+// zone, so Restore returns ErrEmptySync instead; use SyncZone with
+// AllowEmpty to empty a zone deliberately.
+func (p *Provider) Restore(ctx context.Context, snapshot *ZoneSnapshot) (_ RestorePlan, err error) {
+	ctx, end := p.startOperation(ctx, "Restore", snapshotZone(snapshot), snapshotRecords(snapshot))
+	defer func() { end(err) }()
+
+	return p.restore(ctx, snapshot, OperationRestore, false)
+}
+
+// restore writes the snapshot to its zone as the given operation. Unless
+// allowEmpty is set, a snapshot without records may not empty the zone.
+func (p *Provider) restore(ctx context.Context, snapshot *ZoneSnapshot, operation Operation, allowEmpty bool) (RestorePlan, error) {
+	if snapshot != nil {
+		unlock := p.lockZone(snapshot.Zone)
+		defer unlock()
+	}
+
+	current, err := p.snapshotTarget(ctx, snapshot)
+	if err != nil {
+		return RestorePlan{}, err
+	}
+
+	if len(snapshot.ResourceRecords) == 0 && len(current.ResourceRecords) > 0 && !allowEmpty {
+		return RestorePlan{}, fmt.Errorf("failed to restore zone %s: %w", snapshot.Zone, ErrEmptySync)
+	}
+
+	target := snapshot.apply(current)
+	plan := planRestore(snapshot.Zone, current, target)
+	if _, err := p.updateZone(ctx, snapshot.Zone, operation, current, target); err != nil {
+		return RestorePlan{}, fmt.Errorf("failed to restore zone %s: %w", snapshot.Zone, err)
+	}
+	return plan, nil
+}
+
+// snapshotTarget validates the snapshot and fetches the zone it belongs to
+func (p *Provider) snapshotTarget(ctx context.Context, snapshot *ZoneSnapshot) (Zone, error) {
+	if err := p.ensureInitialized(); err != nil {
+		return Zone{}, err
+	}
+	if err := snapshot.validate(); err != nil {
+		return Zone{}, err
+	}
+
+	current, err := p.getZone(ctx, snapshot.Zone)
+	if err != nil {
+		return Zone{}, fmt.Errorf("failed to get zone %s: %v", snapshot.Zone, err)
+	}
+	return current, nil
+}
+
+// newZoneSnapshot copies the restorable parts of zoneData
+func newZoneSnapshot(zone string, zoneData Zone) *ZoneSnapshot {
+	snapshot := &ZoneSnapshot{
+		Version:           SnapshotVersion,
+		Zone:              strings.TrimSuffix(zone, "."),
+		TakenAt:           time.Now().UTC(),
+		NameServers:       slices.Clone(zoneData.NameServers),
+		WWWInclude:        zoneData.WWWInclude,
+		VirtualNameServer: zoneData.VirtualNameServer,
+		ResourceRecords:   slices.Clone(zoneData.ResourceRecords),
+	}
+	if zoneData.SOA != nil {
+		soa := *zoneData.SOA
+		snapshot.SOA = &soa
+	}
+	if snapshot.ResourceRecords == nil {
+		snapshot.ResourceRecords = []ResourceRecord{}
+	}
+	return snapshot
+}
+
+// apply returns current with the snapshot's state applied. Origin, ROID and
+// other server-side fields are kept from the live zone.
+func (s *ZoneSnapshot) apply(current Zone) Zone {
+	target := current
+	target.SOA = s.SOA
+	target.NameServers = s.NameServers
+	target.WWWInclude = s.WWWInclude
+	target.VirtualNameServer = s.VirtualNameServer
+	target.ResourceRecords = s.ResourceRecords
+	return target
+}
+
+// validate checks that the snapshot can be restored
+func (s *ZoneSnapshot) validate() error {
+	if s == nil {
+		return fmt.Errorf("snapshot is required")
+	}
+	if s.Version != SnapshotVersion {
+		return fmt.Errorf("unsupported snapshot version %d; expected %d", s.Version, SnapshotVersion)
+	}
+	if s.Zone == "" {
+		return fmt.Errorf("snapshot has no zone name")
+	}
+	for _, rr := range s.ResourceRecords {
+		if err := validateResourceRecord(rr); err != nil {
+			return fmt.Errorf("invalid snapshot of %s: %v", s.Zone, err)
+		}
+	}
+	return nil
+}
+
+// snapshotZone and snapshotRecords describe a possibly nil snapshot for
+// telemetry
+func snapshotZone(s *ZoneSnapshot) string {
+	if s == nil {
+		return ""
+	}
+	return s.Zone
+}
+
+func snapshotRecords(s *ZoneSnapshot) int {
+	if s == nil {
+		return 0
+	}
+	return len(s.ResourceRecords)
+}
+
+// planRestore compares the current zone with the restore target
+func planRestore(zone string, current, target Zone) RestorePlan {
+	return RestorePlan{
+		Records:           diffResourceRecords(zone, current.ResourceRecords, target.ResourceRecords),
+		SOA:               !soaEqual(current.SOA, target.SOA),
+		NameServers:       !slices.EqualFunc(current.NameServers, target.NameServers, nameServerEqual),
+		WWWInclude:        current.WWWInclude != target.WWWInclude,
+		VirtualNameServer: current.VirtualNameServer != target.VirtualNameServer,
+	}
+}
+
+// zoneSettingChanges lists the zone settings other than the resource
+// records that differ between two states of a zone
+func zoneSettingChanges(current, target Zone) []string {
+	return planRestore(current.Origin, current, withRecords(target, current.ResourceRecords)).settings()
+}
+
+func soaEqual(a, b *SOA) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func nameServerEqual(a, b NameServer) bool {
+	return strings.EqualFold(strings.TrimSuffix(a.Name, "."), strings.TrimSuffix(b.Name, ".")) &&
+		a.TTL == b.TTL && slices.Equal(a.IPAddresses, b.IPAddresses)
+}
+
+// Encode writes the snapshot in the given format.
+func (s *ZoneSnapshot) Encode(w io.Writer, format SnapshotFormat) error {
+	switch format {
+	case SnapshotJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(s)
+	case SnapshotYAML:
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(s); err != nil {
+			return err
+		}
+		return enc.Close()
+	default:
+		return fmt.Errorf("unknown snapshot format %q", format)
+	}
+}
+
+// DecodeSnapshot reads a snapshot document in the given format and checks
+// its version.
+func DecodeSnapshot(r io.Reader, format SnapshotFormat) (*ZoneSnapshot, error) {
+	var snapshot ZoneSnapshot
+	switch format {
+	case SnapshotJSON:
+		dec := json.NewDecoder(r)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&snapshot); err != nil {
+			return nil, fmt.Errorf("failed to decode snapshot: %v", err)
+		}
+	case SnapshotYAML:
+		dec := yaml.NewDecoder(r)
+		dec.KnownFields(true)
+		if err := dec.Decode(&snapshot); err != nil {
+			return nil, fmt.Errorf("failed to decode snapshot: %v", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown snapshot format %q", format)
+	}
+	if snapshot.Version != SnapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d; expected %d", snapshot.Version, SnapshotVersion)
+	}
+	return &snapshot, nil
+}
@@ -0,0 +1,155 @@
+package autodns
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	ctx := context.Background()
+
+	for _, format := range []SnapshotFormat{SnapshotJSON, SnapshotYAML} {
+		t.Run(string(format), func(t *testing.T) {
+			api := newFakeAPI(t, testZone())
+			provider := api.provider()
+
+			snapshot, err := provider.Snapshot(ctx, "example.com")
+			if err != nil {
+				t.Fatalf("Snapshot failed: %v", err)
+			}
+
+			var buf bytes.Buffer
+			if err := snapshot.Encode(&buf, format); err != nil {
+				t.Fatalf("Encode failed: %v", err)
+			}
+			if !strings.Contains(buf.String(), "resourceRecords") {
+				t.Errorf("Expected JSON field names in the %s document:\n%s", format, buf.String())
+			}
+
+			if format == SnapshotYAML {
+				// Fields keep their order and integers stay integers
+				if !strings.HasPrefix(buf.String(), "version: 1\n") {
+					t.Errorf("Expected the version first:\n%s", buf.String())
+				}
+				if !strings.Contains(buf.String(), "expire: 1209600\n") {
+					t.Errorf("Expected an integer expire:\n%s", buf.String())
+				}
+			}
+
+			decoded, err := DecodeSnapshot(&buf, format)
+			if err != nil {
+				t.Fatalf("DecodeSnapshot failed: %v", err)
+			}
+			if decoded.Zone != "example.com" || len(decoded.ResourceRecords) != 3 || len(decoded.NameServers) != 2 {
+				t.Errorf("Unexpected decoded snapshot %+v", decoded)
+			}
+			if !decoded.TakenAt.Equal(snapshot.TakenAt) {
+				t.Errorf("Expected takenAt %v, got %v", snapshot.TakenAt, decoded.TakenAt)
+			}
+
+			plan, err := provider.CompareSnapshot(ctx, decoded)
+			if err != nil {
+				t.Fatalf("CompareSnapshot failed: %v", err)
+			}
+			if !plan.Empty() {
+				t.Errorf("Expected an unchanged zone to compare equal, got %s", plan)
+			}
+		})
+	}
+}
+
+func TestRestore(t *testing.T) {
+	ctx := context.Background()
+	api := newFakeAPI(t, testZone())
+	provider := api.provider()
+
+	snapshot, err := provider.Snapshot(ctx, "example.com")
+	if err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+
+	// A risky edit after the snapshot was taken
+	changed := api.Zone("example.com")
+	changed.ResourceRecords = changed.ResourceRecords[:1]
+	changed.ResourceRecords[0].Value = "192.0.2.99"
+	changed.SOA.Refresh = 600
+	changed.WWWInclude = true
+	api = newFakeAPI(t, changed)
+	provider = api.provider()
+
+	plan, err := provider.CompareSnapshot(ctx, snapshot)
+	if err != nil {
+		t.Fatalf("CompareSnapshot failed: %v", err)
+	}
+	if plan.String() != "example.com: +2 -0 ~1 soa wwwInclude" {
+		t.Errorf("Unexpected plan %s", plan)
+	}
+
+	provider.DryRun = true
+	if _, err := provider.Restore(ctx, snapshot); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if got := api.Zone("example.com"); got.SOA.Refresh != 600 {
+		t.Error("Expected dry run to leave the zone untouched")
+	}
+
+	provider.DryRun = false
+	if _, err := provider.Restore(ctx, snapshot); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	restored := api.Zone("example.com")
+	if restored.SOA.Refresh != snapshot.SOA.Refresh || restored.WWWInclude || len(restored.ResourceRecords) != 3 {
+		t.Errorf("Zone not restored: %+v", restored)
+	}
+
+	plan, err = provider.CompareSnapshot(ctx, snapshot)
+	if err != nil {
+		t.Fatalf("CompareSnapshot failed: %v", err)
+	}
+	if !plan.Empty() {
+		t.Errorf("Expected no differences after restore, got %s", plan)
+	}
+}
+
+func TestRestoreEmpty(t *testing.T) {
+	ctx := context.Background()
+	api := newFakeAPI(t, testZone())
+	provider := api.provider()
+
+	snapshot, err := provider.Snapshot(ctx, "example.com")
+	if err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+	snapshot.ResourceRecords = []ResourceRecord{}
+
+	if _, err := provider.Restore(ctx, snapshot); !errors.Is(err, ErrEmptySync) {
+		t.Fatalf("Expected ErrEmptySync, got %v", err)
+	}
+	if n := len(api.Zone("example.com").ResourceRecords); n != 3 {
+		t.Errorf("Expected the zone to be kept, got %d records", n)
+	}
+}
+
+func TestDecodeSnapshotErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		format SnapshotFormat
+		input  string
+		msg    string
+	}{
+		{"Version", SnapshotJSON, `{"version": 2, "zone": "example.com"}`, "unsupported snapshot version 2"},
+		{"UnknownField", SnapshotYAML, "version: 1\nzone: example.com\nrecords: []\n", "field records not found"},
+		{"Format", "toml", ``, "unknown snapshot format"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DecodeSnapshot(strings.NewReader(tt.input), tt.format)
+			if err == nil || !strings.Contains(err.Error(), tt.msg) {
+				t.Errorf("Expected error containing %q, got %v", tt.msg, err)
+			}
+		})
+	}
+}
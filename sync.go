@@ -0,0 +1,167 @@
+package autodns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/libdns/libdns"
+)
+
+// OperationSync identifies SyncZone in change logs.
+const OperationSync Operation = "sync"
+
+// ErrEmptySync is returned by SyncZone and by ImportZoneFile in Replace mode
+// when no managed records are desired and applying that would remove all
+// managed records of the zone, and by UpdateZone when an update would remove
+// every record. Set AllowEmpty in SyncOptions or ImportOptions to empty a
+// zone deliberately.
+var ErrEmptySync = errors.New("desired record set is empty")
+
+// SyncOptions configures SyncZone.
+type SyncOptions struct {
+	// Ignore lists records that SyncZone does not manage. Matching records
+	// in the zone are kept as they are, and matching desired records are
+	// skipped.
+	Ignore []IgnoreRule
+	// DryRun computes the changes without writing the zone
+	DryRun bool
+	// AllowEmpty permits an empty desired record set, which removes every
+	// record that is not ignored
+	AllowEmpty bool
+}
+
+// IgnoreRule matches records by name and type. Empty fields match anything.
+type IgnoreRule struct {
+	// Name is a path.Match pattern on the name relative to the zone, with
+	// "@" for the apex, e.g. "_acme-challenge*"
+	Name string `json:"name,omitempty"`
+	// Type is the record type, e.g. "NS"
+	Type string `json:"type,omitempty"`
+}
+
+// matches reports whether the rule applies to the record
+func (r IgnoreRule) matches(rr ResourceRecord, zone string) bool {
+	if r.Type != "" && !strings.EqualFold(r.Type, rr.Type) {
+		return false
+	}
+	if r.Name == "" {
+		return true
+	}
+	matched, _ := path.Match(r.Name, normalizeRecordName(rr.Name, zone))
+	return matched
+}
+
+// validateIgnore checks the name patterns of the rules, so that a malformed
+// pattern is reported instead of matching nothing
+func validateIgnore(rules []IgnoreRule) error {
+	for _, rule := range rules {
+		if _, err := path.Match(rule.Name, ""); err != nil {
+			return fmt.Errorf("invalid ignore pattern %q: %v", rule.Name, err)
+		}
+	}
+	return nil
+}
+
+// ignored reports whether any ignore rule applies to the record
+func (o SyncOptions) ignored(rr ResourceRecord, zone string) bool {
+	for _, rule := range o.Ignore {
+		if rule.matches(rr, zone) {
+			return true
+		}
+	}
+	return false
+}
+
+// SyncZone converges the zone to the desired records in a single update:
+// zone records that are not desired are removed, desired records that are
+// not in the zone are added and changed ones are replaced. It returns the
+// applied changes.
+//
+// If no desired records remain after the ignore rules are applied, SyncZone
+// refuses to remove the zone's records and returns ErrEmptySync unless
+// opts.AllowEmpty is set.
+func (p *Provider) SyncZone(ctx context.Context, zone string, desired []libdns.Record, opts SyncOptions) (_ ChangeSet, err error) {
+	ctx, end := p.startOperation(ctx, "SyncZone", zone, len(desired))
+	defer func() { end(err) }()
+
+	if err := p.ensureInitialized(); err != nil {
+		return ChangeSet{}, err
+	}
+
+	if zone == "" {
+		return ChangeSet{}, fmt.Errorf("zone name is required")
+	}
+
+	if err := validateIgnore(opts.Ignore); err != nil {
+		return ChangeSet{}, err
+	}
+
+	// Convert before touching the zone; values are validated once the
+	// current records are known
+	desiredRecords, err := p.convertRecords(ctx, zone, desired, false)
+	if err != nil {
+		return ChangeSet{}, fmt.Errorf("failed to sync zone %s: %w", zone, err)
+	}
+
+	unlock := p.lockZone(zone)
+	defer unlock()
+
+	zoneData, err := p.getZone(ctx, zone)
+	if err != nil {
+		return ChangeSet{}, fmt.Errorf("failed to get zone %s: %v", zone, err)
+	}
+
+	// Only validate records that are not in the zone yet, so that a zone
+	// holding malformed records can still be synced to its own contents
+	if err := p.validateAdded(ctx, zone, zoneData.ResourceRecords, desiredRecords); err != nil {
+		return ChangeSet{}, fmt.Errorf("failed to sync zone %s: %w", zone, err)
+	}
+
+	// Keep unmanaged records, then add the managed desired state
+	var records []ResourceRecord
+	for _, rr := range zoneData.ResourceRecords {
+		if opts.ignored(rr, zone) {
+			records = append(records, rr)
+		}
+	}
+	kept := len(records)
+	for _, rr := range desiredRecords {
+		if !opts.ignored(rr, zone) {
+			records = append(records, rr)
+		}
+	}
+	if len(records) == kept && kept < len(zoneData.ResourceRecords) && !opts.AllowEmpty {
+		return ChangeSet{}, fmt.Errorf("failed to sync zone %s: %w", zone, ErrEmptySync)
+	}
+
+	if opts.DryRun {
+		ctx = WithDryRun(ctx, nil)
+	}
+	changes, err := p.updateZone(ctx, zone, OperationSync, zoneData, withRecords(zoneData, records))
+	if err != nil {
+		return ChangeSet{}, fmt.Errorf("failed to sync zone %s: %w", zone, err)
+	}
+	return changes, nil
+}
+
+// validateAdded validates the records that are not among the current
+// records of the zone
+func (p *Provider) validateAdded(ctx context.Context, zone string, current, records []ResourceRecord) error {
+	existing := make(map[string]bool, len(current))
+	for _, rr := range current {
+		existing[recordKey(rr, zone, false)] = true
+	}
+	for _, rr := range records {
+		if existing[recordKey(rr, zone, false)] {
+			continue
+		}
+		if err := validateResourceRecord(rr); err != nil {
+			p.logger().WarnContext(ctx, "rejecting record batch", "zone", zone, "records", len(records), "error", err)
+			return err
+		}
+	}
+	return nil
+}
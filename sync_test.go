@@ -0,0 +1,181 @@
+package autodns
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+func TestSyncZone(t *testing.T) {
+	ctx := context.Background()
+	zone := testZone()
+	zone.ResourceRecords = append(zone.ResourceRecords,
+		ResourceRecord{Name: "", TTL: 86400, Type: "NS", Value: "a.ns14.net"},
+		ResourceRecord{Name: "legacy", TTL: 300, Type: "CNAME", Value: "old.example.net"},
+	)
+
+	desired := []libdns.Record{
+		libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.2"), TTL: 300 * time.Second},
+		libdns.MX{Name: "@", Preference: 10, Target: "mail.example.com", TTL: 300 * time.Second},
+		libdns.TXT{Name: "@", Text: "v=spf1 -all", TTL: 300 * time.Second},
+		// Ignored, so it must not be written
+		libdns.TXT{Name: "_acme-challenge", Text: "desired-token", TTL: 60 * time.Second},
+	}
+	opts := SyncOptions{
+		Ignore: []IgnoreRule{
+			{Name: "_acme-challenge*"},
+			{Name: "@", Type: "NS"},
+		},
+	}
+
+	t.Run("DryRun", func(t *testing.T) {
+		api := newFakeAPI(t, zone)
+		dryRun := opts
+		dryRun.DryRun = true
+
+		changes, err := api.provider().SyncZone(ctx, "example.com", desired, dryRun)
+		if err != nil {
+			t.Fatalf("SyncZone failed: %v", err)
+		}
+		if changes.String() != "example.com: +1 -1 ~1" {
+			t.Errorf("Unexpected changes %s: %+v", changes, changes)
+		}
+		if len(api.Requests()) != 1 {
+			t.Errorf("Expected only the zone fetch, got %v", api.Requests())
+		}
+	})
+
+	t.Run("Apply", func(t *testing.T) {
+		api := newFakeAPI(t, zone)
+
+		changes, err := api.provider().SyncZone(ctx, "example.com", desired, opts)
+		if err != nil {
+			t.Fatalf("SyncZone failed: %v", err)
+		}
+		if len(changes.Removes) != 1 || changes.Removes[0].Name != "legacy" {
+			t.Errorf("Expected the legacy CNAME to be removed, got %+v", changes.Removes)
+		}
+		if len(changes.Modifications) != 1 || changes.Modifications[0].After.Value != "192.0.2.2" {
+			t.Errorf("Expected the www address to change, got %+v", changes.Modifications)
+		}
+		if len(changes.Adds) != 1 || changes.Adds[0].Type != "TXT" {
+			t.Errorf("Expected the SPF record to be added, got %+v", changes.Adds)
+		}
+
+		// One write, and ignored records are untouched
+		log := api.Requests()
+		if len(log) != 2 || log[1] != "PUT /zone/example.com" {
+			t.Errorf("Expected a single zone update, got %v", log)
+		}
+		found := map[string]string{}
+		for _, rr := range api.Zone("example.com").ResourceRecords {
+			found[rr.Type+":"+rr.Name] = rr.Value
+		}
+		if found["TXT:_acme-challenge"] != "old-token" {
+			t.Errorf("Expected ignored ACME token to be kept, got %q", found["TXT:_acme-challenge"])
+		}
+		if found["NS:"] != "a.ns14.net" {
+			t.Error("Expected ignored apex NS record to be kept")
+		}
+
+		// A second sync converges to no changes
+		changes, err = api.provider().SyncZone(ctx, "example.com", desired, opts)
+		if err != nil {
+			t.Fatalf("Second SyncZone failed: %v", err)
+		}
+		if !changes.Empty() {
+			t.Errorf("Expected no changes on second sync, got %+v", changes)
+		}
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		api := newFakeAPI(t, zone)
+		onlyIgnored := []libdns.Record{desired[3]}
+
+		_, err := api.provider().SyncZone(ctx, "example.com", onlyIgnored, opts)
+		if !errors.Is(err, ErrEmptySync) {
+			t.Errorf("Expected ErrEmptySync, got: %v", err)
+		}
+		if len(api.Requests()) != 1 {
+			t.Errorf("Expected only the zone fetch, got %v", api.Requests())
+		}
+
+		allowEmpty := opts
+		allowEmpty.AllowEmpty = true
+		changes, err := api.provider().SyncZone(ctx, "example.com", nil, allowEmpty)
+		if err != nil {
+			t.Fatalf("SyncZone with AllowEmpty failed: %v", err)
+		}
+		if len(changes.Removes) != 3 {
+			t.Errorf("Expected all 3 managed records to be removed, got %+v", changes.Removes)
+		}
+	})
+
+	t.Run("InvalidPattern", func(t *testing.T) {
+		api := newFakeAPI(t, zone)
+		_, err := api.provider().SyncZone(ctx, "example.com", desired, SyncOptions{Ignore: []IgnoreRule{{Name: "["}}})
+		if err == nil {
+			t.Error("Expected error for invalid ignore pattern")
+		}
+	})
+}
+
+func TestSyncZoneApexSRV(t *testing.T) {
+	ctx := context.Background()
+	zone := testZone()
+	zone.ResourceRecords = append(zone.ResourceRecords,
+		ResourceRecord{Name: "_sip._tcp", TTL: 300, Type: "SRV", Value: "5 5060 sip.example.com", Pref: 10},
+	)
+	api := newFakeAPI(t, zone)
+	provider := api.provider()
+
+	records, err := provider.GetRecords(ctx, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes, err := provider.SyncZone(ctx, "example.com", records, SyncOptions{})
+	if err != nil {
+		t.Fatalf("SyncZone failed: %v", err)
+	}
+	if changes.String() != "example.com: +0 -0 ~0" {
+		t.Errorf("Expected the SRV record to be kept as it is, got %+v", changes)
+	}
+}
+
+func TestSyncZoneIdempotent(t *testing.T) {
+	ctx := context.Background()
+	zone := testZone()
+	zone.ResourceRecords = append(zone.ResourceRecords,
+		ResourceRecord{Name: "", TTL: 300, Type: "A", Value: "192.0.2.10"},
+		ResourceRecord{Name: "", TTL: 300, Type: "TXT", Value: "v=spf1 -all"},
+		ResourceRecord{Name: "www", TTL: 300, Type: "AAAA", Value: "2001:db8::1"},
+		ResourceRecord{Name: "shop", TTL: 300, Type: "CNAME", Value: "shops.example.net"},
+		ResourceRecord{Name: "", TTL: 300, Type: "CAA", Value: `0 issue "letsencrypt.org"`},
+		ResourceRecord{Name: "sub", TTL: 86400, Type: "NS", Value: "ns1.example.net"},
+		ResourceRecord{Name: "_sip._tcp.office", TTL: 300, Type: "SRV", Value: "5 5060 sip.example.com", Pref: 10},
+	)
+	api := newFakeAPI(t, zone)
+	provider := api.provider()
+
+	records, err := provider.GetRecords(ctx, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes, err := provider.SyncZone(ctx, "example.com", records, SyncOptions{})
+	if err != nil {
+		t.Fatalf("SyncZone failed: %v", err)
+	}
+	if changes.String() != "example.com: +0 -0 ~0" {
+		t.Errorf("Expected syncing the zone's own records to change nothing, got %+v", changes)
+	}
+	for _, req := range api.Requests() {
+		if strings.HasPrefix(req, "PUT") {
+			t.Errorf("Expected no zone update, got %v", api.Requests())
+		}
+	}
+}
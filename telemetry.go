@@ -0,0 +1,179 @@
+package autodns
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	metricnoop "go.opentelemetry.io/otel/metric/noop"
+	"go.opentelemetry.io/otel/trace"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
+)
+
+// instrumentationName identifies this package as the OpenTelemetry
+// instrumentation scope
+const instrumentationName = "github.com/saveenergy/libdns-autodns"
+
+// telemetry holds the OpenTelemetry tracer and instruments of a Provider
+type telemetry struct {
+	tracer            trace.Tracer
+	requests          metric.Int64Counter
+	requestErrors     metric.Int64Counter
+	requestDuration   metric.Float64Histogram
+	retries           metric.Int64Counter
+	retryDelay        metric.Float64Histogram
+	operations        metric.Int64Counter
+	operationErrors   metric.Int64Counter
+	operationDuration metric.Float64Histogram
+}
+
+// operationContextKey carries the current libdns operation down to the
+// HTTP spans
+type operationContextKey struct{}
+
+// operationInfo describes a libdns operation for the HTTP spans it causes
+type operationInfo struct {
+	operation string
+	zone      string
+	records   int
+}
+
+// otel returns the Provider's telemetry, creating it on first use. Without a
+// configured TracerProvider or MeterProvider the no-op implementations are
+// used.
+func (p *Provider) otel() *telemetry {
+	p.telemetryOnce.Do(func() {
+		tracerProvider := p.TracerProvider
+		if tracerProvider == nil {
+			tracerProvider = tracenoop.NewTracerProvider()
+		}
+		meterProvider := p.MeterProvider
+		if meterProvider == nil {
+			meterProvider = metricnoop.NewMeterProvider()
+		}
+
+		meter := meterProvider.Meter(instrumentationName)
+		t := &telemetry{tracer: tracerProvider.Tracer(instrumentationName)}
+
+		// Instrument creation only fails on invalid names; the returned
+		// instruments are usable no-ops in that case
+		t.requests, _ = meter.Int64Counter("autodns.client.requests",
+			metric.WithDescription("AutoDNS API requests sent"))
+		t.requestErrors, _ = meter.Int64Counter("autodns.client.request.errors",
+			metric.WithDescription("AutoDNS API requests that failed"))
+		t.requestDuration, _ = meter.Float64Histogram("autodns.client.request.duration",
+			metric.WithDescription("Duration of AutoDNS API requests"), metric.WithUnit("s"))
+		t.retries, _ = meter.Int64Counter("autodns.client.retries",
+			metric.WithDescription("AutoDNS API requests retried after rate limiting or unavailability"))
+		t.retryDelay, _ = meter.Float64Histogram("autodns.client.retry.delay",
+			metric.WithDescription("Time waited before retrying an AutoDNS API request"), metric.WithUnit("s"))
+		t.operations, _ = meter.Int64Counter("autodns.operations",
+			metric.WithDescription("libdns operations performed"))
+		t.operationErrors, _ = meter.Int64Counter("autodns.operation.errors",
+			metric.WithDescription("libdns operations that failed"))
+		t.operationDuration, _ = meter.Float64Histogram("autodns.operation.duration",
+			metric.WithDescription("Duration of libdns operations"), metric.WithUnit("s"))
+
+		p.telemetry = t
+	})
+	return p.telemetry
+}
+
+// startOperation starts the span of a libdns operation. The returned
+// function ends the span and records the operation metrics.
+func (p *Provider) startOperation(ctx context.Context, operation, zone string, records int) (context.Context, func(error)) {
+	t := p.otel()
+	start := time.Now()
+
+	ctx = context.WithValue(ctx, operationContextKey{}, operationInfo{operation: operation, zone: zone, records: records})
+	ctx, span := t.tracer.Start(ctx, "autodns."+operation,
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(
+			attribute.String("autodns.operation", operation),
+			attribute.String("autodns.zone", zone),
+			attribute.Int("autodns.records", records),
+		))
+
+	return ctx, func(err error) {
+		attrs := metric.WithAttributes(attribute.String("autodns.operation", operation))
+		t.operations.Add(ctx, 1, attrs)
+		t.operationDuration.Record(ctx, time.Since(start).Seconds(), attrs)
+		if err != nil {
+			t.operationErrors.Add(ctx, 1, attrs)
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
+
+// startRequestSpan starts the client span of an AutoDNS HTTP call. The
+// returned function ends the span and records the request metrics.
+func (p *Provider) startRequestSpan(req *http.Request) (*http.Request, func(status int, stid string, err error)) {
+	t := p.otel()
+	start := time.Now()
+
+	attrs := []attribute.KeyValue{
+		attribute.String("http.request.method", req.Method),
+		attribute.String("url.path", req.URL.Path),
+	}
+	op, _ := req.Context().Value(operationContextKey{}).(operationInfo)
+	if op.operation != "" {
+		attrs = append(attrs,
+			attribute.String("autodns.operation", op.operation),
+			attribute.Int("autodns.records", op.records),
+		)
+	}
+	zone := op.zone
+	if zone == "" {
+		zone = zoneFromPath(req.URL.Path)
+	}
+	if zone != "" {
+		attrs = append(attrs, attribute.String("autodns.zone", zone))
+	}
+
+	ctx, span := t.tracer.Start(req.Context(), "AutoDNS "+req.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...))
+
+	return req.WithContext(ctx), func(status int, stid string, err error) {
+		span.SetAttributes(
+			attribute.Int("http.response.status_code", status),
+			attribute.String("autodns.stid", stid),
+		)
+
+		metricAttrs := metric.WithAttributes(
+			attribute.String("http.request.method", req.Method),
+			attribute.Int("http.response.status_code", status),
+		)
+		t.requests.Add(ctx, 1, metricAttrs)
+		t.requestDuration.Record(ctx, time.Since(start).Seconds(), metricAttrs)
+		if err != nil {
+			t.requestErrors.Add(ctx, 1, metricAttrs)
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
+
+// recordRetry counts a retried API request and adds a retry event to the
+// span of the operation.
+func (p *Provider) recordRetry(req *http.Request, status int, wait time.Duration) {
+	t := p.otel()
+	ctx := req.Context()
+
+	attrs := metric.WithAttributes(
+		attribute.String("http.request.method", req.Method),
+		attribute.Int("http.response.status_code", status),
+	)
+	t.retries.Add(ctx, 1, attrs)
+	t.retryDelay.Record(ctx, wait.Seconds(), attrs)
+	trace.SpanFromContext(ctx).AddEvent("retry", trace.WithAttributes(
+		attribute.Int("http.response.status_code", status),
+		attribute.Float64("autodns.retry.delay", wait.Seconds()),
+	))
+}
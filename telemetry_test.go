@@ -0,0 +1,186 @@
+package autodns
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestOpenTelemetryInstrumentation(t *testing.T) {
+	api := newFakeAPI(t, testZone())
+
+	spans := tracetest.NewSpanRecorder()
+	reader := sdkmetric.NewManualReader()
+
+	provider := api.provider()
+	provider.TracerProvider = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans))
+	provider.MeterProvider = sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	ctx := context.Background()
+	_, err := provider.AppendRecords(ctx, "example.com", []libdns.Record{
+		libdns.TXT{Name: "otel", Text: "traced", TTL: 300 * time.Second},
+	})
+	if err != nil {
+		t.Fatalf("AppendRecords failed: %v", err)
+	}
+	if _, err := provider.GetRecords(ctx, "missing.example"); err == nil {
+		t.Fatal("Expected GetRecords on a missing zone to fail")
+	}
+
+	// One operation span per libdns call with one child span per HTTP call
+	ended := spans.Ended()
+	var operation sdktrace.ReadOnlySpan
+	var children []sdktrace.ReadOnlySpan
+	for _, span := range ended {
+		if span.Name() == "autodns.AppendRecords" {
+			operation = span
+		}
+	}
+	if operation == nil {
+		t.Fatal("Expected an autodns.AppendRecords span")
+	}
+	for _, span := range ended {
+		if span.Parent().SpanID() == operation.SpanContext().SpanID() {
+			children = append(children, span)
+		}
+	}
+	if len(children) != 2 {
+		t.Fatalf("Expected 2 HTTP child spans (GET and PUT), got %d", len(children))
+	}
+
+	assertAttr(t, operation.Attributes(), "autodns.zone", attribute.StringValue("example.com"))
+	assertAttr(t, operation.Attributes(), "autodns.records", attribute.IntValue(1))
+	put := children[1]
+	if put.SpanKind() != trace.SpanKindClient {
+		t.Errorf("Expected client span kind, got %v", put.SpanKind())
+	}
+	assertAttr(t, put.Attributes(), "http.request.method", attribute.StringValue("PUT"))
+	assertAttr(t, put.Attributes(), "http.response.status_code", attribute.IntValue(200))
+	assertAttr(t, put.Attributes(), "autodns.zone", attribute.StringValue("example.com"))
+	assertAttr(t, put.Attributes(), "autodns.operation", attribute.StringValue("AppendRecords"))
+	assertAttr(t, put.Attributes(), "autodns.records", attribute.IntValue(1))
+	assertAttr(t, put.Attributes(), "autodns.stid", attribute.StringValue("20261018-stid-2"))
+
+	// Metrics count requests and errors
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(ctx, &rm); err != nil {
+		t.Fatalf("Collecting metrics failed: %v", err)
+	}
+	sums := make(map[string]int64)
+	for _, scope := range rm.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			if data, ok := m.Data.(metricdata.Sum[int64]); ok {
+				for _, point := range data.DataPoints {
+					sums[m.Name] += point.Value
+				}
+			}
+		}
+	}
+	if sums["autodns.client.requests"] != 3 {
+		t.Errorf("Expected 3 API requests, got %d", sums["autodns.client.requests"])
+	}
+	if sums["autodns.client.request.errors"] != 1 {
+		t.Errorf("Expected 1 failed API request, got %d", sums["autodns.client.request.errors"])
+	}
+	if sums["autodns.operations"] != 2 || sums["autodns.operation.errors"] != 1 {
+		t.Errorf("Expected 2 operations with 1 error, got %d and %d", sums["autodns.operations"], sums["autodns.operation.errors"])
+	}
+}
+
+func TestOpenTelemetryRetries(t *testing.T) {
+	api := newFakeAPI(t, testZone())
+
+	spans := tracetest.NewSpanRecorder()
+	reader := sdkmetric.NewManualReader()
+
+	provider := api.provider()
+	provider.TracerProvider = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans))
+	provider.MeterProvider = sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	ctx := context.Background()
+	api.RateLimit(2)
+	if _, err := provider.GetRecords(ctx, "example.com"); err != nil {
+		t.Fatalf("GetRecords failed: %v", err)
+	}
+
+	// Every attempt gets a client span; the operation span records the retries
+	var attempts, retryEvents int
+	for _, span := range spans.Ended() {
+		switch span.Name() {
+		case "AutoDNS GET":
+			attempts++
+		case "autodns.GetRecords":
+			for _, event := range span.Events() {
+				if event.Name == "retry" {
+					retryEvents++
+				}
+			}
+		}
+	}
+	if attempts != 3 || retryEvents != 2 {
+		t.Errorf("Expected 3 attempts with 2 retry events, got %d and %d", attempts, retryEvents)
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(ctx, &rm); err != nil {
+		t.Fatalf("Collecting metrics failed: %v", err)
+	}
+	var retries int64
+	var delays uint64
+	for _, scope := range rm.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			switch data := m.Data.(type) {
+			case metricdata.Sum[int64]:
+				if m.Name == "autodns.client.retries" {
+					for _, point := range data.DataPoints {
+						retries += point.Value
+						assertAttr(t, point.Attributes.ToSlice(), "http.response.status_code", attribute.IntValue(429))
+					}
+				}
+			case metricdata.Histogram[float64]:
+				if m.Name == "autodns.client.retry.delay" {
+					for _, point := range data.DataPoints {
+						delays += point.Count
+					}
+				}
+			}
+		}
+	}
+	if retries != 2 || delays != 2 {
+		t.Errorf("Expected 2 retries and 2 retry delays, got %d and %d", retries, delays)
+	}
+}
+
+func TestOpenTelemetryNoopByDefault(t *testing.T) {
+	api := newFakeAPI(t, testZone())
+	provider := api.provider()
+
+	// Without providers configured, instrumentation must not get in the way
+	if _, err := provider.GetRecords(context.Background(), "example.com"); err != nil {
+		t.Fatalf("GetRecords failed: %v", err)
+	}
+	if provider.otel().tracer == nil {
+		t.Error("Expected a no-op tracer")
+	}
+}
+
+func assertAttr(t *testing.T, attrs []attribute.KeyValue, key string, want attribute.Value) {
+	t.Helper()
+	for _, attr := range attrs {
+		if string(attr.Key) == key {
+			if attr.Value != want {
+				t.Errorf("Attribute %s: expected %v, got %v", key, want.Emit(), attr.Value.Emit())
+			}
+			return
+		}
+	}
+	t.Errorf("Attribute %s not found", key)
+}
@@ -0,0 +1,60 @@
+package autodns
+
+import (
+	"context"
+	"fmt"
+	"slices"
+)
+
+// OperationUpdate identifies UpdateZone in change logs.
+const OperationUpdate Operation = "update"
+
+// UpdateZone applies update to the current resource records of the zone
+// and writes the result in a single zone update. It returns the applied
+// changes.
+//
+// Unlike reading the records with GetRecords and writing them back with
+// SyncZone, UpdateZone holds the zone lock of the Provider from reading to
+// writing, so concurrent changes made through the same Provider are not
+// lost, and it passes the records as AutoDNS stores them, without a lossy
+// conversion to libdns records. update receives a copy of the records and
+// must not call the Provider. Records that are not in the zone yet are
+// validated before the zone is written. An update that removes every
+// record fails with ErrEmptySync.
+func (p *Provider) UpdateZone(ctx context.Context, zone string, update func(records []ResourceRecord) ([]ResourceRecord, error)) (_ ChangeSet, err error) {
+	ctx, end := p.startOperation(ctx, "UpdateZone", zone, 0)
+	defer func() { end(err) }()
+
+	if err := p.ensureInitialized(); err != nil {
+		return ChangeSet{}, err
+	}
+
+	if zone == "" {
+		return ChangeSet{}, fmt.Errorf("zone name is required")
+	}
+
+	unlock := p.lockZone(zone)
+	defer unlock()
+
+	zoneData, err := p.getZone(ctx, zone)
+	if err != nil {
+		return ChangeSet{}, fmt.Errorf("failed to get zone %s: %v", zone, err)
+	}
+
+	records, err := update(slices.Clone(zoneData.ResourceRecords))
+	if err != nil {
+		return ChangeSet{}, fmt.Errorf("failed to update zone %s: %w", zone, err)
+	}
+	if len(records) == 0 && len(zoneData.ResourceRecords) > 0 {
+		return ChangeSet{}, fmt.Errorf("failed to update zone %s: %w", zone, ErrEmptySync)
+	}
+	if err := p.validateAdded(ctx, zone, zoneData.ResourceRecords, records); err != nil {
+		return ChangeSet{}, fmt.Errorf("failed to update zone %s: %w", zone, err)
+	}
+
+	changes, err := p.updateZone(ctx, zone, OperationUpdate, zoneData, withRecords(zoneData, records))
+	if err != nil {
+		return ChangeSet{}, fmt.Errorf("failed to update zone %s: %w", zone, err)
+	}
+	return changes, nil
+}
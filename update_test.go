@@ -0,0 +1,91 @@
+package autodns
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestUpdateZone(t *testing.T) {
+	ctx := context.Background()
+	zone := testZone()
+	zone.ResourceRecords = append(zone.ResourceRecords,
+		// Records the libdns conversion would change or reject are passed
+		// through as they are
+		ResourceRecord{Name: "_sip._tcp", TTL: 300, Type: "SRV", Value: "5 5060 sip.example.com", Pref: 10},
+		ResourceRecord{Name: "broken", TTL: 300, Type: "SRV", Value: "not an srv value"},
+	)
+	api := newFakeAPI(t, zone)
+	provider := api.provider()
+
+	added := ResourceRecord{Name: "new", TTL: 300, Type: "A", Value: "192.0.2.9"}
+	changes, err := provider.UpdateZone(ctx, "example.com", func(records []ResourceRecord) ([]ResourceRecord, error) {
+		if !slices.Equal(records, zone.ResourceRecords) {
+			t.Errorf("Expected the stored records, got %+v", records)
+		}
+		return append(records, added), nil
+	})
+	if err != nil {
+		t.Fatalf("UpdateZone failed: %v", err)
+	}
+	if changes.String() != "example.com: +1 -0 ~0" {
+		t.Errorf("Unexpected changes %+v", changes)
+	}
+	if got := api.Zone("example.com").ResourceRecords; !slices.Equal(got, append(slices.Clone(zone.ResourceRecords), added)) {
+		t.Errorf("Expected only the new record to be added, got %+v", got)
+	}
+
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := provider.UpdateZone(ctx, "example.com", func(records []ResourceRecord) ([]ResourceRecord, error) {
+			return append(records, ResourceRecord{Name: "_443._tcp", TTL: 300, Type: "TLSA", Value: "not a tlsa value"}), nil
+		})
+		if err == nil {
+			t.Error("Expected an invalid new record to be rejected")
+		}
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		requests := len(api.Requests())
+		_, err := provider.UpdateZone(ctx, "example.com", func([]ResourceRecord) ([]ResourceRecord, error) {
+			return nil, nil
+		})
+		if !errors.Is(err, ErrEmptySync) {
+			t.Errorf("Expected ErrEmptySync, got %v", err)
+		}
+		if slices.Contains(api.Requests()[requests:], "PUT /zone/example.com") {
+			t.Error("Expected the zone not to be written")
+		}
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		// Appends made while an update runs are not lost
+		var wg sync.WaitGroup
+		for i := range 5 {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				provider.UpdateZone(ctx, "example.com", func(records []ResourceRecord) ([]ResourceRecord, error) {
+					return append(records, ResourceRecord{Name: "update", TTL: 300, Type: "TXT", Value: string(rune('a' + i))}), nil
+				})
+			}()
+			go func() {
+				defer wg.Done()
+				provider.UpdateZone(ctx, "example.com", func(records []ResourceRecord) ([]ResourceRecord, error) {
+					return append(records, ResourceRecord{Name: "other", TTL: 300, Type: "TXT", Value: string(rune('a' + i))}), nil
+				})
+			}()
+		}
+		wg.Wait()
+		count := 0
+		for _, rr := range api.Zone("example.com").ResourceRecords {
+			if rr.Type == "TXT" && (rr.Name == "update" || rr.Name == "other") {
+				count++
+			}
+		}
+		if count != 10 {
+			t.Errorf("Expected 10 TXT records, got %d", count)
+		}
+	})
+}
@@ -0,0 +1,225 @@
+package autodns
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+)
+
+// nameTargetTypes are record types whose whole value is a domain name
+var nameTargetTypes = map[string]bool{
+	"ALIAS": true,
+	"CNAME": true,
+	"MX":    true,
+	"NS":    true,
+	"PTR":   true,
+}
+
+// ExportZoneFile writes the zone as an RFC 1035 master file with $ORIGIN
+// and $TTL directives, the SOA record, the zone's name servers and all
+// resource records. Records are sorted by name and type so exports of an
+// unchanged zone are identical.
+//
+// AutoDNS ALIAS records are written as-is; BIND does not know this type.
+func (p *Provider) ExportZoneFile(ctx context.Context, zone string, w io.Writer) (err error) {
+	ctx, end := p.startOperation(ctx, "ExportZoneFile", zone, 0)
+	defer func() { end(err) }()
+
+	if err := p.ensureInitialized(); err != nil {
+		return err
+	}
+
+	if zone == "" {
+		return fmt.Errorf("zone name is required")
+	}
+
+	zoneData, err := p.getZone(ctx, zone)
+	if err != nil {
+		return fmt.Errorf("failed to get zone %s: %v", zone, err)
+	}
+
+	return writeZoneFile(w, zone, zoneData)
+}
+
+// writeZoneFile renders zoneData as a master file
+func writeZoneFile(w io.Writer, zone string, zoneData Zone) error {
+	origin := strings.TrimSuffix(zone, ".") + "."
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintf(bw, "; Zone %s exported from AutoDNS\n", strings.TrimSuffix(origin, "."))
+	fmt.Fprintf(bw, "$ORIGIN %s\n", origin)
+
+	defaultTTL := int64(3600)
+	if zoneData.SOA != nil && zoneData.SOA.TTL > 0 {
+		defaultTTL = zoneData.SOA.TTL
+	}
+	fmt.Fprintf(bw, "$TTL %d\n\n", defaultTTL)
+
+	if zoneData.SOA != nil {
+		primary := origin
+		if len(zoneData.NameServers) > 0 {
+			primary = absoluteTarget(zoneData.NameServers[0].Name, origin)
+		}
+		fmt.Fprintf(bw, "@\t%d\tIN\tSOA\t%s %s (\n", defaultTTL, primary, emailToRName(zoneData.SOA.Email, origin))
+		fmt.Fprintf(bw, "\t\t\t%d\t; serial\n", zoneSerial(zoneData))
+		fmt.Fprintf(bw, "\t\t\t%d\t; refresh\n", zoneData.SOA.Refresh)
+		fmt.Fprintf(bw, "\t\t\t%d\t; retry\n", zoneData.SOA.Retry)
+		fmt.Fprintf(bw, "\t\t\t%d\t; expire\n", zoneData.SOA.Expire)
+		fmt.Fprintf(bw, "\t\t\t%d )\t; minimum\n\n", defaultTTL)
+	}
+
+	// Name servers, with glue for those inside the zone
+	var glue []string
+	for _, ns := range zoneData.NameServers {
+		ttl := ns.TTL
+		if ttl == 0 {
+			ttl = defaultTTL
+		}
+		target := absoluteTarget(ns.Name, origin)
+		fmt.Fprintf(bw, "@\t%d\tIN\tNS\t%s\n", ttl, target)
+
+		if strings.HasSuffix(target, "."+origin) {
+			name := strings.TrimSuffix(target, "."+origin)
+			for _, ip := range ns.IPAddresses {
+				recordType := "A"
+				if strings.Contains(ip, ":") {
+					recordType = "AAAA"
+				}
+				glue = append(glue, fmt.Sprintf("%s\t%d\tIN\t%s\t%s\n", name, ttl, recordType, ip))
+			}
+		}
+	}
+	for _, line := range glue {
+		bw.WriteString(line)
+	}
+	if len(zoneData.NameServers) > 0 {
+		bw.WriteString("\n")
+	}
+
+	records := slices.Clone(zoneData.ResourceRecords)
+	slices.SortStableFunc(records, func(a, b ResourceRecord) int {
+		return cmp.Or(
+			compareNames(normalizeRecordName(a.Name, zone), normalizeRecordName(b.Name, zone)),
+			cmp.Compare(a.Type, b.Type),
+			cmp.Compare(a.Pref, b.Pref),
+			cmp.Compare(a.Value, b.Value),
+		)
+	})
+	for _, rr := range records {
+		ttl := ""
+		if rr.TTL > 0 {
+			ttl = fmt.Sprint(rr.TTL)
+		}
+		fmt.Fprintf(bw, "%s\t%s\tIN\t%s\t%s\n", normalizeRecordName(rr.Name, zone), ttl, rr.Type, zoneFileRData(rr, origin))
+	}
+
+	return bw.Flush()
+}
+
+// zoneFileRData renders the value of a record in master file syntax
+func zoneFileRData(rr ResourceRecord, origin string) string {
+	switch {
+	case rr.Type == "MX":
+		return fmt.Sprintf("%d %s", rr.Pref, absoluteTarget(rr.Value, origin))
+	case rr.Type == "SRV":
+		// AutoDNS keeps the priority in pref and 'weight port target' in value
+		fields := strings.Fields(rr.Value)
+		if len(fields) == 3 {
+			fields[2] = absoluteTarget(fields[2], origin)
+		}
+		return fmt.Sprintf("%d %s", rr.Pref, strings.Join(fields, " "))
+	case rr.Type == "TXT":
+		return quoteTXT(rr.Value)
+	case rr.Type == "NAPTR":
+		fields, err := splitRecordFields(rr.Value)
+		if err != nil || len(fields) != 6 {
+			return rr.Value
+		}
+		return fmt.Sprintf("%s %s %s %s %s %s", fields[0], fields[1],
+			quoteCharacterString(fields[2]), quoteCharacterString(fields[3]), quoteCharacterString(fields[4]),
+			absoluteTarget(fields[5], origin))
+	case nameTargetTypes[rr.Type]:
+		return absoluteTarget(rr.Value, origin)
+	default:
+		return rr.Value
+	}
+}
+
+// absoluteTarget makes a domain name from a record value fully qualified.
+// AutoDNS stores targets as FQDNs without the trailing dot.
+func absoluteTarget(name, origin string) string {
+	switch {
+	case name == "" || name == "@":
+		return origin
+	case strings.HasSuffix(name, "."):
+		return name
+	default:
+		return name + "."
+	}
+}
+
+// quoteTXT splits text into quoted character-strings of at most 255 bytes
+func quoteTXT(text string) string {
+	if text == "" {
+		return `""`
+	}
+	var parts []string
+	for len(text) > 255 {
+		parts = append(parts, quoteCharacterString(text[:255]))
+		text = text[255:]
+	}
+	parts = append(parts, quoteCharacterString(text))
+	return strings.Join(parts, " ")
+}
+
+// quoteCharacterString quotes s, escaping quotes and backslashes
+func quoteCharacterString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// emailToRName converts the SOA contact address to the RNAME domain form,
+// escaping dots in the local part
+func emailToRName(email, origin string) string {
+	local, domain, ok := strings.Cut(email, "@")
+	if !ok {
+		if email == "" {
+			return "hostmaster." + origin
+		}
+		return absoluteTarget(email, origin)
+	}
+	return strings.ReplaceAll(local, ".", `\.`) + "." + absoluteTarget(domain, origin)
+}
+
+// zoneSerial derives a YYYYMMDDnn serial from the zone's last update
+func zoneSerial(zoneData Zone) uint32 {
+	var t time.Time
+	switch {
+	case zoneData.Updated != nil && !zoneData.Updated.IsZero():
+		t = zoneData.Updated.Time
+	case zoneData.Created != nil && !zoneData.Created.IsZero():
+		t = zoneData.Created.Time
+	default:
+		return 1
+	}
+	t = t.UTC()
+	return uint32(t.Year()*1000000 + int(t.Month())*10000 + t.Day()*100)
+}
+
+// compareNames orders the apex first, then names alphabetically
+func compareNames(a, b string) int {
+	if a == b {
+		return 0
+	}
+	if a == "@" {
+		return -1
+	}
+	if b == "@" {
+		return 1
+	}
+	return strings.Compare(a, b)
+}
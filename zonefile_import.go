@@ -0,0 +1,626 @@
+package autodns
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// OperationImport identifies ImportZoneFile in change logs.
+const OperationImport Operation = "import"
+
+// maxIncludeDepth limits nested $INCLUDE directives
+const maxIncludeDepth = 8
+
+// ImportOptions configures ImportZoneFile.
+type ImportOptions struct {
+	// Replace makes the imported records the complete record set of the
+	// zone (except for records matched by Ignore). Otherwise the import is
+	// merged: imported record sets replace existing sets with the same name
+	// and type, and all other records are kept.
+	Replace bool
+	// Ignore lists records left untouched in Replace mode
+	Ignore []IgnoreRule
+	// AllowInclude enables the $INCLUDE directive, which is rejected by default
+	AllowInclude bool
+	// IncludeDir is the directory relative $INCLUDE paths are resolved against
+	IncludeDir string
+	// DryRun computes the changes without writing the zone
+	DryRun bool
+	// AllowEmpty permits a file without managed records in Replace mode,
+	// which removes every record that is not ignored
+	AllowEmpty bool
+}
+
+// ZoneFileError reports a problem at a specific line of a zone file.
+type ZoneFileError struct {
+	// File is the $INCLUDE path, or empty for the main input
+	File string
+	// Line is the 1-based line number where the entry starts
+	Line int
+	Err  error
+}
+
+func (e *ZoneFileError) Error() string {
+	if e.File != "" {
+		return fmt.Sprintf("%s:%d: %v", e.File, e.Line, e.Err)
+	}
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *ZoneFileError) Unwrap() error { return e.Err }
+
+// ImportZoneFile parses an RFC 1035 master file and writes its records to
+// the zone in a single update. Relative names, $ORIGIN, $TTL and multi-line
+// parenthesized records are supported; $INCLUDE only with AllowInclude.
+//
+// SOA and apex NS records in the file are skipped, as AutoDNS manages the
+// zone's SOA and name servers itself. For the same reason, Replace keeps the
+// apex NS records the zone already has, and refuses to empty the zone with
+// ErrEmptySync unless AllowEmpty is set. Parse and validation errors are
+// returned as *ZoneFileError before the zone is fetched.
+func (p *Provider) ImportZoneFile(ctx context.Context, zone string, r io.Reader, opts ImportOptions) (_ ChangeSet, err error) {
+	ctx, end := p.startOperation(ctx, "ImportZoneFile", zone, 0)
+	defer func() { end(err) }()
+
+	if err := p.ensureInitialized(); err != nil {
+		return ChangeSet{}, err
+	}
+
+	if zone == "" {
+		return ChangeSet{}, fmt.Errorf("zone name is required")
+	}
+
+	if err := validateIgnore(opts.Ignore); err != nil {
+		return ChangeSet{}, err
+	}
+
+	imported, err := parseZoneFile(r, zone, opts)
+	if err != nil {
+		return ChangeSet{}, err
+	}
+
+	unlock := p.lockZone(zone)
+	defer unlock()
+
+	zoneData, err := p.getZone(ctx, zone)
+	if err != nil {
+		return ChangeSet{}, fmt.Errorf("failed to get zone %s: %v", zone, err)
+	}
+
+	var records []ResourceRecord
+	if opts.Replace {
+		sync := SyncOptions{Ignore: opts.Ignore}
+		for _, rr := range zoneData.ResourceRecords {
+			// Apex NS records are skipped in the file, so they are kept
+			if sync.ignored(rr, zone) || isApexNS(rr, zone) {
+				records = append(records, rr)
+			}
+		}
+		kept := len(records)
+		for _, rr := range imported {
+			if !sync.ignored(rr, zone) {
+				records = append(records, rr)
+			}
+		}
+		if len(records) == kept && kept < len(zoneData.ResourceRecords) && !opts.AllowEmpty {
+			return ChangeSet{}, fmt.Errorf("failed to import zone %s: %w", zone, ErrEmptySync)
+		}
+	} else {
+		replaced := make(map[string]bool)
+		for _, rr := range imported {
+			replaced[recordSetKey(rr, zone)] = true
+		}
+		for _, rr := range zoneData.ResourceRecords {
+			if !replaced[recordSetKey(rr, zone)] {
+				records = append(records, rr)
+			}
+		}
+		records = append(records, imported...)
+	}
+
+	if opts.DryRun {
+		ctx = WithDryRun(ctx, nil)
+	}
+	changes, err := p.updateZone(ctx, zone, OperationImport, zoneData, withRecords(zoneData, records))
+	if err != nil {
+		return ChangeSet{}, fmt.Errorf("failed to import zone %s: %v", zone, err)
+	}
+	return changes, nil
+}
+
+// isApexNS reports whether rr is an NS record at the zone apex
+func isApexNS(rr ResourceRecord, zone string) bool {
+	return rr.Type == "NS" && normalizeRecordName(rr.Name, zone) == "@"
+}
+
+// zoneToken is a single field of a zone file entry
+type zoneToken struct {
+	text   string
+	quoted bool
+}
+
+// zoneEntry is one logical line of a zone file
+type zoneEntry struct {
+	line   int
+	tokens []zoneToken
+	// blankOwner is set when the entry starts with whitespace and therefore
+	// inherits the previous owner name
+	blankOwner bool
+}
+
+// zoneParser holds the state carried between entries
+type zoneParser struct {
+	zone       string
+	opts       ImportOptions
+	origin     string
+	defaultTTL int64
+	lastOwner  string
+	lastTTL    int64
+	records    []ResourceRecord
+}
+
+// parseZoneFile converts a master file into resource records relative to zone
+func parseZoneFile(r io.Reader, zone string, opts ImportOptions) ([]ResourceRecord, error) {
+	origin := strings.TrimSuffix(zone, ".") + "."
+	zp := &zoneParser{
+		zone:   zone,
+		opts:   opts,
+		origin: origin,
+	}
+	if err := zp.parse(r, "", 0); err != nil {
+		return nil, err
+	}
+	return zp.records, nil
+}
+
+// parse processes the entries of one file, recursing into $INCLUDE
+func (zp *zoneParser) parse(r io.Reader, file string, depth int) error {
+	entries, err := readZoneEntries(r)
+	if err != nil {
+		if zfe, ok := err.(*ZoneFileError); ok {
+			zfe.File = file
+		}
+		return err
+	}
+
+	for _, entry := range entries {
+		fail := func(format string, args ...any) error {
+			return &ZoneFileError{File: file, Line: entry.line, Err: fmt.Errorf(format, args...)}
+		}
+
+		first := entry.tokens[0].text
+		if !entry.blankOwner && strings.HasPrefix(first, "$") {
+			switch strings.ToUpper(first) {
+			case "$ORIGIN":
+				if len(entry.tokens) != 2 {
+					return fail("$ORIGIN expects a single domain name")
+				}
+				zp.origin = zp.absoluteName(entry.tokens[1].text)
+			case "$TTL":
+				if len(entry.tokens) != 2 {
+					return fail("$TTL expects a single value")
+				}
+				ttl, err := parseZoneTTL(entry.tokens[1].text)
+				if err != nil {
+					return fail("%v", err)
+				}
+				zp.defaultTTL = ttl
+			case "$INCLUDE":
+				if !zp.opts.AllowInclude {
+					return fail("$INCLUDE is disabled")
+				}
+				if len(entry.tokens) < 2 || len(entry.tokens) > 3 {
+					return fail("$INCLUDE expects a file name and an optional origin")
+				}
+				if depth >= maxIncludeDepth {
+					return fail("$INCLUDE nested too deeply")
+				}
+				if err := zp.include(entry, file, depth); err != nil {
+					return err
+				}
+			default:
+				return fail("unsupported directive %s", first)
+			}
+			continue
+		}
+
+		if err := zp.parseRecord(entry); err != nil {
+			return &ZoneFileError{File: file, Line: entry.line, Err: err}
+		}
+	}
+	return nil
+}
+
+// include parses an included file with its own origin scope
+func (zp *zoneParser) include(entry zoneEntry, file string, depth int) error {
+	path := entry.tokens[1].text
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(zp.opts.IncludeDir, path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return &ZoneFileError{File: file, Line: entry.line, Err: err}
+	}
+	defer f.Close()
+
+	// The origin and owner only change within the included file
+	savedOrigin, savedOwner := zp.origin, zp.lastOwner
+	if len(entry.tokens) == 3 {
+		zp.origin = zp.absoluteName(entry.tokens[2].text)
+	}
+	err = zp.parse(f, path, depth+1)
+	zp.origin, zp.lastOwner = savedOrigin, savedOwner
+	return err
+}
+
+// parseRecord converts a resource record entry and appends it to records
+func (zp *zoneParser) parseRecord(entry zoneEntry) error {
+	tokens := entry.tokens
+
+	// Owner name
+	owner := zp.lastOwner
+	if !entry.blankOwner {
+		owner = zp.absoluteName(tokens[0].text)
+		tokens = tokens[1:]
+	}
+	if owner == "" {
+		return fmt.Errorf("record without owner name")
+	}
+	zp.lastOwner = owner
+
+	// Optional TTL and class in either order, then the type
+	ttl := int64(-1)
+	for len(tokens) > 0 {
+		text := strings.ToUpper(tokens[0].text)
+		if text == "IN" {
+			tokens = tokens[1:]
+			continue
+		}
+		if text == "CH" || text == "HS" || text == "CS" {
+			return fmt.Errorf("unsupported class %s", text)
+		}
+		if ttl < 0 && text != "" && text[0] >= '0' && text[0] <= '9' {
+			parsed, err := parseZoneTTL(text)
+			if err != nil {
+				return err
+			}
+			ttl = parsed
+			tokens = tokens[1:]
+			continue
+		}
+		break
+	}
+	if len(tokens) == 0 {
+		return fmt.Errorf("missing record type")
+	}
+	recordType := strings.ToUpper(tokens[0].text)
+	rdata := tokens[1:]
+
+	switch {
+	case ttl >= 0:
+		zp.lastTTL = ttl
+	case zp.defaultTTL > 0:
+		ttl = zp.defaultTTL
+	case zp.lastTTL > 0:
+		ttl = zp.lastTTL
+	default:
+		ttl = 3600
+	}
+
+	zoneFQDN := strings.ToLower(strings.TrimSuffix(zp.zone, ".") + ".")
+	owner = strings.ToLower(owner)
+	isApex := owner == zoneFQDN
+	if !isApex && !strings.HasSuffix(owner, "."+zoneFQDN) {
+		return fmt.Errorf("owner %s is outside of zone %s", owner, zp.zone)
+	}
+
+	// AutoDNS manages the SOA and the apex name servers
+	if recordType == "SOA" || recordType == "NS" && isApex {
+		if recordType == "SOA" {
+			if ttl, err := soaMinimum(rdata); err == nil && zp.defaultTTL == 0 {
+				zp.lastTTL = ttl
+			}
+		}
+		return nil
+	}
+
+	rr := ResourceRecord{
+		Name: normalizeRecordName(strings.TrimSuffix(owner, "."), zp.zone),
+		TTL:  ttl,
+		Type: recordType,
+	}
+	if err := zp.convertRData(&rr, rdata); err != nil {
+		return err
+	}
+	if err := validateResourceRecord(rr); err != nil {
+		return err
+	}
+	zp.records = append(zp.records, rr)
+	return nil
+}
+
+// convertRData fills value and pref of rr from the record data fields
+func (zp *zoneParser) convertRData(rr *ResourceRecord, rdata []zoneToken) error {
+	expect := func(n int, form string) error {
+		if len(rdata) != n {
+			return fmt.Errorf("malformed %s record; expected '%s'", rr.Type, form)
+		}
+		return nil
+	}
+
+	switch rr.Type {
+	case "A", "AAAA":
+		if err := expect(1, "address"); err != nil {
+			return err
+		}
+		addr, err := netip.ParseAddr(rdata[0].text)
+		if err != nil || addr.Is4() != (rr.Type == "A") {
+			return fmt.Errorf("invalid %s address %q", rr.Type, rdata[0].text)
+		}
+		rr.Value = addr.String()
+	case "CNAME", "NS", "PTR", "ALIAS":
+		if err := expect(1, "target"); err != nil {
+			return err
+		}
+		rr.Value = zp.targetName(rdata[0].text)
+	case "MX":
+		if err := expect(2, "preference target"); err != nil {
+			return err
+		}
+		pref, err := strconv.ParseUint(rdata[0].text, 10, 16)
+		if err != nil {
+			return fmt.Errorf("invalid MX preference %s", rdata[0].text)
+		}
+		rr.Pref = int32(pref)
+		rr.Value = zp.targetName(rdata[1].text)
+	case "SRV":
+		if err := expect(4, "priority weight port target"); err != nil {
+			return err
+		}
+		var numbers [3]uint64
+		for i := range numbers {
+			n, err := strconv.ParseUint(rdata[i].text, 10, 16)
+			if err != nil {
+				return fmt.Errorf("invalid SRV field %s", rdata[i].text)
+			}
+			numbers[i] = n
+		}
+		rr.Pref = int32(numbers[0])
+		rr.Value = fmt.Sprintf("%d %d %s", numbers[1], numbers[2], zp.targetName(rdata[3].text))
+	case "TXT":
+		if len(rdata) == 0 {
+			return fmt.Errorf("malformed TXT record; expected at least one character-string")
+		}
+		var text strings.Builder
+		for _, token := range rdata {
+			text.WriteString(token.text)
+		}
+		rr.Value = text.String()
+	case "CAA":
+		if err := expect(3, `flags tag "value"`); err != nil {
+			return err
+		}
+		if _, err := strconv.ParseUint(rdata[0].text, 10, 8); err != nil {
+			return fmt.Errorf("invalid CAA flags %s", rdata[0].text)
+		}
+		rr.Value = fmt.Sprintf("%s %s %s", rdata[0].text, rdata[1].text, quoteCharacterString(rdata[2].text))
+	case "NAPTR":
+		if err := expect(6, `order preference "flags" "service" "regexp" replacement`); err != nil {
+			return err
+		}
+		replacement := rdata[5].text
+		if replacement != "." {
+			replacement = zp.targetName(replacement)
+		}
+		rr.Value = fmt.Sprintf("%s %s %s %s %s %s", rdata[0].text, rdata[1].text,
+			quoteCharacterString(rdata[2].text), quoteCharacterString(rdata[3].text), quoteCharacterString(rdata[4].text),
+			replacement)
+	case "HINFO":
+		if err := expect(2, `"cpu" "os"`); err != nil {
+			return err
+		}
+		rr.Value = quoteCharacterString(rdata[0].text) + " " + quoteCharacterString(rdata[1].text)
+	case "SVCB", "HTTPS":
+		if len(rdata) < 2 {
+			return fmt.Errorf("malformed %s record; expected 'priority target [params]'", rr.Type)
+		}
+		fields := []string{rdata[0].text, zp.targetName(rdata[1].text)}
+		for _, token := range rdata[2:] {
+			fields = append(fields, token.text)
+		}
+		rr.Value = strings.Join(fields, " ")
+	default:
+		if !isExtendedRecordType(rr.Type) {
+			return fmt.Errorf("%w: record type %q", ErrUnsupportedRecord, rr.Type)
+		}
+		// TLSA, SSHFP, DS and LOC are plain fields; hex data may be split
+		// across several of them
+		fields := make([]string, len(rdata))
+		for i, token := range rdata {
+			fields[i] = token.text
+		}
+		rr.Value = strings.Join(fields, " ")
+	}
+	return nil
+}
+
+// absoluteName expands a name from the zone file against the current origin
+func (zp *zoneParser) absoluteName(name string) string {
+	switch {
+	case name == "@":
+		return zp.origin
+	case strings.HasSuffix(name, "."):
+		return name
+	default:
+		return name + "." + zp.origin
+	}
+}
+
+// targetName expands a target name and strips the trailing dot, as AutoDNS
+// stores targets as FQDNs without it
+func (zp *zoneParser) targetName(name string) string {
+	return strings.TrimSuffix(zp.absoluteName(name), ".")
+}
+
+// soaMinimum returns the minimum field of SOA record data
+func soaMinimum(rdata []zoneToken) (int64, error) {
+	if len(rdata) != 7 {
+		return 0, fmt.Errorf("malformed SOA record")
+	}
+	return parseZoneTTL(rdata[6].text)
+}
+
+// parseZoneTTL parses a TTL in seconds or with BIND units, e.g. 1h30m
+func parseZoneTTL(s string) (int64, error) {
+	if n, err := strconv.ParseUint(s, 10, 32); err == nil {
+		return int64(n), nil
+	}
+
+	units := map[byte]int64{'s': 1, 'm': 60, 'h': 3600, 'd': 86400, 'w': 604800}
+	var total, current int64
+	digits := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= '0' && c <= '9':
+			current = current*10 + int64(c-'0')
+			digits = true
+		case units[c|0x20] > 0 && digits:
+			total += current * units[c|0x20]
+			current, digits = 0, false
+		default:
+			return 0, fmt.Errorf("invalid TTL %q", s)
+		}
+		if total+current > 1<<31-1 {
+			return 0, fmt.Errorf("TTL %q out of range", s)
+		}
+	}
+	if digits {
+		return 0, fmt.Errorf("invalid TTL %q: missing unit", s)
+	}
+	return total, nil
+}
+
+// readZoneEntries splits a zone file into logical entries, joining
+// parenthesized continuation lines and stripping comments
+func readZoneEntries(r io.Reader) ([]zoneEntry, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	var entries []zoneEntry
+	var current *zoneEntry
+	depth := 0
+	lineNo := 0
+
+	for scanner.Scan() {
+		lineNo++
+		line := scanner.Text()
+
+		if depth == 0 {
+			current = &zoneEntry{
+				line:       lineNo,
+				blankOwner: len(line) > 0 && (line[0] == ' ' || line[0] == '\t'),
+			}
+		}
+
+		tokens, delta, err := tokenizeZoneLine(line)
+		if err != nil {
+			return nil, &ZoneFileError{Line: lineNo, Err: err}
+		}
+		depth += delta
+		if depth < 0 {
+			return nil, &ZoneFileError{Line: lineNo, Err: fmt.Errorf("unbalanced ')'")}
+		}
+		current.tokens = append(current.tokens, tokens...)
+
+		if depth == 0 && len(current.tokens) > 0 {
+			entries = append(entries, *current)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if depth > 0 {
+		return nil, &ZoneFileError{Line: current.line, Err: fmt.Errorf("unterminated '('")}
+	}
+	return entries, nil
+}
+
+// tokenizeZoneLine splits one physical line into tokens and returns the
+// change in parenthesis depth
+func tokenizeZoneLine(line string) ([]zoneToken, int, error) {
+	var tokens []zoneToken
+	var field strings.Builder
+	depth := 0
+	inQuotes, inField := false, false
+
+	flush := func(quoted bool) {
+		if inField || quoted {
+			tokens = append(tokens, zoneToken{text: field.String(), quoted: quoted})
+		}
+		field.Reset()
+		inField = false
+	}
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '\\':
+			// \DDD is a decimal byte, anything else is taken literally
+			if i+3 < len(line) && isDigit(line[i+1]) && isDigit(line[i+2]) && isDigit(line[i+3]) {
+				n, _ := strconv.Atoi(line[i+1 : i+4])
+				if n > 255 {
+					return nil, 0, fmt.Errorf("invalid escape \\%s", line[i+1:i+4])
+				}
+				field.WriteByte(byte(n))
+				i += 3
+			} else if i+1 < len(line) {
+				field.WriteByte(line[i+1])
+				i++
+			} else {
+				return nil, 0, fmt.Errorf("trailing backslash")
+			}
+			inField = true
+		case inQuotes:
+			if c == '"' {
+				inQuotes = false
+				flush(true)
+			} else {
+				field.WriteByte(c)
+			}
+		case c == '"':
+			flush(false)
+			inQuotes = true
+		case c == ';':
+			flush(false)
+			return tokens, depth, nil
+		case c == '(':
+			flush(false)
+			depth++
+		case c == ')':
+			flush(false)
+			depth--
+		case c == ' ' || c == '\t' || c == '\r':
+			flush(false)
+		default:
+			field.WriteByte(c)
+			inField = true
+		}
+	}
+	if inQuotes {
+		return nil, 0, fmt.Errorf("unterminated quoted string")
+	}
+	flush(false)
+	return tokens, depth, nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,223 @@
+package autodns
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testZoneFile = `; migrated from BIND
+$ORIGIN example.com.
+$TTL 1h
+@       IN  SOA ns1.example.com. hostmaster.example.com. (
+            2026101801 ; serial
+            12h        ; refresh
+            2h         ; retry
+            2w         ; expire
+            1h )       ; minimum
+        IN  NS  ns1.example.com.
+        IN  MX  10 mail
+www     300 IN  A   192.0.2.1
+        300 IN  AAAA 2001:db8::1
+txt         IN  TXT ( "part one; not a comment"
+                      " part two" )
+escaped     IN  TXT "say \"hi\"\032now"
+_sip._tcp   IN  SRV 10 5 5060 sip.example.com.
+_443._tcp.www IN TLSA 3 1 1 ( 0123456789abcdef0123456789abcdef
+                              0123456789abcdef0123456789abcdef )
+sub         IN  NS  ns.sub
+$ORIGIN sub.example.com.
+host        IN  CNAME www.example.com.
+`
+
+func TestParseZoneFile(t *testing.T) {
+	records, err := parseZoneFile(strings.NewReader(testZoneFile), "example.com", ImportOptions{})
+	if err != nil {
+		t.Fatalf("parseZoneFile failed: %v", err)
+	}
+
+	want := []ResourceRecord{
+		{Name: "@", TTL: 3600, Type: "MX", Value: "mail.example.com", Pref: 10},
+		{Name: "www", TTL: 300, Type: "A", Value: "192.0.2.1"},
+		{Name: "www", TTL: 300, Type: "AAAA", Value: "2001:db8::1"},
+		{Name: "txt", TTL: 3600, Type: "TXT", Value: "part one; not a comment part two"},
+		{Name: "escaped", TTL: 3600, Type: "TXT", Value: `say "hi" now`},
+		{Name: "_sip._tcp", TTL: 3600, Type: "SRV", Value: "5 5060 sip.example.com", Pref: 10},
+		{Name: "_443._tcp.www", TTL: 3600, Type: "TLSA", Value: "3 1 1 0123456789abcdef0123456789abcdef 0123456789abcdef0123456789abcdef"},
+		{Name: "sub", TTL: 3600, Type: "NS", Value: "ns.sub.example.com"},
+		{Name: "host.sub", TTL: 3600, Type: "CNAME", Value: "www.example.com"},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("Expected %d records, got %d: %+v", len(want), len(records), records)
+	}
+	for i := range want {
+		if records[i] != want[i] {
+			t.Errorf("Record %d: expected %+v, got %+v", i, want[i], records[i])
+		}
+	}
+}
+
+func TestParseZoneFileErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		line  int
+		msg   string
+	}{
+		{"BadAddress", "$ORIGIN example.com.\nwww IN A 999.1.1.1\n", 2, "invalid A address"},
+		{"OutsideZone", "www.example.net. IN A 192.0.2.1\n", 1, "outside of zone"},
+		{"Unterminated", "a IN TXT \"open\n", 1, "unterminated quoted string"},
+		{"OpenParen", "a IN TXT ( \"x\"\n\nb IN A 192.0.2.1\n", 1, "unterminated '('"},
+		{"Include", "ok IN A 192.0.2.1\n$INCLUDE other.zone\n", 2, "$INCLUDE is disabled"},
+		{"Unsupported", "ok IN A 192.0.2.1\nold IN WKS 192.0.2.1 TCP\n", 2, "unsupported record"},
+		{"InvalidTLSA", "\n\n_443._tcp IN TLSA 3 1 1 abcd\n", 3, "invalid certificate data length"},
+		{"BadTTL", "$TTL 1x\n", 1, "invalid TTL"},
+		{"Class", "a CH A 192.0.2.1\n", 1, "unsupported class"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseZoneFile(strings.NewReader(tt.input), "example.com", ImportOptions{})
+			var zfe *ZoneFileError
+			if !errors.As(err, &zfe) {
+				t.Fatalf("Expected *ZoneFileError, got %v", err)
+			}
+			if zfe.Line != tt.line {
+				t.Errorf("Expected line %d, got %d (%v)", tt.line, zfe.Line, err)
+			}
+			if !strings.Contains(err.Error(), tt.msg) {
+				t.Errorf("Expected error containing %q, got %v", tt.msg, err)
+			}
+		})
+	}
+}
+
+func TestParseZoneFileInclude(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "hosts.zone"), []byte("db IN A 192.0.2.10\nbad IN A nope\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	input := "$INCLUDE hosts.zone internal.example.com.\nafter IN A 192.0.2.20\n"
+	_, err := parseZoneFile(strings.NewReader(input), "example.com", ImportOptions{AllowInclude: true, IncludeDir: dir})
+	var zfe *ZoneFileError
+	if !errors.As(err, &zfe) || zfe.Line != 2 || !strings.HasSuffix(zfe.File, "hosts.zone") {
+		t.Fatalf("Expected error at hosts.zone:2, got %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "hosts.zone"), []byte("db IN A 192.0.2.10\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	records, err := parseZoneFile(strings.NewReader(input), "example.com", ImportOptions{AllowInclude: true, IncludeDir: dir})
+	if err != nil {
+		t.Fatalf("parseZoneFile failed: %v", err)
+	}
+	if len(records) != 2 || records[0].Name != "db.internal" || records[1].Name != "after" {
+		t.Errorf("Expected the include origin to be scoped to the included file, got %+v", records)
+	}
+}
+
+func TestImportZoneFile(t *testing.T) {
+	ctx := context.Background()
+	input := "$ORIGIN example.com.\nwww 300 IN A 192.0.2.99\nnew 300 IN TXT \"imported\"\n"
+
+	t.Run("Merge", func(t *testing.T) {
+		api := newFakeAPI(t, testZone())
+		changes, err := api.provider().ImportZoneFile(ctx, "example.com", strings.NewReader(input), ImportOptions{})
+		if err != nil {
+			t.Fatalf("ImportZoneFile failed: %v", err)
+		}
+		if changes.String() != "example.com: +1 -0 ~1" {
+			t.Errorf("Unexpected changes %s", changes)
+		}
+		if n := len(api.Zone("example.com").ResourceRecords); n != 4 {
+			t.Errorf("Expected existing records to be kept, got %d records", n)
+		}
+	})
+
+	t.Run("Replace", func(t *testing.T) {
+		api := newFakeAPI(t, testZone())
+		changes, err := api.provider().ImportZoneFile(ctx, "example.com", strings.NewReader(input), ImportOptions{
+			Replace: true,
+			Ignore:  []IgnoreRule{{Name: "_acme-challenge"}},
+		})
+		if err != nil {
+			t.Fatalf("ImportZoneFile failed: %v", err)
+		}
+		if changes.String() != "example.com: +1 -1 ~1" {
+			t.Errorf("Unexpected changes %s", changes)
+		}
+	})
+
+	t.Run("InvalidIgnore", func(t *testing.T) {
+		api := newFakeAPI(t, testZone())
+		_, err := api.provider().ImportZoneFile(ctx, "example.com", strings.NewReader(input), ImportOptions{
+			Replace: true,
+			Ignore:  []IgnoreRule{{Name: "[_acme-challenge"}},
+		})
+		if err == nil || !strings.Contains(err.Error(), "invalid ignore pattern") {
+			t.Fatalf("Expected an invalid pattern error, got %v", err)
+		}
+		if len(api.Requests()) != 0 {
+			t.Errorf("Expected no API calls, got %v", api.Requests())
+		}
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		api := newFakeAPI(t, testZone())
+		provider := api.provider()
+		empty := "; nothing but a comment\n$ORIGIN example.com.\n"
+
+		_, err := provider.ImportZoneFile(ctx, "example.com", strings.NewReader(empty), ImportOptions{Replace: true})
+		if !errors.Is(err, ErrEmptySync) {
+			t.Fatalf("Expected ErrEmptySync, got %v", err)
+		}
+		if n := len(api.Zone("example.com").ResourceRecords); n != 3 {
+			t.Errorf("Expected the zone to be kept, got %d records", n)
+		}
+
+		changes, err := provider.ImportZoneFile(ctx, "example.com", strings.NewReader(empty), ImportOptions{Replace: true, AllowEmpty: true})
+		if err != nil {
+			t.Fatalf("ImportZoneFile failed: %v", err)
+		}
+		if changes.String() != "example.com: +0 -3 ~0" {
+			t.Errorf("Unexpected changes %s", changes)
+		}
+	})
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		zone := testZone()
+		zone.ResourceRecords = append(zone.ResourceRecords,
+			ResourceRecord{Name: "", TTL: 86400, Type: "NS", Value: "ns1.example.net"},
+			ResourceRecord{Name: "sub", TTL: 86400, Type: "NS", Value: "ns1.example.net"},
+		)
+		api := newFakeAPI(t, zone)
+		provider := api.provider()
+
+		var export bytes.Buffer
+		if err := provider.ExportZoneFile(ctx, "example.com", &export); err != nil {
+			t.Fatalf("ExportZoneFile failed: %v", err)
+		}
+		changes, err := provider.ImportZoneFile(ctx, "example.com", &export, ImportOptions{Replace: true, DryRun: true})
+		if err != nil {
+			t.Fatalf("ImportZoneFile failed: %v", err)
+		}
+		if !changes.Empty() {
+			t.Errorf("Expected exported zone to import without changes, got %+v", changes)
+		}
+	})
+
+	t.Run("ErrorBeforeFetch", func(t *testing.T) {
+		api := newFakeAPI(t, testZone())
+		_, err := api.provider().ImportZoneFile(ctx, "example.com", strings.NewReader("www IN A bad\n"), ImportOptions{})
+		if err == nil {
+			t.Fatal("Expected an error")
+		}
+		if len(api.Requests()) != 0 {
+			t.Errorf("Expected no API calls, got %v", api.Requests())
+		}
+	})
+}
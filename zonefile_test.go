@@ -0,0 +1,66 @@
+package autodns
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportZoneFile(t *testing.T) {
+	zone := testZone()
+	zone.Updated = &AutoDNSTime{Time: time.Date(2026, 10, 18, 9, 30, 0, 0, time.UTC)}
+	zone.NameServers = append(zone.NameServers, NameServer{Name: "ns1.example.com", IPAddresses: []string{"192.0.2.53", "2001:db8::53"}})
+	zone.ResourceRecords = append(zone.ResourceRecords,
+		ResourceRecord{Name: "_sip._tcp", TTL: 300, Type: "SRV", Value: "5 5060 sip.example.com", Pref: 10},
+		ResourceRecord{Name: "quote", TTL: 300, Type: "TXT", Value: `say "hi" \o/`},
+		ResourceRecord{Name: "long", TTL: 300, Type: "TXT", Value: strings.Repeat("a", 300)},
+		ResourceRecord{Name: "", TTL: 300, Type: "CAA", Value: `0 issue "letsencrypt.org"`},
+		ResourceRecord{Name: "alias", TTL: 300, Type: "CNAME", Value: "www.example.com"},
+		ResourceRecord{Name: "10", TTL: 300, Type: "PTR", Value: "host.example.com."},
+	)
+
+	api := newFakeAPI(t, zone)
+	var out bytes.Buffer
+	if err := api.provider().ExportZoneFile(context.Background(), "example.com", &out); err != nil {
+		t.Fatalf("ExportZoneFile failed: %v", err)
+	}
+	export := out.String()
+
+	for _, want := range []string{
+		"$ORIGIN example.com.\n",
+		"$TTL 86400\n",
+		"@\t86400\tIN\tSOA\ta.ns14.net. hostmaster.example.com. (\n",
+		"\t2026101800\t; serial\n",
+		"\t43200\t; refresh\n",
+		"@\t86400\tIN\tNS\ta.ns14.net.\n",
+		"@\t86400\tIN\tNS\tns1.example.com.\n",
+		"ns1\t86400\tIN\tA\t192.0.2.53\n",
+		"ns1\t86400\tIN\tAAAA\t2001:db8::53\n",
+		"@\t300\tIN\tMX\t10 mail.example.com.\n",
+		"@\t300\tIN\tCAA\t0 issue \"letsencrypt.org\"\n",
+		"_sip._tcp\t300\tIN\tSRV\t10 5 5060 sip.example.com.\n",
+		"quote\t300\tIN\tTXT\t\"say \\\"hi\\\" \\\\o/\"\n",
+		"long\t300\tIN\tTXT\t\"" + strings.Repeat("a", 255) + "\" \"" + strings.Repeat("a", 45) + "\"\n",
+		"alias\t300\tIN\tCNAME\twww.example.com.\n",
+		"10\t300\tIN\tPTR\thost.example.com.\n",
+		"www\t300\tIN\tA\t192.0.2.1\n",
+	} {
+		if !strings.Contains(export, want) {
+			t.Errorf("Expected export to contain %q\n%s", want, export)
+		}
+	}
+
+	// Apex records come first and the output is stable
+	if strings.Index(export, "@\t300\tIN\tCAA") > strings.Index(export, "10\t300\tIN\tPTR") {
+		t.Error("Expected apex records before other names")
+	}
+	var again bytes.Buffer
+	if err := api.provider().ExportZoneFile(context.Background(), "example.com", &again); err != nil {
+		t.Fatalf("Second ExportZoneFile failed: %v", err)
+	}
+	if again.String() != export {
+		t.Error("Expected identical exports of an unchanged zone")
+	}
+}